@@ -1,15 +1,42 @@
 package main
 
 import (
+	"fmt"
+	"io"
+	"os"
+
 	"github.com/Lirt/velero-plugin-for-openstack/src/cinder"
+	"github.com/Lirt/velero-plugin-for-openstack/src/gc"
 	"github.com/Lirt/velero-plugin-for-openstack/src/manila"
 	"github.com/Lirt/velero-plugin-for-openstack/src/swift"
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/framework"
 )
 
 func main() {
+	// the plugin binary can be run as a garbage collector of orphaned
+	// OpenStack resources, e.g. "kubectl exec deploy/velero -c velero --
+	// /plugins/velero-plugin-for-openstack gc --delete"
+	if len(os.Args) > 1 {
+		var run func([]string, io.Writer, logrus.FieldLogger) error
+		switch os.Args[1] {
+		case "gc":
+			run = gc.Run
+		}
+		if run != nil {
+			logger := logrus.New()
+			logger.SetOutput(os.Stderr)
+			utils.AddRedactHook(logger)
+			if err := run(os.Args[2:], os.Stdout, logger); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	veleroplugin.NewServer().
 		BindFlags(pflag.CommandLine).
 		RegisterObjectStore("community.openstack.org/openstack", newSwiftObjectStore).
@@ -20,13 +47,16 @@ func main() {
 }
 
 func newSwiftObjectStore(logger logrus.FieldLogger) (interface{}, error) {
+	utils.AddRedactHook(logger)
 	return swift.NewObjectStore(logger), nil
 }
 
 func newCinderBlockStore(logger logrus.FieldLogger) (interface{}, error) {
+	utils.AddRedactHook(logger)
 	return cinder.NewBlockStore(logger), nil
 }
 
 func newManilaFSStore(logger logrus.FieldLogger) (interface{}, error) {
+	utils.AddRedactHook(logger)
 	return manila.NewFSStore(logger), nil
 }
@@ -0,0 +1,165 @@
+package cinder
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// cinderZoneKey is a node and persistent volume topology key of the Cinder
+// CSI driver
+const cinderZoneKey = "topology.cinder.csi.openstack.org/zone"
+
+// zoneKeys are topology keys, which contain the volume availability zone, in
+// the order of precedence
+var zoneKeys = []string{
+	cinderZoneKey,
+	v1.LabelTopologyZone,
+	v1.LabelFailureDomainBetaZone,
+}
+
+// resolveVolumeAZ maps the original volume availability zone to the
+// availability zone of the restored volume. When availabilityZoneFromNodes is
+// enabled and the mapped availability zone doesn't match any node, the zone
+// with the most nodes is picked.
+func (b *BlockStore) resolveVolumeAZ(volumeAZ string) (string, error) {
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"volumeAZ": volumeAZ,
+	})
+
+	newVolumeAZ, ok := b.azMapping[volumeAZ]
+	if !ok {
+		newVolumeAZ = volumeAZ
+	}
+	if newVolumeAZ != volumeAZ {
+		logWithFields.Infof("Availability zone is mapped to the %q availability zone", newVolumeAZ)
+	}
+	if !b.azFromNodes {
+		return newVolumeAZ, nil
+	}
+
+	zones, err := b.getNodeZones()
+	if err != nil {
+		return "", err
+	}
+	if len(zones) == 0 {
+		logWithFields.Warn("Nodes don't have availability zone topology labels")
+		return newVolumeAZ, nil
+	}
+	if zones[newVolumeAZ] > 0 {
+		return newVolumeAZ, nil
+	}
+
+	names := make([]string, 0, len(zones))
+	for zone := range zones {
+		names = append(names, zone)
+	}
+	sort.Strings(names)
+	nodeAZ := names[0]
+	for _, zone := range names[1:] {
+		if zones[zone] > zones[nodeAZ] {
+			nodeAZ = zone
+		}
+	}
+	logWithFields.Infof("Availability zone %q doesn't match any node, using the %q node availability zone", newVolumeAZ, nodeAZ)
+
+	return nodeAZ, nil
+}
+
+// getNodeZones returns the number of schedulable nodes per availability zone
+func (b *BlockStore) getNodeZones() (map[string]int, error) {
+	client, err := b.getKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := client.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	zones := make(map[string]int)
+	for _, node := range nodes.Items {
+		if node.Spec.Unschedulable {
+			continue
+		}
+		for _, key := range zoneKeys {
+			if zone := node.Labels[key]; zone != "" {
+				zones[zone]++
+				break
+			}
+		}
+	}
+	return zones, nil
+}
+
+// createVolume creates the volume. When availabilityZoneFallback is enabled
+// and the availability zone is not valid, the volume creation is retried
+// without the availability zone.
+func (b *BlockStore) createVolume(logWithFields *logrus.Entry, opts volumes.CreateOpts) (*volumes.Volume, error) {
+	volume, err := volumes.Create(b.client, opts).Extract()
+	if err == nil || !b.azFallback || opts.AvailabilityZone == "" {
+		return volume, err
+	}
+	if _, ok := err.(gophercloud.ErrDefault400); !ok || !strings.Contains(strings.ToLower(err.Error()), "availability zone") {
+		return volume, err
+	}
+
+	logWithFields.WithError(err).Warnf("Failed to create volume in the %q availability zone, retrying without the availability zone", opts.AvailabilityZone)
+	opts.AvailabilityZone = ""
+	return volumes.Create(b.client, opts).Extract()
+}
+
+// setPersistentVolumeZone sets the volume availability zone in the persistent
+// volume zone labels and the node affinity
+func (b *BlockStore) setPersistentVolumeZone(logWithFields *logrus.Entry, pv *v1.PersistentVolume, volumeID string) error {
+	var exprs []*v1.NodeSelectorRequirement
+	if pv.Spec.NodeAffinity != nil && pv.Spec.NodeAffinity.Required != nil {
+		for i := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms {
+			term := &pv.Spec.NodeAffinity.Required.NodeSelectorTerms[i]
+			for j := range term.MatchExpressions {
+				expr := &term.MatchExpressions[j]
+				if expr.Operator == v1.NodeSelectorOpIn && utils.SliceContains(zoneKeys, expr.Key) {
+					exprs = append(exprs, expr)
+				}
+			}
+		}
+	}
+	var labels []string
+	for key := range pv.Labels {
+		if utils.SliceContains(zoneKeys, key) {
+			labels = append(labels, key)
+		}
+	}
+	if len(exprs) == 0 && len(labels) == 0 {
+		return nil
+	}
+
+	volume, err := volumes.Get(b.restoreClient(), volumeID).Extract()
+	if err != nil {
+		logWithFields.Error("failed to get volume from cinder")
+		return fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err)
+	}
+	if volume.AvailabilityZone == "" {
+		return nil
+	}
+
+	for _, expr := range exprs {
+		if len(expr.Values) != 1 || expr.Values[0] != volume.AvailabilityZone {
+			logWithFields.Infof("Setting the %q node affinity to the %q availability zone", expr.Key, volume.AvailabilityZone)
+			expr.Values = []string{volume.AvailabilityZone}
+		}
+	}
+	for _, key := range labels {
+		pv.Labels[key] = volume.AvailabilityZone
+	}
+
+	return nil
+}
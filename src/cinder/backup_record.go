@@ -0,0 +1,139 @@
+package cinder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/backups"
+	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/objects"
+	"github.com/sirupsen/logrus"
+)
+
+// backupRecordObject returns the Swift object name of the backup record
+func (b *BlockStore) backupRecordObject(backupID string) string {
+	return b.backupRecordPrefix + backupID + ".json"
+}
+
+// exportBackupRecord exports the backup record and stores it in the backup
+// record Swift container, so the backup can be imported in another cloud,
+// which shares the backup storage backend
+func (b *BlockStore) exportBackupRecord(logWithFields *logrus.Entry, backupID string) error {
+	record, err := backups.Export(b.client, backupID).Extract()
+	if err != nil {
+		logWithFields.Error("failed to export backup record")
+		return fmt.Errorf("failed to export backup %v record: %w", backupID, err)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup %v record: %w", backupID, err)
+	}
+
+	object := b.backupRecordObject(backupID)
+	opts := objects.CreateOpts{
+		Content:     bytes.NewReader(data),
+		ContentType: "application/json",
+	}
+	_, err = objects.Create(b.objClient, b.backupRecordContainer, object, opts).Extract()
+	if err != nil {
+		logWithFields.Error("failed to upload backup record")
+		return fmt.Errorf("failed to upload backup %v record to %s/%s: %w", backupID, b.backupRecordContainer, object, err)
+	}
+	logWithFields.Infof("Backup record was stored in %s/%s", b.backupRecordContainer, object)
+
+	return nil
+}
+
+// importBackupRecord imports the backup from the stored backup record, when
+// the backup doesn't exist in the cloud. The parent backups of an incremental
+// backup are imported first, because the backup cannot be restored without
+// them.
+func (b *BlockStore) importBackupRecord(logWithFields *logrus.Entry, backupID string) error {
+	_, err := backups.Get(b.client, backupID).Extract()
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(gophercloud.ErrDefault404); !ok {
+		logWithFields.Error("failed to get backup")
+		return fmt.Errorf("failed to get backup %v: %w", backupID, err)
+	}
+
+	object := b.backupRecordObject(backupID)
+	logWithFields.Infof("Backup doesn't exist, importing it from the %s/%s backup record", b.backupRecordContainer, object)
+
+	res := objects.Download(b.objClient, b.backupRecordContainer, object, nil)
+	if res.Err != nil {
+		logWithFields.Error("failed to download backup record")
+		return fmt.Errorf("failed to download backup %v record from %s/%s: %w", backupID, b.backupRecordContainer, object, res.Err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read backup %v record: %w", backupID, err)
+	}
+
+	var record backups.BackupRecord
+	err = json.Unmarshal(data, &record)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal backup %v record: %w", backupID, err)
+	}
+
+	if parentID := backupRecordParentID(&record); parentID != "" {
+		err = b.importBackupRecord(logWithFields.WithField("parentBackupID", parentID), parentID)
+		if err != nil {
+			return fmt.Errorf("failed to import backup %v parent: %w", backupID, err)
+		}
+		_, err = b.waitForBackupStatus(parentID, backupStatuses, b.backupTimeout)
+		if err != nil {
+			logWithFields.Error("parent backup didn't get into 'available' state within the time limit")
+			return fmt.Errorf("parent backup %v didn't get into 'available' state within the time limit: %w", parentID, err)
+		}
+	}
+
+	imported, err := backups.Import(b.client, backups.ImportOpts(record)).Extract()
+	if err != nil {
+		logWithFields.Error("failed to import backup record")
+		return fmt.Errorf("failed to import backup %v record: %w", backupID, err)
+	}
+	if imported.ID != backupID {
+		return fmt.Errorf("backup record was imported as %v backup instead of %v", imported.ID, backupID)
+	}
+	logWithFields.Info("Backup record was imported")
+
+	return nil
+}
+
+// backupRecordParentID returns the parent backup ID of an incremental backup
+// from the backup fields encoded in the backup record URL
+func backupRecordParentID(record *backups.BackupRecord) string {
+	var backup struct {
+		ParentID string            `json:"parent_id"`
+		Metadata map[string]string `json:"metadata"`
+	}
+	if json.Unmarshal(record.BackupURL, &backup) != nil {
+		return ""
+	}
+	if backup.ParentID != "" {
+		return backup.ParentID
+	}
+	return backup.Metadata[parentBackupKey]
+}
+
+// deleteBackupRecord removes the stored backup record
+func (b *BlockStore) deleteBackupRecord(logWithFields *logrus.Entry, backupID string) error {
+	object := b.backupRecordObject(backupID)
+	_, err := objects.Delete(b.objClient, b.backupRecordContainer, object, nil).Extract()
+	if err != nil {
+		if _, ok := err.(gophercloud.ErrDefault404); ok {
+			return nil
+		}
+		logWithFields.Error("failed to delete backup record")
+		return fmt.Errorf("failed to delete backup %v record from %s/%s: %w", backupID, b.backupRecordContainer, object, err)
+	}
+	logWithFields.Infof("Backup record %s/%s was deleted", b.backupRecordContainer, object)
+
+	return nil
+}
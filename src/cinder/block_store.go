@@ -5,32 +5,69 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"text/template"
+	"time"
 
 	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/apiversions"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/availabilityzones"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/backups"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/volumeactions"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/snapshots"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
 	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
 	"github.com/sirupsen/logrus"
+	veleroclient "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned"
 	velerovolumesnapshotter "github.com/vmware-tanzu/velero/pkg/plugin/velero/volumesnapshotter/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
 )
 
 const (
 	defaultTimeout           = "5m"
 	volumeBackupMicroversion = "3.47"
-	volumeImageMicroversion  = "3.1"
-	defaultDeleteDelay       = "10s"
+	// the minimum microversion, which supports backup availability zones
+	volumeBackupAZMicroversion = "3.51"
+	volumeImageMicroversion    = "3.1"
+	// the minimum microversion, which supports group snapshots
+	groupSnapshotMicroversion = "3.14"
+	defaultDeleteDelay        = "10s"
+	defaultDeleteConcurrency  = "10"
+	defaultFullBackupInterval = "168h"
+	defaultBackupContainer    = "{{.Name}}"
+	defaultBackupDescription  = "Velero volume backup"
+	defaultBackupRecordPrefix = "cinder-backup-records/"
+	// backup metadata key, which keeps the parent backup ID of an incremental backup
+	parentBackupKey = "velero-plugin-for-openstack/parent-backup"
+	// backup metadata key, which keeps the ID of the intermediate snapshot of
+	// a pending backup, which is deleted together with the backup
+	backupSnapshotKey = "velero-plugin-for-openstack/backup-snapshot"
+	// backup metadata key, which marks a backup with dependent incremental
+	// backups to be deleted together with its last dependent backup
+	deletePendingKey = "velero-plugin-for-openstack/delete-pending"
+	// snapshot metadata keys, which keep the encrypted flag, the encryption
+	// key ID, the encryption type and the volume type of an encrypted volume
+	encryptedKey            = "velero-plugin-for-openstack/encrypted"
+	encryptionKeyIDKey      = "velero-plugin-for-openstack/encryption-key-id"
+	encryptionTypeKey       = "velero-plugin-for-openstack/encryption-type"
+	encryptionVolumeTypeKey = "velero-plugin-for-openstack/encryption-volume-type"
+	// the minimum microversion, which shows volume encryption key IDs
+	volumeEncryptionKeyMicroversion = "3.64"
+	// image property prefixes of the Velero tags and the original volume
+	// metadata
+	imageTagPrefix            = "velero_tag:"
+	imageVolumeMetadataPrefix = "velero_volume_metadata:"
 )
 
 var (
+	// escapes JSON patch paths of image properties
+	jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
 	// a list of supported snapshot methods
 	supportedMethods = []string{
 		"snapshot",
@@ -66,6 +103,29 @@ var (
 	imageStatuses = []string{
 		"active",
 	}
+	// a list of disk formats supported by the Cinder image upload
+	supportedImageDiskFormats = []string{
+		"raw",
+		"qcow2",
+		"vmdk",
+		"vdi",
+		"vhd",
+		"vhdx",
+		"ploop",
+	}
+	// a list of Glance image visibilities
+	supportedImageVisibilities = []string{
+		string(images.ImageVisibilityPublic),
+		string(images.ImageVisibilityPrivate),
+		string(images.ImageVisibilityShared),
+		string(images.ImageVisibilityCommunity),
+	}
+	// image properties of the source region resources, which are not copied
+	// to images in other regions
+	regionImageProperties = []string{
+		"cinder_encryption_key_id",
+		"cinder_encryption_key_deletion_policy",
+	}
 	// a list of volume attributes to skip for image upload
 	skipVolumeAttributes = []string{
 		"direct_url",
@@ -77,6 +137,9 @@ var (
 		"container_format",
 		"disk_format",
 		"image_id",
+		// Glance multiple stores attribute, the os_glance_ prefixed attributes
+		// are skipped by the glanceReservedPrefix
+		"stores",
 		// these integer values have to be set separately
 		"min_disk",
 		"min_ram",
@@ -85,10 +148,15 @@ var (
 
 // BlockStore is a plugin for containing state for the Cinder Block Storage
 type BlockStore struct {
-	client             *gophercloud.ServiceClient
-	imgClient          *gophercloud.ServiceClient
-	provider           *gophercloud.ProviderClient
-	config             map[string]string
+	client    *gophercloud.ServiceClient
+	imgClient *gophercloud.ServiceClient
+	objClient *gophercloud.ServiceClient
+	provider  *gophercloud.ProviderClient
+	config    map[string]string
+	// snapshot method followed by the fallback methods
+	methods []string
+	// set up errors of the supported methods, which aren't configured
+	methodErrors       map[string]error
 	volumeTimeout      int
 	snapshotTimeout    int
 	cloneTimeout       int
@@ -96,8 +164,61 @@ type BlockStore struct {
 	imageTimeout       int
 	ensureDeleted      bool
 	ensureDeletedDelay int
+	pollInterval       time.Duration
+	deleteConcurrency  int
 	cascadeDelete      bool
-	log                logrus.FieldLogger
+	incrementalBackup  bool
+	fullBackupInterval int
+	backupFromSnapshot bool
+	backupContainer    *template.Template
+	backupDescription  *template.Template
+	backupAZ           string
+	// Swift container and object name prefix of the exported backup records
+	backupRecordContainer string
+	backupRecordPrefix    string
+	// PV label or annotation key, which groups volumes into generic volume groups
+	volumeGroupKey  string
+	volumeGroupType string
+	groupMu         sync.Mutex
+	// original to restored volume type mapping and the fallback volume type
+	volumeTypeMapping          map[string]string
+	volumeTypeMappingConfigMap string
+	defaultVolumeType          string
+	// volume type of volumes restored from multi-attach volumes and whether
+	// the retype may migrate the volume to another backend
+	multiattachVolumeType      string
+	multiattachRetypeMigration bool
+	// Glance image options of the image method
+	imageDiskFormat  string
+	imageCompression bool
+	imageVisibility  string
+	imageProtected   bool
+	imageStore       string
+	// additional Glance stores and regions of the image copies
+	imageCopyStores  []string
+	imageCopyRegions []string
+	imgRegionClients map[string]*gophercloud.ServiceClient
+	imgRegionMu      sync.Mutex
+	region           string
+	// Barbican client, which checks encryption keys of encrypted volumes
+	kmClient *gophercloud.ServiceClient
+	// clouds.yaml cloud of the project, which accepts the restored volumes
+	transferCloud    string
+	transferProvider *gophercloud.ProviderClient
+	transferClient   *gophercloud.ServiceClient
+	// refuses to create resources, which would exceed the project quota
+	// reduced by the margin percentage
+	quotaCheck  bool
+	quotaMargin int
+	// original to restored availability zone mapping
+	azMapping   map[string]string
+	azFromNodes bool
+	azFallback  bool
+	kubeClient  kubernetes.Interface
+	// veleroClient is used to get the backup and restore UIDs, which the
+	// backup resource and restored volume names are derived from
+	veleroClient veleroclient.Interface
+	log          logrus.FieldLogger
 }
 
 // NewBlockStore instantiates a Cinder Volume Snapshotter.
@@ -112,15 +233,24 @@ var _ velerovolumesnapshotter.VolumeSnapshotter = (*BlockStore)(nil)
 // cannot be initialized from the provided config.
 func (b *BlockStore) Init(config map[string]string) error {
 	b.log.WithFields(logrus.Fields{
-		"config": config,
+		"config": utils.RedactConfig(config),
 	}).Info("BlockStore.Init called")
 	b.config = config
 
-	// parse the snapshot method
+	// parse the snapshot method and its fallback methods
 	b.config["method"] = utils.GetConf(b.config, "method", "snapshot")
 	if !utils.SliceContains(supportedMethods, b.config["method"]) {
 		return fmt.Errorf("unsupported %q snapshot method, supported methods: %q", b.config["method"], supportedMethods)
 	}
+	b.methods = []string{b.config["method"]}
+	for _, method := range utils.SplitList(utils.GetConf(b.config, "methodFallback", "")) {
+		if !utils.SliceContains(supportedMethods, method) {
+			return fmt.Errorf("unsupported %q fallback snapshot method, supported methods: %q", method, supportedMethods)
+		}
+		if !utils.SliceContains(b.methods, method) {
+			b.methods = append(b.methods, method)
+		}
+	}
 
 	// parse timeouts
 	var err error
@@ -144,6 +274,10 @@ func (b *BlockStore) Init(config map[string]string) error {
 	if err != nil {
 		return fmt.Errorf("cannot parse time from imageTimeout config variable: %w", err)
 	}
+	b.pollInterval, err = utils.ParsePollInterval(b.config)
+	if err != nil {
+		return err
+	}
 	// parse options
 	b.ensureDeleted, err = strconv.ParseBool(utils.GetConf(b.config, "ensureDeleted", "false"))
 	if err != nil {
@@ -157,6 +291,97 @@ func (b *BlockStore) Init(config map[string]string) error {
 	if err != nil {
 		return fmt.Errorf("cannot parse cascadeDelete config variable: %w", err)
 	}
+	b.incrementalBackup, err = strconv.ParseBool(utils.GetConf(b.config, "incrementalBackup", "false"))
+	if err != nil {
+		return fmt.Errorf("cannot parse incrementalBackup config variable: %w", err)
+	}
+	b.fullBackupInterval, err = utils.DurationToSeconds(utils.GetConf(b.config, "fullBackupInterval", defaultFullBackupInterval))
+	if err != nil {
+		return fmt.Errorf("cannot parse time from fullBackupInterval config variable: %w", err)
+	}
+	b.backupFromSnapshot, err = strconv.ParseBool(utils.GetConf(b.config, "backupFromSnapshot", "false"))
+	if err != nil {
+		return fmt.Errorf("cannot parse backupFromSnapshot config variable: %w", err)
+	}
+	b.backupContainer, err = template.New("backupContainer").Option("missingkey=error").Parse(utils.GetConf(b.config, "backupContainer", defaultBackupContainer))
+	if err != nil {
+		return fmt.Errorf("cannot parse backupContainer config variable: %w", err)
+	}
+	b.backupDescription, err = template.New("backupDescription").Option("missingkey=error").Parse(utils.GetConf(b.config, "backupDescription", defaultBackupDescription))
+	if err != nil {
+		return fmt.Errorf("cannot parse backupDescription config variable: %w", err)
+	}
+	b.backupAZ = utils.GetConf(b.config, "backupAvailabilityZone", "")
+	b.backupRecordContainer = utils.GetConf(b.config, "backupRecordContainer", "")
+	b.backupRecordPrefix = utils.GetConf(b.config, "backupRecordPrefix", defaultBackupRecordPrefix)
+	b.volumeGroupKey = utils.GetConf(b.config, "volumeGroupKey", "")
+	b.volumeGroupType = utils.GetConf(b.config, "volumeGroupType", "")
+	if b.volumeGroupKey != "" {
+		if b.config["method"] != "snapshot" {
+			return fmt.Errorf("volumeGroupKey config option is supported only by the snapshot method")
+		}
+		if b.volumeGroupType == "" {
+			return fmt.Errorf("volumeGroupType config variable is required by the volumeGroupKey config option")
+		}
+	}
+	b.imageDiskFormat = utils.GetConf(b.config, "imageDiskFormat", "")
+	if b.imageDiskFormat != "" && !utils.SliceContains(supportedImageDiskFormats, b.imageDiskFormat) {
+		return fmt.Errorf("unsupported %q image disk format, supported disk formats: %q", b.imageDiskFormat, supportedImageDiskFormats)
+	}
+	b.imageCompression, err = strconv.ParseBool(utils.GetConf(b.config, "imageCompression", "false"))
+	if err != nil {
+		return fmt.Errorf("cannot parse imageCompression config variable: %w", err)
+	}
+	b.imageVisibility = utils.GetConf(b.config, "imageVisibility", string(images.ImageVisibilityPrivate))
+	if !utils.SliceContains(supportedImageVisibilities, b.imageVisibility) {
+		return fmt.Errorf("unsupported %q image visibility, supported visibilities: %q", b.imageVisibility, supportedImageVisibilities)
+	}
+	b.imageProtected, err = strconv.ParseBool(utils.GetConf(b.config, "imageProtected", "false"))
+	if err != nil {
+		return fmt.Errorf("cannot parse imageProtected config variable: %w", err)
+	}
+	b.imageStore = utils.GetConf(b.config, "imageStore", "")
+	b.imageCopyStores = utils.SplitList(utils.GetConf(b.config, "imageCopyStores", ""))
+	b.imageCopyRegions = utils.SplitList(utils.GetConf(b.config, "imageCopyRegions", ""))
+	b.volumeTypeMapping, err = utils.ParseMapping(utils.GetConf(b.config, "volumeTypeMapping", ""))
+	if err != nil {
+		return fmt.Errorf("cannot parse volumeTypeMapping config variable: %w", err)
+	}
+	b.volumeTypeMappingConfigMap = utils.GetConf(b.config, "volumeTypeMappingConfigMap", "")
+	b.defaultVolumeType = utils.GetConf(b.config, "defaultVolumeType", "")
+	b.multiattachVolumeType = utils.GetConf(b.config, "multiattachVolumeType", "")
+	b.multiattachRetypeMigration, err = strconv.ParseBool(utils.GetConf(b.config, "multiattachRetypeMigration", "false"))
+	if err != nil {
+		return fmt.Errorf("cannot parse multiattachRetypeMigration config variable: %w", err)
+	}
+	b.azMapping, err = utils.ParseMapping(utils.GetConf(b.config, "availabilityZoneMapping", ""))
+	if err != nil {
+		return fmt.Errorf("cannot parse availabilityZoneMapping config variable: %w", err)
+	}
+	b.azFromNodes, err = strconv.ParseBool(utils.GetConf(b.config, "availabilityZoneFromNodes", "false"))
+	if err != nil {
+		return fmt.Errorf("cannot parse availabilityZoneFromNodes config variable: %w", err)
+	}
+	b.azFallback, err = strconv.ParseBool(utils.GetConf(b.config, "availabilityZoneFallback", "false"))
+	if err != nil {
+		return fmt.Errorf("cannot parse availabilityZoneFallback config variable: %w", err)
+	}
+	b.transferCloud = utils.GetConf(b.config, "transferCloud", "")
+	b.quotaCheck, err = strconv.ParseBool(utils.GetConf(b.config, "quotaCheck", "false"))
+	if err != nil {
+		return fmt.Errorf("cannot parse quotaCheck config variable: %w", err)
+	}
+	b.quotaMargin, err = utils.ParseQuotaMargin(utils.GetConf(b.config, "quotaMargin", "0"))
+	if err != nil {
+		return fmt.Errorf("cannot parse quotaMargin config variable: %w", err)
+	}
+	b.deleteConcurrency, err = strconv.Atoi(utils.GetConf(b.config, "deleteConcurrency", defaultDeleteConcurrency))
+	if err != nil {
+		return fmt.Errorf("cannot parse deleteConcurrency config variable: %w", err)
+	}
+	if b.deleteConcurrency < 1 {
+		return fmt.Errorf("deleteConcurrency config variable must be positive")
+	}
 
 	// Authenticate to OpenStack
 	err = utils.Authenticate(&b.provider, "cinder", config, b.log)
@@ -178,40 +403,36 @@ func (b *BlockStore) Init(config map[string]string) error {
 			Region: region,
 		})
 		if err != nil {
-			return fmt.Errorf("failed to create cinder storage client: %w", err)
+			return utils.WithRequestID(fmt.Errorf("failed to create cinder storage client: %w", err))
 		}
+		b.region = region
+		b.kmClient = nil
 
 		logWithFields := b.log.WithFields(logrus.Fields{
 			"endpoint": b.client.Endpoint,
 			"region":   region,
 		})
 
-		// set minimum supported Cinder microversion for backups or images
-		switch b.config["method"] {
-		case "backup":
-			err = b.setCinderMicroversion(volumeBackupMicroversion)
-			if err != nil {
-				return err
-			}
-			logWithFields.Infof("Setting the supported %v microversion", b.client.Microversion)
-		case "image":
-			err = b.setCinderMicroversion(volumeImageMicroversion)
+		if err = b.initMethods(); err != nil {
+			return err
+		}
+
+		if b.volumeGroupKey != "" {
+			err = b.setCinderMicroversion(groupSnapshotMicroversion, "group snapshots")
 			if err != nil {
-				return err
+				return fmt.Errorf("volumeGroupKey config option is not supported: %w", err)
 			}
 			logWithFields.Infof("Setting the supported %v microversion", b.client.Microversion)
+		}
 
-			b.imgClient, err = openstack.NewImageServiceV2(b.provider, gophercloud.EndpointOpts{
-				Region: region,
-			})
+		logWithFields.Info("Successfully created block storage service client")
+
+		if b.transferCloud != "" {
+			err = b.initTransferClient(config, region)
 			if err != nil {
-				return fmt.Errorf("failed to create glance image client: %w", err)
+				return err
 			}
-
-			logWithFields.Info("Successfully created image service client")
 		}
-
-		logWithFields.Info("Successfully created block storage service client")
 	}
 
 	return nil
@@ -221,30 +442,166 @@ func (b *BlockStore) Init(config map[string]string) error {
 // availability zone, initialized from the provided snapshot and with the specified type.
 // IOPS is ignored as it is not used in Cinder.
 func (b *BlockStore) CreateVolumeFromSnapshot(snapshotID, volumeType, volumeAZ string, iops *int64) (string, error) {
-	switch b.config["method"] {
+	volumeType, err := b.resolveVolumeType(volumeType)
+	if err != nil {
+		return "", utils.WithRequestID(err)
+	}
+	volumeAZ, err = b.resolveVolumeAZ(volumeAZ)
+	if err != nil {
+		return "", err
+	}
+	method, snapshotID, err := b.parseSnapshotID(snapshotID)
+	if err != nil {
+		return "", utils.WithRequestID(err)
+	}
+	tags, size, err := b.getSnapshotInfo(b.log.WithField("snapshotID", snapshotID), method, snapshotID)
+	if err != nil {
+		return "", utils.WithRequestID(err)
+	}
+	err = b.validateEncryption(method, snapshotID, volumeType, tags)
+	if err != nil {
+		return "", utils.WithRequestID(err)
+	}
+	// the restored volume is named after the in-progress Velero restore, so a
+	// retried restore reuses the volume
+	kind := "backup"
+	if method == "image" {
+		kind = "image"
+	}
+	tags = utils.RestoreTags(b.log, b.getVeleroClient, tags)
+	restoreUID := tags[utils.RestoreUIDTag]
+	volumeName := utils.ResourceName(snapshotID, kind, restoreUID)
+
+	var volumeID string
+	if restoreUID != "" {
+		var transferred bool
+		volumeID, transferred, err = b.findRestoredVolume(volumeName)
+		if err != nil || transferred {
+			return volumeID, utils.WithRequestID(err)
+		}
+	}
+	if volumeID == "" {
+		// the restored volume is created in the authenticated project and
+		// transferred into the project of the transferCloud
+		quotaRequest := map[string]int{
+			"volumes":   1,
+			"gigabytes": size,
+		}
+		err = b.checkQuota(b.client, fmt.Sprintf("a volume from snapshot %v", snapshotID), quotaRequest)
+		if err == nil && b.transferClient != nil {
+			err = b.checkQuota(b.transferClient, fmt.Sprintf("a volume from snapshot %v", snapshotID), quotaRequest)
+		}
+		if err != nil {
+			return "", utils.WithRequestID(err)
+		}
+
+		// restored volumes keep the ownership metadata of the snapshot
+		restoreTags := utils.OwnershipTags(tags, method, snapshotID)
+
+		switch method {
+		case "clone":
+			volumeID, err = b.createVolumeFromClone(snapshotID, volumeName, volumeType, volumeAZ, restoreTags)
+		case "backup":
+			volumeID, err = b.createVolumeFromBackup(snapshotID, volumeName, volumeType, volumeAZ, restoreTags)
+		case "image":
+			volumeID, err = b.createVolumeFromImage(snapshotID, volumeName, volumeType, volumeAZ, restoreTags)
+		default:
+			volumeID, err = b.createVolumeFromSnapshot(snapshotID, volumeName, volumeType, volumeAZ, restoreTags)
+		}
+	}
+	if err == nil {
+		if err = b.restoreAttachment(volumeID, tags); err != nil {
+			b.deleteFailedVolume(volumeID)
+			volumeID = ""
+		}
+	}
+	if err == nil {
+		if err = b.restoreBootable(volumeID, tags); err != nil {
+			b.deleteFailedVolume(volumeID)
+			volumeID = ""
+		}
+	}
+	if err == nil && b.transferClient != nil {
+		// the volume is deleted, when the transfer fails
+		if err = b.transferVolume(volumeID); err != nil {
+			volumeID = ""
+		}
+	}
+
+	return volumeID, utils.WithRequestID(err)
+}
+
+// deleteFailedVolume deletes the restored volume, when the snapshot
+// properties cannot be restored, so the failed restore doesn't leave the
+// volume behind
+func (b *BlockStore) deleteFailedVolume(volumeID string) {
+	logWithFields := b.log.WithField("volumeID", volumeID)
+	logWithFields.Info("Deleting the volume of the failed restore")
+	if err := volumes.Delete(b.client, volumeID, nil).ExtractErr(); err != nil {
+		logWithFields.WithError(err).Warn("failed to delete volume of the failed restore")
+	}
+}
+
+// getSnapshotInfo returns the tags kept in the snapshot metadata and the
+// snapshot size in GiB. Snapshots, which don't exist, e.g. backups to be
+// imported, don't have any tags and their size is 0.
+func (b *BlockStore) getSnapshotInfo(logWithFields *logrus.Entry, method, snapshotID string) (map[string]string, int, error) {
+	var tags map[string]string
+	var size int
+	var err error
+	switch method {
 	case "clone":
-		return b.createVolumeFromClone(snapshotID, volumeType, volumeAZ)
+		var volume *volumes.Volume
+		if volume, err = volumes.Get(b.client, snapshotID).Extract(); err == nil {
+			tags, size = volume.Metadata, volume.Size
+		}
 	case "backup":
-		return b.createVolumeFromBackup(snapshotID, volumeType, volumeAZ)
+		var backup *backups.Backup
+		if backup, err = backups.Get(b.client, snapshotID).Extract(); err == nil {
+			size = backup.Size
+			if backup.Metadata != nil {
+				tags = *backup.Metadata
+			}
+		}
 	case "image":
-		return b.createVolumeFromImage(snapshotID, volumeType, volumeAZ)
+		var image *images.Image
+		if image, err = images.Get(b.imgClient, snapshotID).Extract(); err == nil {
+			size = image.MinDiskGigabytes
+			tags = make(map[string]string)
+			for _, key := range []string{encryptedKey, encryptionKeyIDKey, encryptionTypeKey, encryptionVolumeTypeKey, multiattachVolumeTypeKey, readonlyKey, utils.BackupTag, utils.PVTag, utils.PVCKey} {
+				if v, ok := image.Properties[imageTagPrefix+key].(string); ok {
+					tags[key] = v
+				}
+			}
+		}
+	default:
+		var snapshot *snapshots.Snapshot
+		if snapshot, err = snapshots.Get(b.client, snapshotID).Extract(); err == nil {
+			tags, size = snapshot.Metadata, snapshot.Size
+		}
+	}
+	if err != nil {
+		if _, ok := err.(gophercloud.ErrDefault404); ok {
+			return nil, 0, nil
+		}
+		logWithFields.Error("failed to get snapshot")
+		return nil, 0, fmt.Errorf("failed to get snapshot %v: %w", snapshotID, err)
 	}
 
-	return b.createVolumeFromSnapshot(snapshotID, volumeType, volumeAZ)
+	return tags, size, nil
 }
 
-func (b *BlockStore) createVolumeFromSnapshot(snapshotID, volumeType, volumeAZ string) (string, error) {
+func (b *BlockStore) createVolumeFromSnapshot(snapshotID, volumeName, volumeType, volumeAZ string, tags map[string]string) (string, error) {
 	logWithFields := b.log.WithFields(logrus.Fields{
 		"snapshotID":      snapshotID,
 		"volumeType":      volumeType,
 		"volumeAZ":        volumeAZ,
 		"snapshotTimeout": b.snapshotTimeout,
 		"volumeTimeout":   b.volumeTimeout,
-		"method":          b.config["method"],
+		"method":          "snapshot",
 	})
 	logWithFields.Info("BlockStore.CreateVolumeFromSnapshot called")
 
-	volumeName := fmt.Sprintf("%s.backup.%s", snapshotID, strconv.FormatUint(utils.Rand.Uint64(), 10))
 	// Make sure snapshot is in ready state
 	logWithFields.Info("Waiting for snapshot to be in 'available' state")
 
@@ -270,10 +627,10 @@ func (b *BlockStore) createVolumeFromSnapshot(snapshotID, volumeType, volumeAZ s
 		VolumeType:       volumeType,
 		AvailabilityZone: volumeAZ,
 		SnapshotID:       snapshotID,
-		Metadata:         originVolume.Metadata,
+		Metadata:         utils.Merge(originVolume.Metadata, tags),
 	}
 
-	volume, err := volumes.Create(b.client, opts).Extract()
+	volume, err := b.createVolume(logWithFields, opts)
 	if err != nil {
 		logWithFields.Error("failed to create volume from snapshot")
 		return "", fmt.Errorf("failed to create volume %v from snapshot %v: %w", volumeName, snapshotID, err)
@@ -291,20 +648,19 @@ func (b *BlockStore) createVolumeFromSnapshot(snapshotID, volumeType, volumeAZ s
 	return volume.ID, nil
 }
 
-func (b *BlockStore) createVolumeFromClone(cloneID, volumeType, volumeAZ string) (string, error) {
+func (b *BlockStore) createVolumeFromClone(cloneID, volumeName, volumeType, volumeAZ string, tags map[string]string) (string, error) {
 	logWithFields := b.log.WithFields(logrus.Fields{
 		"cloneID":       cloneID,
 		"volumeType":    volumeType,
 		"volumeAZ":      volumeAZ,
 		"cloneTimeout":  b.cloneTimeout,
 		"volumeTimeout": b.volumeTimeout,
-		"method":        b.config["method"],
+		"method":        "clone",
 	})
 	logWithFields.Info("BlockStore.CreateVolumeFromSnapshot called")
 
-	volumeName := fmt.Sprintf("%s.backup.%s", cloneID, strconv.FormatUint(utils.Rand.Uint64(), 10))
 	volumeDesc := "Velero backup from volume clone"
-	volumeID, err := b.cloneVolume(logWithFields, cloneID, volumeName, volumeDesc, volumeAZ, nil)
+	volumeID, err := b.cloneVolume(logWithFields, cloneID, volumeName, volumeDesc, volumeType, volumeAZ, tags)
 	if err != nil {
 		return volumeID, err
 	}
@@ -315,18 +671,25 @@ func (b *BlockStore) createVolumeFromClone(cloneID, volumeType, volumeAZ string)
 	return volumeID, nil
 }
 
-func (b *BlockStore) createVolumeFromBackup(backupID, volumeType, volumeAZ string) (string, error) {
+func (b *BlockStore) createVolumeFromBackup(backupID, volumeName, volumeType, volumeAZ string, tags map[string]string) (string, error) {
 	logWithFields := b.log.WithFields(logrus.Fields{
 		"backupID":      backupID,
 		"volumeType":    volumeType,
 		"volumeAZ":      volumeAZ,
 		"backupTimeout": b.backupTimeout,
 		"volumeTimeout": b.volumeTimeout,
-		"method":        b.config["method"],
+		"method":        "backup",
 	})
 	logWithFields.Info("BlockStore.CreateVolumeFromSnapshot called")
 
-	volumeName := fmt.Sprintf("%s.backup.%s", backupID, strconv.FormatUint(utils.Rand.Uint64(), 10))
+	// Import the backup created in another cloud
+	if b.backupRecordContainer != "" {
+		err := b.importBackupRecord(logWithFields, backupID)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	// Make sure backup is in ready state
 	logWithFields.Info("Waiting for backup to be in 'available' state")
 
@@ -345,12 +708,13 @@ func (b *BlockStore) createVolumeFromBackup(backupID, volumeType, volumeAZ strin
 		VolumeType:       volumeType,
 		AvailabilityZone: volumeAZ,
 		BackupID:         backupID,
+		Metadata:         tags,
 	}
 	if backup.Metadata != nil {
-		opts.Metadata = *backup.Metadata
+		opts.Metadata = utils.Merge(*backup.Metadata, tags)
 	}
 
-	volume, err := volumes.Create(b.client, opts).Extract()
+	volume, err := b.createVolume(logWithFields, opts)
 	if err != nil {
 		logWithFields.Error("failed to create volume from backup")
 		return "", fmt.Errorf("failed to create volume %v from backup %v: %w", volumeName, backupID, err)
@@ -368,22 +732,27 @@ func (b *BlockStore) createVolumeFromBackup(backupID, volumeType, volumeAZ strin
 	return volume.ID, nil
 }
 
-func (b *BlockStore) createVolumeFromImage(imageID, volumeType, volumeAZ string) (string, error) {
+func (b *BlockStore) createVolumeFromImage(imageID, volumeName, volumeType, volumeAZ string, tags map[string]string) (string, error) {
 	logWithFields := b.log.WithFields(logrus.Fields{
 		"imageID":       imageID,
 		"volumeType":    volumeType,
 		"volumeAZ":      volumeAZ,
 		"imageTimeout":  b.imageTimeout,
 		"volumeTimeout": b.volumeTimeout,
-		"method":        b.config["method"],
+		"method":        "image",
 	})
 	logWithFields.Info("BlockStore.CreateVolumeFromSnapshot called")
 
-	volumeName := fmt.Sprintf("%s.image.%s", imageID, strconv.FormatUint(utils.Rand.Uint64(), 10))
+	// The image may be copied from another region
+	imageID, err := b.findImage(logWithFields, imageID)
+	if err != nil {
+		return "", err
+	}
+
 	// Make sure image is in ready state
 	logWithFields.Info("Waiting for image to be in 'available' state")
 
-	_, err := b.waitForImageStatus(imageID, imageStatuses, b.imageTimeout)
+	image, err := b.waitForImageStatus(imageID, imageStatuses, b.imageTimeout)
 	if err != nil {
 		logWithFields.Error("image didn't get into 'active' state within the time limit")
 		return "", fmt.Errorf("image %v didn't get into 'active' state within the time limit: %w", imageID, err)
@@ -398,10 +767,10 @@ func (b *BlockStore) createVolumeFromImage(imageID, volumeType, volumeAZ string)
 		VolumeType:       volumeType,
 		AvailabilityZone: volumeAZ,
 		ImageID:          imageID,
-		// TODO: add Metadata support
+		Metadata:         utils.Merge(imageVolumeMetadata(image), tags),
 	}
 
-	volume, err := volumes.Create(b.client, opts).Extract()
+	volume, err := b.createVolume(logWithFields, opts)
 	if err != nil {
 		logWithFields.Error("failed to create volume from image")
 		return "", fmt.Errorf("failed to create volume %v from image %v: %w", volumeName, imageID, err)
@@ -419,7 +788,9 @@ func (b *BlockStore) createVolumeFromImage(imageID, volumeType, volumeAZ string)
 	return volume.ID, nil
 }
 
-func (b *BlockStore) cloneVolume(logWithFields *logrus.Entry, volumeID, volumeName, volumeDesc, volumeAZ string, tags map[string]string) (string, error) {
+// cloneVolume clones the volume, the volume type defaults to the source
+// volume type
+func (b *BlockStore) cloneVolume(logWithFields *logrus.Entry, volumeID, volumeName, volumeDesc, volumeType, volumeAZ string, tags map[string]string) (string, error) {
 	// Make sure source volume clone is in ready state
 	logWithFields.Info("Waiting for source volume clone to be in 'available' state")
 
@@ -429,19 +800,22 @@ func (b *BlockStore) cloneVolume(logWithFields *logrus.Entry, volumeID, volumeNa
 		return "", fmt.Errorf("source volume clone %v didn't get into 'available' state within the time limit: %w", volumeID, err)
 	}
 	logWithFields.Info("Source volume is in 'available' state")
+	if volumeType == "" {
+		volumeType = originVolume.VolumeType
+	}
 
 	// Create Cinder Volume from volume (backup)
 	logWithFields.Info("Starting to create volume from clone")
 	opts := volumes.CreateOpts{
 		Name:             volumeName,
 		Description:      volumeDesc,
-		VolumeType:       originVolume.VolumeType,
+		VolumeType:       volumeType,
 		AvailabilityZone: volumeAZ,
 		SourceVolID:      volumeID,
 		Metadata:         utils.Merge(originVolume.Metadata, tags),
 	}
 
-	volume, err := volumes.Create(b.client, opts).Extract()
+	volume, err := b.createVolume(logWithFields, opts)
 	if err != nil {
 		logWithFields.Error("failed to create volume from volume clone")
 		return "", fmt.Errorf("failed to create volume %v from volume clone %v: %w", volumeName, volumeID, err)
@@ -468,7 +842,7 @@ func (b *BlockStore) GetVolumeInfo(volumeID, volumeAZ string) (string, *int64, e
 	volume, err := volumes.Get(b.client, volumeID).Extract()
 	if err != nil {
 		logWithFields.Error("failed to get volume from cinder")
-		return "", nil, fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err)
+		return "", nil, utils.WithRequestID(fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err))
 	}
 
 	return volume.VolumeType, nil, nil
@@ -483,10 +857,10 @@ func (b *BlockStore) IsVolumeReady(volumeID, volumeAZ string) (ready bool, err e
 	logWithFields.Info("BlockStore.IsVolumeReady called")
 
 	// Get volume object from Cinder
-	volume, err := volumes.Get(b.client, volumeID).Extract()
+	volume, err := volumes.Get(b.restoreClient(), volumeID).Extract()
 	if err != nil {
 		logWithFields.Error("failed to get volume from cinder")
-		return false, fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err)
+		return false, utils.WithRequestID(fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err))
 	}
 
 	if utils.SliceContains(volumeStatuses, volume.Status) {
@@ -500,20 +874,57 @@ func (b *BlockStore) IsVolumeReady(volumeID, volumeAZ string) (ready bool, err e
 // CreateSnapshot creates a snapshot of the specified volume, and applies any provided
 // set of tags to the snapshot.
 func (b *BlockStore) CreateSnapshot(volumeID, volumeAZ string, tags map[string]string) (string, error) {
-	switch b.config["method"] {
+	volume, err := volumes.Get(b.client, volumeID).Extract()
+	if err != nil {
+		return "", utils.WithRequestID(fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err))
+	}
+	tags, err = b.addEncryptionTags(volume, tags)
+	if err != nil {
+		return "", utils.WithRequestID(err)
+	}
+	tags = attachmentTags(volume, tags)
+	tags = utils.ClaimTags(b.log.WithField("volumeID", volumeID), b.getKubeClient, tags)
+	tags = utils.BackupUIDTags(b.log.WithField("volumeID", volumeID), b.getVeleroClient, tags)
+	tags = utils.InstallationTags(b.log.WithField("volumeID", volumeID), b.getKubeClient, tags)
+
+	for i, method := range b.methods {
+		snapshotID, err := b.createSnapshotWithMethod(method, volume, volumeAZ, tags)
+		if err == nil || i == len(b.methods)-1 || !isCapabilityError(err) {
+			return b.formatSnapshotID(method, snapshotID), utils.WithRequestID(err)
+		}
+		b.log.WithFields(logrus.Fields{
+			"volumeID":       volumeID,
+			"method":         method,
+			"fallbackMethod": b.methods[i+1],
+		}).WithError(err).Warn("Snapshot method is not supported, trying the fallback method")
+		b.cleanupFailedSnapshot(method, snapshotID)
+	}
+
+	return "", fmt.Errorf("no snapshot method is configured")
+}
+
+// createSnapshotWithMethod creates a snapshot of the volume using the
+// snapshot method
+func (b *BlockStore) createSnapshotWithMethod(method string, volume *volumes.Volume, volumeAZ string, tags map[string]string) (string, error) {
+	if method != "image" {
+		// images keep the volume image metadata in the image properties
+		tags = bootableTags(b.log, volume, tags)
+	}
+	tags = utils.Merge(tags, utils.OwnershipTags(tags, method, volume.ID))
+
+	switch method {
 	case "clone":
-		return b.createClone(volumeID, volumeAZ, tags)
+		return b.createClone(volume.ID, volumeAZ, tags)
 	case "backup":
-		return b.createBackup(volumeID, volumeAZ, tags)
+		return b.createBackup(volume.ID, volumeAZ, tags)
 	case "image":
-		return b.createImage(volumeID, volumeAZ, tags)
+		return b.createImage(volume.ID, volumeAZ, tags)
 	}
-
-	return b.createSnapshot(volumeID, volumeAZ, tags)
+	return b.createSnapshot(volume.ID, volumeAZ, tags)
 }
 
 func (b *BlockStore) createSnapshot(volumeID, volumeAZ string, tags map[string]string) (string, error) {
-	snapshotName := fmt.Sprintf("%s.snap.%s", volumeID, strconv.FormatUint(utils.Rand.Uint64(), 10))
+	snapshotName := utils.ResourceName(volumeID, "snap", tags[utils.BackupUIDTag])
 	logWithFields := b.log.WithFields(logrus.Fields{
 		"snapshotName":    snapshotName,
 		"volumeID":        volumeID,
@@ -521,27 +932,48 @@ func (b *BlockStore) createSnapshot(volumeID, volumeAZ string, tags map[string]s
 		"tags":            tags,
 		"snapshotTimeout": b.snapshotTimeout,
 		"volumeTimeout":   b.volumeTimeout,
-		"method":          b.config["method"],
-	})
+		"method":          "snapshot",
+	}).WithFields(utils.BackupFields(tags))
 	logWithFields.Info("BlockStore.CreateSnapshot called")
 
+	if b.volumeGroupKey != "" {
+		snapshotID, ok, err := b.createGroupSnapshot(logWithFields, volumeID, tags)
+		if err != nil || ok {
+			return snapshotID, err
+		}
+	}
+
 	originVolume, err := volumes.Get(b.client, volumeID).Extract()
 	if err != nil {
 		logWithFields.Error("failed to get volume from cinder")
 		return "", fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err)
 	}
 
-	opts := snapshots.CreateOpts{
-		Name:        snapshotName,
-		Description: "Velero snapshot",
-		Metadata:    utils.Merge(originVolume.Metadata, tags),
-		VolumeID:    volumeID,
-		Force:       true,
-	}
-	snapshot, err := snapshots.Create(b.client, opts).Extract()
+	// reuse a snapshot created by a previous attempt of the same backup
+	snapshot, err := b.findSnapshotByName(snapshotName, volumeID)
 	if err != nil {
-		logWithFields.Error("failed to create snapshot from volume")
-		return "", fmt.Errorf("failed to create snapshot %v from volume %v: %w", snapshotName, volumeID, err)
+		logWithFields.Error("failed to find an existing snapshot")
+		return "", err
+	}
+	if snapshot != nil {
+		logWithFields.WithField("snapshotID", snapshot.ID).Info("Reusing the existing snapshot")
+	} else {
+		err = b.checkSnapshotQuota("snapshot", volumeID, originVolume.Size)
+		if err != nil {
+			return "", err
+		}
+		opts := snapshots.CreateOpts{
+			Name:        snapshotName,
+			Description: "Velero snapshot",
+			Metadata:    utils.Merge(originVolume.Metadata, tags),
+			VolumeID:    volumeID,
+			Force:       true,
+		}
+		snapshot, err = snapshots.Create(b.client, opts).Extract()
+		if err != nil {
+			logWithFields.Error("failed to create snapshot from volume")
+			return "", fmt.Errorf("failed to create snapshot %v from volume %v: %w", snapshotName, volumeID, err)
+		}
 	}
 
 	_, err = b.waitForSnapshotStatus(snapshot.ID, snapshotStatuses, b.snapshotTimeout)
@@ -558,21 +990,48 @@ func (b *BlockStore) createSnapshot(volumeID, volumeAZ string, tags map[string]s
 }
 
 func (b *BlockStore) createClone(volumeID, volumeAZ string, tags map[string]string) (string, error) {
-	cloneName := fmt.Sprintf("%s.clone.%s", volumeID, strconv.FormatUint(utils.Rand.Uint64(), 10))
+	cloneName := utils.ResourceName(volumeID, "clone", tags[utils.BackupUIDTag])
 	logWithFields := b.log.WithFields(logrus.Fields{
 		"cloneName":    cloneName,
 		"volumeID":     volumeID,
 		"volumeAZ":     volumeAZ,
 		"tags":         tags,
 		"cloneTimeout": b.cloneTimeout,
-		"method":       b.config["method"],
-	})
+		"method":       "clone",
+	}).WithFields(utils.BackupFields(tags))
 	logWithFields.Info("BlockStore.CreateSnapshot called")
 
-	cloneDesc := "Velero volume clone"
-	cloneID, err := b.cloneVolume(logWithFields, volumeID, cloneName, cloneDesc, volumeAZ, tags)
+	originVolume, err := volumes.Get(b.client, volumeID).Extract()
+	if err != nil {
+		logWithFields.Error("failed to get volume from cinder")
+		return "", fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err)
+	}
+
+	// reuse a clone created by a previous attempt of the same backup
+	clone, err := b.findVolumeByName(b.client, cloneName)
 	if err != nil {
-		return cloneID, err
+		logWithFields.Error("failed to find an existing volume clone")
+		return "", err
+	}
+	var cloneID string
+	if clone != nil {
+		cloneID = clone.ID
+		logWithFields.WithField("cloneID", cloneID).Info("Reusing the existing volume clone")
+		_, err = b.waitForVolumeStatus(cloneID, volumeStatuses, b.volumeTimeout)
+		if err != nil {
+			logWithFields.Error("volume didn't get into 'available' state within the time limit")
+			return cloneID, fmt.Errorf("volume %v didn't get into 'available' state within the time limit: %w", cloneID, err)
+		}
+	} else {
+		err = b.checkSnapshotQuota("clone", volumeID, originVolume.Size)
+		if err != nil {
+			return "", err
+		}
+		cloneDesc := "Velero volume clone"
+		cloneID, err = b.cloneVolume(logWithFields, volumeID, cloneName, cloneDesc, "", volumeAZ, tags)
+		if err != nil {
+			return cloneID, err
+		}
 	}
 
 	logWithFields.WithFields(logrus.Fields{
@@ -582,15 +1041,16 @@ func (b *BlockStore) createClone(volumeID, volumeAZ string, tags map[string]stri
 }
 
 func (b *BlockStore) createBackup(volumeID, volumeAZ string, tags map[string]string) (string, error) {
-	backupName := fmt.Sprintf("%s.backup.%s", volumeID, strconv.FormatUint(utils.Rand.Uint64(), 10))
+	backupName := utils.ResourceName(volumeID, "backup", tags[utils.BackupUIDTag])
 	logWithFields := b.log.WithFields(logrus.Fields{
-		"backupName":    backupName,
-		"volumeID":      volumeID,
-		"volumeAZ":      volumeAZ,
-		"tags":          tags,
-		"backupTimeout": b.backupTimeout,
-		"method":        b.config["method"],
-	})
+		"backupName":      backupName,
+		"volumeID":        volumeID,
+		"volumeAZ":        volumeAZ,
+		"tags":            tags,
+		"backupTimeout":   b.backupTimeout,
+		"snapshotTimeout": b.snapshotTimeout,
+		"method":          "backup",
+	}).WithFields(utils.BackupFields(tags))
 	logWithFields.Info("BlockStore.CreateSnapshot called")
 
 	originVolume, err := volumes.Get(b.client, volumeID).Extract()
@@ -599,43 +1059,353 @@ func (b *BlockStore) createBackup(volumeID, volumeAZ string, tags map[string]str
 		return "", fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err)
 	}
 
+	data := backupTemplateData{
+		Name:     backupName,
+		VolumeID: volumeID,
+		VolumeAZ: originVolume.AvailabilityZone,
+		Backup:   tags[utils.BackupTag],
+		PV:       tags[utils.PVTag],
+	}
+	container, err := executeTemplate(b.backupContainer, data)
+	if err != nil {
+		logWithFields.Error("failed to render backup container name")
+		return "", fmt.Errorf("failed to render backup container name: %w", err)
+	}
+	if container == "" || len(container) > 255 || strings.Contains(container, "/") {
+		logWithFields.Errorf("invalid %q backup container name", container)
+		return "", fmt.Errorf("invalid %q backup container name: must be 1-255 characters long and must not contain '/'", container)
+	}
+	description, err := executeTemplate(b.backupDescription, data)
+	if err != nil {
+		logWithFields.Error("failed to render backup description")
+		return "", fmt.Errorf("failed to render backup description: %w", err)
+	}
+
 	opts := &backups.CreateOpts{
 		Name:        backupName,
 		VolumeID:    volumeID,
-		Description: "Velero volume backup",
-		Container:   backupName,
+		Description: description,
+		Container:   container,
 		Metadata:    utils.Merge(originVolume.Metadata, tags),
 		Force:       true,
 	}
+	if b.backupAZ != "" {
+		if b.backupAZ != originVolume.AvailabilityZone {
+			err = b.validateBackupAZ(logWithFields, originVolume.AvailabilityZone)
+			if err != nil {
+				return "", err
+			}
+		}
+		opts.AvailabilityZone = b.backupAZ
+	}
+	// reuse a backup created by a previous attempt of the same backup
+	existing, err := b.findBackupByName(backupName, volumeID)
+	if err != nil {
+		logWithFields.Error("failed to find an existing volume backup")
+		return "", err
+	}
+	if existing != nil {
+		logWithFields.WithField("backupID", existing.ID).Info("Reusing the existing volume backup")
+		backupID, err := b.finishBackup(logWithFields, existing.ID)
+		if err == nil && existing.Metadata != nil && (*existing.Metadata)[backupSnapshotKey] != "" {
+			// the intermediate snapshot kept by the previous attempt
+			b.deleteIntermediateSnapshot(logWithFields, (*existing.Metadata)[backupSnapshotKey])
+		}
+		return backupID, err
+	}
+	err = b.checkSnapshotQuota("backup", volumeID, originVolume.Size)
+	if err != nil {
+		return "", err
+	}
+
+	if b.incrementalBackup {
+		parent, err := b.getParentBackup(logWithFields, volumeID, tags)
+		if err != nil {
+			logWithFields.Error("failed to get a parent backup")
+			return "", fmt.Errorf("failed to get a parent backup of volume %v: %w", volumeID, err)
+		}
+		if parent != nil {
+			logWithFields = logWithFields.WithField("parentBackupID", parent.ID)
+			logWithFields.Info("Creating an incremental volume backup")
+			// incremental backups must be stored in the parent backup container
+			opts.Container = parent.Container
+			opts.Incremental = true
+			opts.Metadata[parentBackupKey] = parent.ID
+		}
+	}
+	var keepSnapshot bool
+	if b.backupFromSnapshot {
+		// create an intermediate volume snapshot
+		snapOpts := snapshots.CreateOpts{
+			Name:        backupName,
+			Description: tempSnapshotDesc,
+			VolumeID:    volumeID,
+			Force:       true,
+			Metadata:    tags,
+		}
+		snapshot, err := snapshots.Create(b.client, snapOpts).Extract()
+		if err != nil {
+			logWithFields.Error("failed to create an intermediate snapshot from volume")
+			return "", fmt.Errorf("failed to create an intermediate snapshot from volume %v: %w", volumeID, err)
+		}
+		defer func() {
+			if keepSnapshot {
+				logWithFields.Infof("keeping an intermediate %s snapshot of the pending backup, it is deleted together with the backup", snapshot.ID)
+				return
+			}
+			b.deleteIntermediateSnapshot(logWithFields, snapshot.ID)
+		}()
+
+		// Make sure intermediate snapshot is in available status
+		logWithFields.Info("Waiting for intermediate snapshot to be in 'available' state")
+
+		_, err = b.waitForSnapshotStatus(snapshot.ID, snapshotStatuses, b.snapshotTimeout)
+		if err != nil {
+			logWithFields.Error("intermediate snapshot didn't get into 'available' state within the time limit")
+			return "", fmt.Errorf("intermediate snapshot %v didn't get into 'available' state within the time limit: %w", snapshot.ID, err)
+		}
+		logWithFields.Info("Intermediate snapshot is in 'available' state")
+
+		// the volume is backed up from the snapshot, force is not required
+		opts.SnapshotID = snapshot.ID
+		opts.Force = false
+	}
+
 	backup, err := backups.Create(b.client, opts).Extract()
 	if err != nil {
 		logWithFields.Error("failed to create backup from volume")
 		return "", fmt.Errorf("failed to create backup %v from volume %v: %w", backupName, volumeID, err)
 	}
 
-	_, err = b.waitForBackupStatus(backup.ID, backupStatuses, b.backupTimeout)
+	backupID, err := b.finishBackup(logWithFields, backup.ID)
+	if err != nil && opts.SnapshotID != "" {
+		// the snapshot cannot be deleted, while the pending backup reads it
+		keepSnapshot = b.keepBackupSnapshot(logWithFields, backup.ID, opts.SnapshotID)
+	}
+	return backupID, err
+}
+
+// keepBackupSnapshot records the intermediate snapshot of the pending backup
+// in the backup metadata, so the snapshot is deleted together with the
+// backup. False is returned, when the backup doesn't use the snapshot anymore.
+func (b *BlockStore) keepBackupSnapshot(logWithFields *logrus.Entry, backupID, snapshotID string) bool {
+	backup, err := backups.Get(b.client, backupID).Extract()
+	if err != nil {
+		logWithFields.WithError(err).Warn("failed to get volume backup, keeping the intermediate snapshot")
+		return true
+	}
+	if !utils.SliceContains(pendingBackupStatuses, backup.Status) {
+		return false
+	}
+
+	metadata := map[string]string{}
+	if backup.Metadata != nil {
+		metadata = *backup.Metadata
+	}
+	opts := backupUpdateOpts{
+		Metadata: utils.Merge(metadata, map[string]string{backupSnapshotKey: snapshotID}),
+	}
+	_, err = backups.Update(b.client, backupID, opts).Extract()
+	if err != nil {
+		logWithFields.WithError(err).Warn("failed to record the intermediate snapshot in the volume backup metadata")
+	}
+	return true
+}
+
+// deleteIntermediateSnapshot deletes the intermediate snapshot of a volume
+// backup
+func (b *BlockStore) deleteIntermediateSnapshot(logWithFields *logrus.Entry, snapshotID string) {
+	// Delete intermediate snapshot from Cinder
+	if b.ensureDeleted {
+		logWithFields.Infof("waiting for an intermediate %s snapshot to be deleted", snapshotID)
+		err := b.ensureSnapshotDeleted(logWithFields, snapshotID, b.snapshotTimeout)
+		if err != nil {
+			logWithFields.Errorf("failed to delete intermediate snapshot: %v", err)
+		}
+		return
+	}
+
+	logWithFields.Infof("removing an intermediate %s snapshot", snapshotID)
+	err := snapshots.Delete(b.client, snapshotID).ExtractErr()
+	if err != nil {
+		if _, ok := err.(gophercloud.ErrDefault404); ok {
+			logWithFields.Info("intermediate snapshot is already deleted")
+			return
+		}
+		logWithFields.Errorf("failed to delete intermediate snapshot: %v", err)
+	}
+}
+
+// finishBackup waits for the volume backup to become available and exports
+// its record
+func (b *BlockStore) finishBackup(logWithFields *logrus.Entry, backupID string) (string, error) {
+	_, err := b.waitForBackupStatus(backupID, backupStatuses, b.backupTimeout)
 	if err != nil {
 		logWithFields.Error("backup didn't get into 'available' state within the time limit")
-		return backup.ID, fmt.Errorf("backup %v didn't get into 'available' state within the time limit: %w", backup.ID, err)
+		return backupID, fmt.Errorf("backup %v didn't get into 'available' state within the time limit: %w", backupID, err)
 	}
 	logWithFields.Info("Volume backup is in 'available' state")
 
+	if b.backupRecordContainer != "" {
+		err = b.exportBackupRecord(logWithFields, backupID)
+		if err != nil {
+			return backupID, err
+		}
+	}
+
 	logWithFields.WithFields(logrus.Fields{
-		"backupID": backup.ID,
+		"backupID": backupID,
 	}).Info("Volume backup finished successfuly")
-	return backup.ID, nil
+	return backupID, nil
+}
+
+// backupTemplateData is used to render the backupContainer and
+// backupDescription templates
+type backupTemplateData struct {
+	// Name is the Cinder backup name
+	Name string
+	// VolumeID is the source volume ID
+	VolumeID string
+	// VolumeAZ is the source volume availability zone
+	VolumeAZ string
+	// Backup is the Velero backup name
+	Backup string
+	// PV is the persistent volume name
+	PV string
+}
+
+func executeTemplate(tmpl *template.Template, data backupTemplateData) (string, error) {
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// validateBackupAZ verifies that the backup availability zone, which differs
+// from the volume availability zone, exists and is available
+func (b *BlockStore) validateBackupAZ(logWithFields *logrus.Entry, volumeAZ string) error {
+	pages, err := availabilityzones.List(b.client).AllPages()
+	if err != nil {
+		logWithFields.Error("failed to list availability zones")
+		return fmt.Errorf("failed to list cinder availability zones: %w", err)
+	}
+	zones, err := availabilityzones.ExtractAvailabilityZones(pages)
+	if err != nil {
+		logWithFields.Error("failed to extract availability zones")
+		return fmt.Errorf("failed to extract cinder availability zones: %w", err)
+	}
+	for _, zone := range zones {
+		if zone.ZoneName == b.backupAZ && zone.ZoneState.Available {
+			logWithFields.Infof("Creating a backup in the %s availability zone, which differs from the %s volume availability zone", b.backupAZ, volumeAZ)
+			return nil
+		}
+	}
+
+	logWithFields.Errorf("backup availability zone %s doesn't exist or isn't available", b.backupAZ)
+	return fmt.Errorf("backup availability zone %q doesn't exist or isn't available, the volume is in the %q availability zone", b.backupAZ, volumeAZ)
+}
+
+// getParentBackup returns the latest volume backup, which can be used as a
+// parent of an incremental backup. Cinder always chains an incremental backup
+// to the latest volume backup, therefore nil is returned, when the latest
+// backup wasn't created by Velero for the same persistent volume or the full
+// backup of the chain is older than the full backup interval.
+func (b *BlockStore) getParentBackup(logWithFields *logrus.Entry, volumeID string, tags map[string]string) (*backups.Backup, error) {
+	pages, err := backups.ListDetail(b.client, backupListOpts{VolumeID: volumeID}).AllPages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s volume backups: %w", volumeID, err)
+	}
+	allBackups, err := backups.ExtractBackups(pages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract %s volume backups: %w", volumeID, err)
+	}
+
+	var latest *backups.Backup
+	byID := make(map[string]*backups.Backup, len(allBackups))
+	for i := range allBackups {
+		backup := &allBackups[i]
+		byID[backup.ID] = backup
+		if latest == nil || backupTimestamp(backup).After(backupTimestamp(latest)) {
+			latest = backup
+		}
+	}
+	if latest == nil {
+		logWithFields.Info("Volume has no backups, creating a full backup")
+		return nil, nil
+	}
+	if latest.Status != "available" {
+		logWithFields.Infof("The latest %s volume backup is in %q status, creating a full backup", latest.ID, latest.Status)
+		return nil, nil
+	}
+	if pv := tags[utils.PVTag]; pv == "" || latest.Metadata == nil || (*latest.Metadata)[utils.PVTag] != pv {
+		logWithFields.Infof("The latest %s volume backup wasn't created by Velero for the same persistent volume, creating a full backup", latest.ID)
+		return nil, nil
+	}
+
+	// find the full backup of the chain
+	full := latest
+	for full.IsIncremental {
+		var parentID string
+		if full.Metadata != nil {
+			parentID = (*full.Metadata)[parentBackupKey]
+		}
+		parent, ok := byID[parentID]
+		if !ok {
+			logWithFields.Infof("The %s volume backup chain is incomplete, creating a full backup", latest.ID)
+			return nil, nil
+		}
+		full = parent
+	}
+	if b.fullBackupInterval > 0 && time.Since(full.CreatedAt) >= time.Duration(b.fullBackupInterval)*time.Second {
+		logWithFields.Infof("The %s full volume backup is older than the full backup interval, creating a full backup", full.ID)
+		return nil, nil
+	}
+
+	return latest, nil
+}
+
+// backupListOpts allows to filter detailed backups by the name and the
+// volume ID
+type backupListOpts struct {
+	Name     string `q:"name"`
+	VolumeID string `q:"volume_id"`
+}
+
+// ToBackupListDetailQuery formats a backupListOpts into a query string.
+func (opts backupListOpts) ToBackupListDetailQuery() (string, error) {
+	q, err := gophercloud.BuildQueryString(opts)
+	return q.String(), err
+}
+
+// backupUpdateOpts wraps the backup update request body into the "backup" key,
+// which is missing in the gophercloud backups.UpdateOpts
+type backupUpdateOpts backups.UpdateOpts
+
+// ToBackupUpdateMap assembles a request body based on the contents of a
+// backupUpdateOpts.
+func (opts backupUpdateOpts) ToBackupUpdateMap() (map[string]interface{}, error) {
+	return gophercloud.BuildRequestBody(opts, "backup")
+}
+
+// backupTimestamp returns the time, which Cinder uses to find the latest backup
+func backupTimestamp(backup *backups.Backup) time.Time {
+	if backup.DataTimestamp.IsZero() {
+		return backup.CreatedAt
+	}
+	return backup.DataTimestamp
 }
 
 func (b *BlockStore) createImage(volumeID, volumeAZ string, tags map[string]string) (string, error) {
-	imageName := fmt.Sprintf("%s.image.%s", volumeID, strconv.FormatUint(utils.Rand.Uint64(), 10))
+	imageName := utils.ResourceName(volumeID, "image", tags[utils.BackupUIDTag])
 	logWithFields := b.log.WithFields(logrus.Fields{
 		"imageName":    imageName,
 		"volumeID":     volumeID,
 		"volumeAZ":     volumeAZ,
 		"tags":         tags,
 		"imageTimeout": b.imageTimeout,
-		"method":       b.config["method"],
-	})
+		"method":       "image",
+	}).WithFields(utils.BackupFields(tags))
 	logWithFields.Info("BlockStore.CreateSnapshot called")
 
 	originVolume, err := volumes.Get(b.client, volumeID).Extract()
@@ -644,69 +1414,136 @@ func (b *BlockStore) createImage(volumeID, volumeAZ string, tags map[string]stri
 		return "", fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err)
 	}
 
-	opts := &volumeactions.UploadImageOpts{
-		ImageName: imageName,
-		// Description: "Velero volume image",
-		ContainerFormat: originVolume.VolumeImageMetadata["container_format"],
-		DiskFormat:      originVolume.VolumeImageMetadata["disk_format"],
-		Visibility:      string(images.ImageVisibilityPrivate),
-		Force:           true,
-		// TODO: add Metadata support
+	diskFormat := b.imageDiskFormat
+	if diskFormat == "" {
+		diskFormat = originVolume.VolumeImageMetadata["disk_format"]
+	}
+	containerFormat := originVolume.VolumeImageMetadata["container_format"]
+	if b.imageCompression {
+		containerFormat = "compressed"
 	}
-	image, err := volumeactions.UploadImage(b.client, volumeID, opts).Extract()
+
+	// reuse an image uploaded by a previous attempt of the same backup
+	existing, err := b.findImageByName(imageName)
 	if err != nil {
-		logWithFields.Error("failed to create image from volume")
-		return "", fmt.Errorf("failed to create image %v from volume %v: %w", imageName, volumeID, err)
+		logWithFields.Error("failed to find an existing volume image")
+		return "", err
+	}
+	var imageID string
+	if existing != nil {
+		imageID = existing.ID
+		logWithFields.WithField("imageID", imageID).Info("Reusing the existing volume image")
+	} else {
+		err = b.checkSnapshotQuota("image", volumeID, originVolume.Size)
+		if err != nil {
+			return "", err
+		}
+		opts := &volumeactions.UploadImageOpts{
+			ImageName: imageName,
+			// Description: "Velero volume image",
+			ContainerFormat: containerFormat,
+			DiskFormat:      diskFormat,
+			Visibility:      b.imageVisibility,
+			Force:           true,
+		}
+		image, err := volumeactions.UploadImage(b.client, volumeID, opts).Extract()
+		if err != nil && b.imageCompression && isCompressionNotAllowed(err) {
+			logWithFields.WithError(err).Warn("Image compression is not allowed, uploading an uncompressed image")
+			opts.ContainerFormat = originVolume.VolumeImageMetadata["container_format"]
+			image, err = volumeactions.UploadImage(b.client, volumeID, opts).Extract()
+		}
+		if err != nil {
+			logWithFields.Error("failed to create image from volume")
+			return "", fmt.Errorf("failed to create image %v from volume %v: %w", imageName, volumeID, err)
+		}
+		imageID = image.ImageID
 	}
 
-	_, err = b.waitForImageStatus(image.ImageID, imageStatuses, b.imageTimeout)
+	activeImage, err := b.waitForImageStatus(imageID, imageStatuses, b.imageTimeout)
 	if err != nil {
 		logWithFields.Error("image didn't get into 'active' state within the time limit")
-		return image.ImageID, fmt.Errorf("image %v didn't get into 'active' state within the time limit: %w", image.ImageID, err)
+		return imageID, fmt.Errorf("image %v didn't get into 'active' state within the time limit: %w", imageID, err)
 	}
 	logWithFields.Info("Volume image is in 'active' state")
 
+	if b.imageStore != "" {
+		err = b.moveImageToStore(logWithFields, activeImage)
+		if err != nil {
+			return imageID, err
+		}
+	}
+
 	updateProperties := expandVolumeProperties(logWithFields, originVolume)
-	_, err = images.Update(b.imgClient, image.ImageID, updateProperties).Extract()
+	updateProperties = append(updateProperties, imageMetadataProperties(originVolume, tags)...)
+	if b.imageProtected {
+		updateProperties = append(updateProperties, images.ReplaceImageProtected{NewProtected: true})
+	}
+	updatedImage, err := images.Update(b.imgClient, imageID, updateProperties).Extract()
 	if err != nil {
 		logWithFields.Error("failed to update image properties")
-		return image.ImageID, fmt.Errorf("failed to update image properties: %w", err)
+		return imageID, fmt.Errorf("failed to update image properties: %w", err)
+	}
+
+	if len(b.imageCopyStores) > 0 || len(b.imageCopyRegions) > 0 {
+		err = b.copyImage(logWithFields, updatedImage)
+		if err != nil {
+			return imageID, err
+		}
 	}
 
 	logWithFields.WithFields(logrus.Fields{
-		"imageID": image.ImageID,
+		"imageID": imageID,
 	}).Info("Volume image finished successfuly")
-	return image.ImageID, nil
+	return imageID, nil
 }
 
 // DeleteSnapshot deletes the specified volume snapshot.
 func (b *BlockStore) DeleteSnapshot(snapshotID string) error {
-	switch b.config["method"] {
+	method, snapshotID, err := b.parseSnapshotID(snapshotID)
+	if err != nil {
+		return utils.WithRequestID(err)
+	}
+	switch method {
 	case "clone":
-		return b.deleteClone(snapshotID)
+		err = b.deleteClone(snapshotID)
 	case "backup":
-		return b.deleteBackup(snapshotID)
+		err = b.deleteBackup(snapshotID)
 	case "image":
-		return b.deleteImage(snapshotID)
+		err = b.deleteImage(snapshotID)
+	default:
+		err = b.deleteSnapshot(snapshotID)
 	}
 
-	return b.deleteSnapshot(snapshotID)
+	return utils.WithRequestID(err)
 }
 
 func (b *BlockStore) deleteSnapshot(snapshotID string) error {
 	logWithFields := b.log.WithFields(logrus.Fields{
 		"snapshotID": snapshotID,
-		"method":     b.config["method"],
+		"method":     "snapshot",
 	})
 	logWithFields.Info("BlockStore.DeleteSnapshot called")
 
+	snapshot, err := b.getGroupMemberSnapshot(snapshotID)
+	if err != nil {
+		if _, ok := err.(gophercloud.ErrDefault404); ok {
+			logWithFields.Info("snapshot is already deleted")
+			return nil
+		}
+		logWithFields.Error("failed to get snapshot")
+		return fmt.Errorf("failed to get snapshot %v: %w", snapshotID, err)
+	}
+	if snapshot.GroupSnapshotID != "" {
+		return b.deleteGroupSnapshot(logWithFields, snapshot)
+	}
+
 	// Delete snapshot from Cinder
 	if b.ensureDeleted {
 		logWithFields.Infof("waiting for a %s snapshot to be deleted", snapshotID)
 		return b.ensureSnapshotDeleted(logWithFields, snapshotID, b.snapshotTimeout)
 	}
 
-	err := snapshots.Delete(b.client, snapshotID).ExtractErr()
+	err = snapshots.Delete(b.client, snapshotID).ExtractErr()
 	if err != nil {
 		if _, ok := err.(gophercloud.ErrDefault404); ok {
 			logWithFields.Info("snapshot is already deleted")
@@ -735,6 +1572,8 @@ func (b *BlockStore) deleteSnapshots(logWithFields *logrus.Entry, volumeID strin
 
 	wg := sync.WaitGroup{}
 	errs := make(chan error, len(allSnapshots))
+	// limit the amount of parallel deletions
+	sem := make(chan struct{}, b.deleteConcurrency)
 	deleteSnapshot := func(snapshotID string) {
 		logWithFields.Infof("deleting the %s snapshot", snapshotID)
 		err := b.ensureSnapshotDeleted(logWithFields, snapshotID, b.snapshotTimeout)
@@ -742,11 +1581,13 @@ func (b *BlockStore) deleteSnapshots(logWithFields *logrus.Entry, volumeID strin
 			logWithFields.Errorf("failed to delete %s volume snapshot: %v", snapshotID, err)
 			errs <- fmt.Errorf("failed to delete %s volume snapshot: %w", snapshotID, err)
 		}
+		<-sem
 		wg.Done()
 	}
 
 	for _, snapshot := range allSnapshots {
 		wg.Add(1)
+		sem <- struct{}{}
 		go deleteSnapshot(snapshot.ID)
 	}
 
@@ -763,7 +1604,7 @@ func (b *BlockStore) deleteSnapshots(logWithFields *logrus.Entry, volumeID strin
 func (b *BlockStore) deleteClone(cloneID string) error {
 	logWithFields := b.log.WithFields(logrus.Fields{
 		"cloneID": cloneID,
-		"method":  b.config["method"],
+		"method":  "clone",
 	})
 	logWithFields.Info("BlockStore.DeleteSnapshot called")
 
@@ -797,10 +1638,79 @@ func (b *BlockStore) deleteClone(cloneID string) error {
 func (b *BlockStore) deleteBackup(backupID string) error {
 	logWithFields := b.log.WithFields(logrus.Fields{
 		"backupID": backupID,
-		"method":   b.config["method"],
+		"method":   "backup",
 	})
 	logWithFields.Info("BlockStore.DeleteSnapshot called")
 
+	// delete the backup and its parent backups pending deletion
+	pendingOnly := false
+	for id := backupID; id != ""; pendingOnly = true {
+		logWithFields := logWithFields.WithField("chainBackupID", id)
+		backup, err := backups.Get(b.client, id).Extract()
+		if err != nil {
+			if _, ok := err.(gophercloud.ErrDefault404); ok {
+				logWithFields.Info("volume backup is already deleted")
+				if b.backupRecordContainer != "" {
+					return b.deleteBackupRecord(logWithFields, id)
+				}
+				return nil
+			}
+			logWithFields.Error("failed to get volume backup")
+			return fmt.Errorf("failed to get volume backup %v: %w", id, err)
+		}
+
+		metadata := map[string]string{}
+		if backup.Metadata != nil {
+			metadata = *backup.Metadata
+		}
+		if pendingOnly && metadata[deletePendingKey] != "true" {
+			return nil
+		}
+
+		if backup.HasDependentBackups {
+			if pendingOnly {
+				return nil
+			}
+			// incremental backups cannot exist without their parent, the
+			// backup is deleted together with its last dependent backup
+			logWithFields.Info("volume backup has dependent backups, marking it to be deleted later")
+			opts := backupUpdateOpts{
+				Metadata: utils.Merge(metadata, map[string]string{deletePendingKey: "true"}),
+			}
+			_, err = backups.Update(b.client, id, opts).Extract()
+			if err != nil {
+				logWithFields.Error("failed to mark volume backup to be deleted")
+				return fmt.Errorf("failed to mark volume backup %v to be deleted: %w", id, err)
+			}
+			return nil
+		}
+
+		parentID := metadata[parentBackupKey]
+		// the intermediate snapshot kept by a pending backup is deleted,
+		// after the backup is deleted
+		snapshotID := metadata[backupSnapshotKey]
+		err = b.removeBackup(logWithFields, id, parentID != "" || snapshotID != "")
+		if err != nil {
+			return err
+		}
+		if snapshotID != "" {
+			b.deleteIntermediateSnapshot(logWithFields, snapshotID)
+		}
+		if b.backupRecordContainer != "" {
+			err = b.deleteBackupRecord(logWithFields, id)
+			if err != nil {
+				return err
+			}
+		}
+		id = parentID
+	}
+
+	return nil
+}
+
+// removeBackup deletes the volume backup. When wait is true, it waits for the
+// backup to be deleted, so its parent backup can be deleted afterwards.
+func (b *BlockStore) removeBackup(logWithFields *logrus.Entry, backupID string, wait bool) error {
 	// Delete volume backup from Cinder
 	if b.ensureDeleted {
 		logWithFields.Infof("waiting for a %s volume backup deleted", backupID)
@@ -817,21 +1727,72 @@ func (b *BlockStore) deleteBackup(backupID string) error {
 		return fmt.Errorf("failed to delete volume backup %v: %w", backupID, err)
 	}
 
+	if wait {
+		_, err = b.waitForBackupStatus(backupID, []string{"deleted"}, b.backupTimeout)
+		if err != nil {
+			logWithFields.Error("volume backup wasn't deleted within the time limit")
+			return fmt.Errorf("volume backup %v wasn't deleted within the time limit: %w", backupID, err)
+		}
+	}
+
 	return nil
 }
 
 func (b *BlockStore) deleteImage(imageID string) error {
 	logWithFields := b.log.WithFields(logrus.Fields{
 		"imageID": imageID,
-		"method":  b.config["method"],
+		"method":  "image",
 	})
 	logWithFields.Info("BlockStore.DeleteSnapshot called")
 
+	image, err := images.Get(b.imgClient, imageID).Extract()
+	if err != nil {
+		if _, ok := err.(gophercloud.ErrDefault404); !ok {
+			logWithFields.Error("failed to get volume image")
+			return fmt.Errorf("failed to get volume image %v: %w", imageID, err)
+		}
+		// the image may be copied from another region
+		return b.deleteLocalImageCopies(logWithFields, imageID)
+	}
+
+	// Delete volume image copies in other regions
+	for key, value := range image.Properties {
+		region := strings.TrimPrefix(key, imageCopyPrefix)
+		copyID, ok := value.(string)
+		if region == key || !ok {
+			continue
+		}
+		client, err := b.getImageRegionClient(region)
+		if err != nil {
+			return err
+		}
+		err = b.removeImage(logWithFields.WithField("region", region), client, copyID)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Delete volume image from Glance
-	err := images.Delete(b.imgClient, imageID).ExtractErr()
+	return b.removeImage(logWithFields, b.imgClient, imageID)
+}
+
+// removeImage deletes the image, protected images are unprotected first
+func (b *BlockStore) removeImage(logWithFields *logrus.Entry, client *gophercloud.ServiceClient, imageID string) error {
+	err := images.Delete(client, imageID).ExtractErr()
+	if _, ok := err.(gophercloud.ErrDefault403); ok {
+		logWithFields.Infof("Unprotecting volume image %v", imageID)
+		_, err = images.Update(client, imageID, images.UpdateOpts{
+			images.ReplaceImageProtected{NewProtected: false},
+		}).Extract()
+		if err != nil {
+			logWithFields.Error("failed to unprotect volume image")
+			return fmt.Errorf("failed to unprotect volume image %v: %w", imageID, err)
+		}
+		err = images.Delete(client, imageID).ExtractErr()
+	}
 	if err != nil {
 		if _, ok := err.(gophercloud.ErrDefault404); ok {
-			logWithFields.Info("volume image is already deleted")
+			logWithFields.Infof("volume image %v is already deleted", imageID)
 			return nil
 		}
 		logWithFields.Error("failed to delete volume image")
@@ -853,21 +1814,26 @@ func (b *BlockStore) GetVolumeID(unstructuredPV runtime.Unstructured) (string, e
 		return "", fmt.Errorf("failed to convert from unstructured PV: %w", err)
 	}
 
-	if pv.Spec.Cinder != nil {
-		return pv.Spec.Cinder.VolumeID, nil
+	volumeID := persistentVolumeID(pv)
+	if volumeID == "" && pv.Spec.CSI != nil {
+		b.log.Infof("Unable to handle CSI driver: %s", pv.Spec.CSI.Driver)
 	}
 
-	if pv.Spec.CSI == nil {
-		return "", nil
-	}
+	return volumeID, nil
+}
 
-	if utils.SliceContains(supportedDrivers, pv.Spec.CSI.Driver) {
-		return pv.Spec.CSI.VolumeHandle, nil
+// persistentVolumeID returns the Cinder volume ID of the persistent volume or
+// an empty string, when the persistent volume isn't a Cinder volume
+func persistentVolumeID(pv *v1.PersistentVolume) string {
+	if pv.Spec.Cinder != nil {
+		return pv.Spec.Cinder.VolumeID
 	}
 
-	b.log.Infof("Unable to handle CSI driver: %s", pv.Spec.CSI.Driver)
+	if pv.Spec.CSI != nil && utils.SliceContains(supportedDrivers, pv.Spec.CSI.Driver) {
+		return pv.Spec.CSI.VolumeHandle
+	}
 
-	return "", nil
+	return ""
 }
 
 // SetVolumeID sets the specific identifier for the PersistentVolume.
@@ -891,6 +1857,17 @@ func (b *BlockStore) SetVolumeID(unstructuredPV runtime.Unstructured, volumeID s
 		return nil, fmt.Errorf("persistent volume is missing 'spec.cinder.volumeID' or PV driver ('spec.csi.driver') doesn't match supported drivers (%v)", supportedDrivers)
 	}
 
+	// The restored volume may be created in another availability zone
+	if err := b.setPersistentVolumeZone(logWithFields, pv, volumeID); err != nil {
+		return nil, utils.WithRequestID(err)
+	}
+	if err := b.setPersistentVolumeAccess(logWithFields, pv, volumeID); err != nil {
+		return nil, utils.WithRequestID(err)
+	}
+	if err := b.resizeRestoredVolume(logWithFields, pv, volumeID); err != nil {
+		return nil, utils.WithRequestID(err)
+	}
+
 	res, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pv)
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert to unstructured PV: %w", err)
@@ -911,26 +1888,33 @@ func (b *BlockStore) getCinderMicroversion() (string, error) {
 	return api.Version, nil
 }
 
-func (b *BlockStore) setCinderMicroversion(version string) error {
+// setCinderMicroversion sets the Cinder microversion, which supports the
+// feature. A higher microversion already set by another feature is kept.
+func (b *BlockStore) setCinderMicroversion(version, feature string) error {
 	mv, err := b.getCinderMicroversion()
 	if err != nil {
-		return fmt.Errorf("failed to obtain supported Cinder microversions: %v", err)
+		return utils.WithRequestID(fmt.Errorf("failed to obtain supported Cinder microversions: %w", err))
 	}
 	ok, err := utils.CompareMicroversions("lte", version, mv)
 	if err != nil {
 		return fmt.Errorf("failed to compare supported Cinder microversions: %v", err)
 	}
 	if !ok {
-		return fmt.Errorf("the %v Cinder microversion doesn't support %ss", mv, b.config["method"])
+		return fmt.Errorf("the %v Cinder microversion doesn't support %s", mv, feature)
 	}
 
+	if b.client.Microversion != "" {
+		if ok, _ = utils.CompareMicroversions("lte", version, b.client.Microversion); ok {
+			return nil
+		}
+	}
 	b.client.Microversion = version
 
 	return nil
 }
 
 func (b *BlockStore) waitForVolumeStatus(id string, statuses []string, secs int) (current *volumes.Volume, err error) {
-	return current, utils.WaitForStatus(statuses, secs, func() (string, error) {
+	return current, utils.WaitForStatus(statuses, secs, b.pollInterval, func() (string, error) {
 		current, err = volumes.Get(b.client, id).Extract()
 		if err != nil {
 			return "", err
@@ -940,7 +1924,7 @@ func (b *BlockStore) waitForVolumeStatus(id string, statuses []string, secs int)
 }
 
 func (b *BlockStore) waitForSnapshotStatus(id string, statuses []string, secs int) (current *snapshots.Snapshot, err error) {
-	return current, utils.WaitForStatus(statuses, secs, func() (string, error) {
+	return current, utils.WaitForStatus(statuses, secs, b.pollInterval, func() (string, error) {
 		current, err = snapshots.Get(b.client, id).Extract()
 		if err != nil {
 			return "", err
@@ -950,7 +1934,7 @@ func (b *BlockStore) waitForSnapshotStatus(id string, statuses []string, secs in
 }
 
 func (b *BlockStore) waitForBackupStatus(id string, statuses []string, secs int) (current *backups.Backup, err error) {
-	return current, utils.WaitForStatus(statuses, secs, func() (string, error) {
+	return current, utils.WaitForStatus(statuses, secs, b.pollInterval, func() (string, error) {
 		current, err = backups.Get(b.client, id).Extract()
 		if err != nil {
 			return "", err
@@ -960,7 +1944,7 @@ func (b *BlockStore) waitForBackupStatus(id string, statuses []string, secs int)
 }
 
 func (b *BlockStore) waitForImageStatus(id string, statuses []string, secs int) (current *images.Image, err error) {
-	return current, utils.WaitForStatus(statuses, secs, func() (string, error) {
+	return current, utils.WaitForStatus(statuses, secs, b.pollInterval, func() (string, error) {
 		current, err = images.Get(b.imgClient, id).Extract()
 		if err != nil {
 			return "", err
@@ -1059,6 +2043,39 @@ func (b *BlockStore) ensureBackupDeleted(logWithFields *logrus.Entry, id string,
 	return utils.EnsureDeleted(deleteFunc, checkFunc, resetFunc, secs, b.ensureDeletedDelay)
 }
 
+// imageMetadataProperties returns image properties, which keep the Velero
+// tags and the original volume metadata
+func imageMetadataProperties(volume *volumes.Volume, tags map[string]string) images.UpdateOpts {
+	var opts images.UpdateOpts
+	add := func(prefix string, m map[string]string) {
+		for key, value := range m {
+			opts = append(opts, images.UpdateImageProperty{
+				Op: images.AddOp,
+				// JSON pointer escaping of keys like "velero.io/backup"
+				Name:  jsonPointerEscaper.Replace(prefix + key),
+				Value: value,
+			})
+		}
+	}
+	add(imageTagPrefix, tags)
+	add(imageVolumeMetadataPrefix, volume.Metadata)
+	return opts
+}
+
+// imageVolumeMetadata returns the original volume metadata kept in the image
+// properties
+func imageVolumeMetadata(image *images.Image) map[string]string {
+	metadata := make(map[string]string)
+	for key, value := range image.Properties {
+		if k := strings.TrimPrefix(key, imageVolumeMetadataPrefix); k != key {
+			if v, ok := value.(string); ok {
+				metadata[k] = v
+			}
+		}
+	}
+	return metadata
+}
+
 func expandVolumeProperties(log logrus.FieldLogger, volume *volumes.Volume) images.UpdateOpts {
 	// set min_disk and min_ram from a source volume
 	imgAttrUpdateOpts := images.UpdateOpts{
@@ -1072,7 +2089,7 @@ func expandVolumeProperties(log logrus.FieldLogger, volume *volumes.Volume) imag
 		}
 	}
 	for key, value := range volume.VolumeImageMetadata {
-		if utils.SliceContains(skipVolumeAttributes, key) || value == "" {
+		if utils.SliceContains(skipVolumeAttributes, key) || strings.HasPrefix(key, glanceReservedPrefix) || value == "" {
 			continue
 		}
 		imgAttrUpdateOpts = append(imgAttrUpdateOpts, images.UpdateImageProperty{
@@ -0,0 +1,1395 @@
+package cinder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/fakeopenstack"
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	velerofake "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned/fake"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+var testTags = map[string]string{
+	utils.BackupTag: "test-backup",
+	utils.PVTag:     "test-pv",
+}
+
+// backupTags returns the test tags of another Velero backup
+func backupTags(backup string) map[string]string {
+	return utils.Merge(testTags, map[string]string{utils.BackupTag: backup})
+}
+
+// newTestBlockStore initializes a BlockStore against the fake cloud
+func newTestBlockStore(t *testing.T, config map[string]string) *BlockStore {
+	b := NewBlockStore(logrus.New())
+	err := b.Init(utils.Merge(map[string]string{
+		"ensureDeletedDelay": "0s",
+		"volumeTimeout":      "30s",
+		"pollInterval":       fakeopenstack.PollInterval,
+	}, config))
+	require.Nil(t, err)
+	return b
+}
+
+// withoutOwnership returns the resource metadata without the ownership
+// metadata, which differs for every resource
+func withoutOwnership(metadata interface{}) map[string]interface{} {
+	res := map[string]interface{}{}
+	for k, v := range metadata.(map[string]interface{}) {
+		switch k {
+		case utils.VersionKey, utils.MethodKey, utils.CreatedAtKey, utils.SourceKey:
+		default:
+			res[k] = v
+		}
+	}
+	return res
+}
+
+func TestSnapshotMethod(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.VolumeTypes = []string{"ssd"}
+	b := newTestBlockStore(t, nil)
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{
+		"size":        10,
+		"volume_type": "ssd",
+		"metadata":    map[string]string{"app": "db"},
+	})
+
+	snapshotID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	snapshot := srv.Get(fakeopenstack.VolumeSnapshots, snapshotID)
+	assert.Equal(t, "available", snapshot["status"])
+	assert.Equal(t, volumeID, snapshot["volume_id"])
+	assert.Equal(t, map[string]interface{}{
+		"app":           "db",
+		utils.BackupTag: "test-backup",
+		utils.PVTag:     "test-pv",
+	}, withoutOwnership(snapshot["metadata"]))
+
+	newVolumeID, err := b.CreateVolumeFromSnapshot(snapshotID, "ssd", "nova", nil)
+	require.Nil(t, err)
+	volume := srv.Get(fakeopenstack.Volumes, newVolumeID)
+	assert.Equal(t, "available", volume["status"])
+	assert.Equal(t, snapshotID, volume["snapshot_id"])
+	assert.Equal(t, 10, volume["size"])
+	assert.Equal(t, map[string]interface{}{
+		"app":           "db",
+		utils.BackupTag: "test-backup",
+		utils.PVTag:     "test-pv",
+	}, withoutOwnership(volume["metadata"]))
+
+	volumeType, _, err := b.GetVolumeInfo(newVolumeID, "nova")
+	assert.Nil(t, err)
+	assert.Equal(t, "ssd", volumeType)
+	ready, err := b.IsVolumeReady(newVolumeID, "nova")
+	assert.Nil(t, err)
+	assert.True(t, ready)
+
+	// snapshots with dependent volumes can be deleted
+	assert.Nil(t, b.DeleteSnapshot(snapshotID))
+	assert.Equal(t, "deleting", srv.Get(fakeopenstack.VolumeSnapshots, snapshotID)["status"])
+	// deletion of a missing snapshot succeeds
+	assert.Nil(t, b.DeleteSnapshot("missing"))
+}
+
+func TestCloneMethod(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	b := newTestBlockStore(t, map[string]string{
+		"method":        "clone",
+		"ensureDeleted": "true",
+		"cascadeDelete": "true",
+	})
+	srv.VolumeTypes = []string{"ssd"}
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{
+		"size":        5,
+		"volume_type": "ssd",
+	})
+
+	cloneID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	clone := srv.Get(fakeopenstack.Volumes, cloneID)
+	assert.Equal(t, "available", clone["status"])
+	assert.Equal(t, volumeID, clone["source_volid"])
+	assert.Equal(t, "ssd", clone["volume_type"])
+	assert.Equal(t, "test-backup", clone["metadata"].(map[string]interface{})[utils.BackupTag])
+
+	// a clone snapshot created by a third party must be removed first
+	srv.Add(fakeopenstack.VolumeSnapshots, map[string]interface{}{
+		"volume_id": cloneID,
+	})
+	assert.Nil(t, b.DeleteSnapshot(cloneID))
+	assert.Nil(t, srv.Get(fakeopenstack.Volumes, cloneID))
+	assert.Empty(t, srv.List(fakeopenstack.VolumeSnapshots, map[string]string{"volume_id": cloneID}))
+	assert.NotNil(t, srv.Get(fakeopenstack.Volumes, volumeID))
+}
+
+func TestBackupMethod(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	b := newTestBlockStore(t, map[string]string{
+		"method":        "backup",
+		"ensureDeleted": "true",
+	})
+	assert.Equal(t, volumeBackupMicroversion, b.client.Microversion)
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{
+		"status":   "in-use",
+		"size":     20,
+		"metadata": map[string]string{"app": "db"},
+	})
+
+	backupID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	backup := srv.Get(fakeopenstack.Backups, backupID)
+	assert.Equal(t, "available", backup["status"])
+	assert.Equal(t, volumeID, backup["volume_id"])
+	assert.Equal(t, "test-pv", backup["metadata"].(map[string]interface{})[utils.PVTag])
+
+	newVolumeID, err := b.CreateVolumeFromSnapshot(backupID, "", "nova", nil)
+	require.Nil(t, err)
+	volume := srv.Get(fakeopenstack.Volumes, newVolumeID)
+	assert.Equal(t, backupID, volume["backup_id"])
+	assert.Equal(t, 20, volume["size"])
+	assert.Equal(t, "db", volume["metadata"].(map[string]interface{})["app"])
+
+	// the backup deletion fails once and the backup status is reset
+	assert.Nil(t, srv.FailDelete(fakeopenstack.Backups, backupID, 1))
+	assert.Nil(t, b.DeleteSnapshot(backupID))
+	assert.Nil(t, srv.Get(fakeopenstack.Backups, backupID))
+	assert.Equal(t, 2, srv.CountCalls("DELETE", "/backups/"+backupID))
+	assert.Equal(t, 1, srv.CountCalls("POST", "/backups/"+backupID+"/action"))
+}
+
+func TestBackupFromSnapshot(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	b := newTestBlockStore(t, map[string]string{
+		"method":             "backup",
+		"backupFromSnapshot": "true",
+		"ensureDeleted":      "true",
+	})
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{"status": "in-use"})
+
+	backupID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	backup := srv.Get(fakeopenstack.Backups, backupID)
+	assert.Equal(t, "available", backup["status"])
+	assert.NotEmpty(t, backup["snapshot_id"])
+	// the intermediate snapshot is removed
+	assert.Nil(t, srv.Get(fakeopenstack.VolumeSnapshots, backup["snapshot_id"].(string)))
+	assert.Equal(t, 1, srv.CountCalls("POST", "/snapshots"))
+
+	// the intermediate snapshot of a pending backup is kept and deleted
+	// together with the backup
+	backupTimeout := b.backupTimeout
+	b.backupTimeout = 0
+	volumeID = srv.Add(fakeopenstack.Volumes, map[string]interface{}{"status": "in-use"})
+	backupID, err = b.CreateSnapshot(volumeID, "nova", testTags)
+	assert.ErrorContains(t, err, "didn't get into 'available' state")
+	b.backupTimeout = backupTimeout
+	backup = srv.Get(fakeopenstack.Backups, backupID)
+	snapshotID := backup["snapshot_id"].(string)
+	assert.NotNil(t, srv.Get(fakeopenstack.VolumeSnapshots, snapshotID))
+	assert.Equal(t, snapshotID, backup["metadata"].(map[string]interface{})[backupSnapshotKey])
+	require.Nil(t, b.DeleteSnapshot(backupID))
+	assert.Nil(t, srv.Get(fakeopenstack.Backups, backupID))
+	assert.Nil(t, srv.Get(fakeopenstack.VolumeSnapshots, snapshotID))
+}
+
+func TestBackupContainerAndAZ(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.VolumeAvailabilityZones = []string{"nova", "zone-b"}
+	b := newTestBlockStore(t, map[string]string{
+		"method":                 "backup",
+		"backupContainer":        "velero-{{.PV}}",
+		"backupDescription":      "Velero backup {{.Backup}} of {{.VolumeID}}",
+		"backupAvailabilityZone": "zone-b",
+	})
+	assert.Equal(t, volumeBackupAZMicroversion, b.client.Microversion)
+	volumeID := srv.Add(fakeopenstack.Volumes, nil)
+
+	backupID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	backup := srv.Get(fakeopenstack.Backups, backupID)
+	assert.Equal(t, "velero-test-pv", backup["container"])
+	assert.Equal(t, "Velero backup test-backup of "+volumeID, backup["description"])
+	assert.Equal(t, "zone-b", backup["availability_zone"])
+
+	// the backup availability zone doesn't exist
+	b.backupAZ = "zone-c"
+	_, err = b.CreateSnapshot(volumeID, "nova", testTags)
+	assert.ErrorContains(t, err, `backup availability zone "zone-c" doesn't exist`)
+
+	// the backup container name is invalid
+	b.backupAZ = ""
+	b.backupContainer = template.Must(template.New("").Parse("{{.PV}}/{{.Backup}}"))
+	_, err = b.CreateSnapshot(volumeID, "nova", testTags)
+	assert.ErrorContains(t, err, `invalid "test-pv/test-backup" backup container name`)
+}
+
+func TestBackupTemplateNotValid(t *testing.T) {
+	fakeopenstack.NewTestServer(t)
+	b := NewBlockStore(logrus.New())
+	err := b.Init(map[string]string{
+		"method":          "backup",
+		"backupContainer": "{{.PV",
+	})
+	assert.ErrorContains(t, err, "cannot parse backupContainer config variable")
+}
+
+func TestBackupRecord(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.AddContainer("velero")
+	b := newTestBlockStore(t, map[string]string{
+		"method":                "backup",
+		"backupRecordContainer": "velero",
+	})
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{"size": 3})
+
+	backupID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	_, ok := srv.GetObject("velero", "cinder-backup-records/"+backupID+".json")
+	assert.True(t, ok)
+
+	// the backup is imported, when it doesn't exist in the cloud
+	srv.Delete(fakeopenstack.Backups, backupID)
+	newVolumeID, err := b.CreateVolumeFromSnapshot(backupID, "", "nova", nil)
+	require.Nil(t, err)
+	assert.Equal(t, 1, srv.CountCalls("POST", "/backups/import_record"))
+	assert.Equal(t, "available", srv.Get(fakeopenstack.Backups, backupID)["status"])
+	assert.Equal(t, backupID, srv.Get(fakeopenstack.Volumes, newVolumeID)["backup_id"])
+
+	// the existing backup isn't imported
+	_, err = b.CreateVolumeFromSnapshot(backupID, "", "nova", nil)
+	require.Nil(t, err)
+	assert.Equal(t, 1, srv.CountCalls("POST", "/backups/import_record"))
+
+	assert.Nil(t, b.DeleteSnapshot(backupID))
+	_, ok = srv.GetObject("velero", "cinder-backup-records/"+backupID+".json")
+	assert.False(t, ok)
+}
+
+func TestIncrementalBackupRecord(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.AddContainer("velero")
+	b := newTestBlockStore(t, map[string]string{
+		"method":                "backup",
+		"incrementalBackup":     "true",
+		"backupRecordContainer": "velero",
+	})
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{"size": 2})
+
+	var chain []string
+	for _, backup := range []string{"test-backup", "test-backup-2", "test-backup-3"} {
+		backupID, err := b.CreateSnapshot(volumeID, "nova", backupTags(backup))
+		require.Nil(t, err)
+		chain = append(chain, backupID)
+	}
+	assert.Equal(t, chain[1], srv.Get(fakeopenstack.Backups, chain[2])["parent_id"])
+
+	// the parent backups are imported before the incremental backup
+	for _, backupID := range chain {
+		srv.Delete(fakeopenstack.Backups, backupID)
+	}
+	newVolumeID, err := b.CreateVolumeFromSnapshot(chain[2], "", "nova", nil)
+	require.Nil(t, err)
+	assert.Equal(t, 3, srv.CountCalls("POST", "/backups/import_record"))
+	for _, backupID := range chain[:2] {
+		assert.Equal(t, "available", srv.Get(fakeopenstack.Backups, backupID)["status"])
+	}
+	assert.Equal(t, chain[1], srv.Get(fakeopenstack.Backups, chain[2])["parent_id"])
+	assert.Equal(t, chain[2], srv.Get(fakeopenstack.Volumes, newVolumeID)["backup_id"])
+
+	// only the missing parent backups are imported
+	srv.Delete(fakeopenstack.Volumes, newVolumeID)
+	srv.Delete(fakeopenstack.Backups, chain[2])
+	_, err = b.CreateVolumeFromSnapshot(chain[2], "", "nova", nil)
+	require.Nil(t, err)
+	assert.Equal(t, 4, srv.CountCalls("POST", "/backups/import_record"))
+}
+
+func TestIncrementalBackup(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	b := newTestBlockStore(t, map[string]string{
+		"method":            "backup",
+		"incrementalBackup": "true",
+	})
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{"size": 2})
+
+	fullID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	full := srv.Get(fakeopenstack.Backups, fullID)
+	assert.Equal(t, false, full["is_incremental"])
+
+	incrementalID, err := b.CreateSnapshot(volumeID, "nova", backupTags("test-backup-2"))
+	require.Nil(t, err)
+	incremental := srv.Get(fakeopenstack.Backups, incrementalID)
+	assert.Equal(t, true, incremental["is_incremental"])
+	assert.Equal(t, fullID, incremental["parent_id"])
+	assert.Equal(t, full["container"], incremental["container"])
+	assert.Equal(t, fullID, incremental["metadata"].(map[string]interface{})[parentBackupKey])
+
+	// the parent backup deletion is postponed until its dependent backup is deleted
+	assert.Nil(t, b.DeleteSnapshot(fullID))
+	full = srv.Get(fakeopenstack.Backups, fullID)
+	assert.Equal(t, "available", full["status"])
+	assert.Equal(t, "true", full["metadata"].(map[string]interface{})[deletePendingKey])
+	assert.Nil(t, b.DeleteSnapshot(incrementalID))
+	assert.Nil(t, srv.Get(fakeopenstack.Backups, incrementalID))
+	assert.Equal(t, "deleting", srv.Get(fakeopenstack.Backups, fullID)["status"])
+}
+
+func TestIncrementalBackupFullBackup(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	b := newTestBlockStore(t, map[string]string{
+		"method":             "backup",
+		"incrementalBackup":  "true",
+		"fullBackupInterval": "24h",
+	})
+	volumeID := srv.Add(fakeopenstack.Volumes, nil)
+
+	// the latest backup wasn't created for the same persistent volume
+	srv.Add(fakeopenstack.Backups, map[string]interface{}{
+		"volume_id": volumeID,
+		"metadata":  map[string]string{utils.PVTag: "another-pv"},
+	})
+	backupID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	assert.Equal(t, false, srv.Get(fakeopenstack.Backups, backupID)["is_incremental"])
+
+	// the full backup is older than the full backup interval
+	assert.Nil(t, srv.Update(fakeopenstack.Backups, backupID, map[string]interface{}{
+		"created_at": time.Now().Add(-25 * time.Hour).UTC().Format("2006-01-02T15:04:05.000000"),
+	}))
+	backupID, err = b.CreateSnapshot(volumeID, "nova", backupTags("test-backup-2"))
+	require.Nil(t, err)
+	assert.Equal(t, false, srv.Get(fakeopenstack.Backups, backupID)["is_incremental"])
+
+	backupID, err = b.CreateSnapshot(volumeID, "nova", backupTags("test-backup-3"))
+	require.Nil(t, err)
+	assert.Equal(t, true, srv.Get(fakeopenstack.Backups, backupID)["is_incremental"])
+}
+
+func TestBackupMicroversionNotSupported(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.VolumeMicroversion = "3.40"
+
+	b := NewBlockStore(logrus.New())
+	err := b.Init(map[string]string{"method": "backup"})
+	assert.ErrorContains(t, err, "the 3.40 Cinder microversion doesn't support backups")
+}
+
+func TestImageMethod(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	b := newTestBlockStore(t, map[string]string{"method": "image"})
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{
+		"size":     3,
+		"metadata": map[string]string{"app": "db", "example.com/tier": "gold"},
+		"volume_image_metadata": map[string]string{
+			"container_format": "bare",
+			"disk_format":      "qcow2",
+			"min_ram":          "512",
+			"hw_disk_bus":      "scsi",
+			"checksum":         "skipped",
+		},
+	})
+
+	imageID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	image := srv.Get(fakeopenstack.Images, imageID)
+	assert.Equal(t, "active", image["status"])
+	assert.Equal(t, "qcow2", image["disk_format"])
+	assert.EqualValues(t, 3, image["min_disk"])
+	assert.EqualValues(t, 512, image["min_ram"])
+	assert.Equal(t, "scsi", image["hw_disk_bus"])
+	assert.NotContains(t, image, "checksum")
+	// tags and volume metadata are kept in namespaced image properties
+	assert.Equal(t, "test-backup", image[imageTagPrefix+utils.BackupTag])
+	assert.Equal(t, "test-pv", image[imageTagPrefix+utils.PVTag])
+	assert.Equal(t, "db", image[imageVolumeMetadataPrefix+"app"])
+	assert.Equal(t, "gold", image[imageVolumeMetadataPrefix+"example.com/tier"])
+
+	newVolumeID, err := b.CreateVolumeFromSnapshot(imageID, "", "nova", nil)
+	require.Nil(t, err)
+	volume := srv.Get(fakeopenstack.Volumes, newVolumeID)
+	assert.Equal(t, "available", volume["status"])
+	assert.Equal(t, 3, volume["size"])
+	assert.Equal(t, map[string]interface{}{
+		"app":              "db",
+		"example.com/tier": "gold",
+		utils.BackupTag:    "test-backup",
+		utils.PVTag:        "test-pv",
+	}, withoutOwnership(volume["metadata"]))
+
+	assert.Nil(t, b.DeleteSnapshot(imageID))
+	assert.Nil(t, srv.Get(fakeopenstack.Images, imageID))
+}
+
+func TestImageMethodOptions(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.ImageStores = []string{"file", "ceph"}
+	b := newTestBlockStore(t, map[string]string{
+		"method":           "image",
+		"imageDiskFormat":  "qcow2",
+		"imageCompression": "true",
+		"imageVisibility":  "shared",
+		"imageProtected":   "true",
+		"imageStore":       "ceph",
+	})
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{"size": 1})
+
+	// compression is disabled in Cinder
+	imageID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	image := srv.Get(fakeopenstack.Images, imageID)
+	assert.Equal(t, "qcow2", image["disk_format"])
+	assert.Nil(t, image["container_format"])
+	assert.Equal(t, "shared", image["visibility"])
+	assert.Equal(t, true, image["protected"])
+	assert.Equal(t, "ceph", image["stores"])
+	assert.Equal(t, 2, srv.CountCalls("POST", "/volumes/"+volumeID+"/action"))
+
+	// protected images are unprotected before the deletion
+	assert.Nil(t, b.DeleteSnapshot(imageID))
+	assert.Nil(t, srv.Get(fakeopenstack.Images, imageID))
+
+	srv.ImageCompression = true
+	imageID, err = b.CreateSnapshot(volumeID, "nova", backupTags("test-backup-2"))
+	require.Nil(t, err)
+	assert.Equal(t, "compressed", srv.Get(fakeopenstack.Images, imageID)["container_format"])
+
+	// Glance multiple stores are required
+	srv.ImageStores = nil
+	_, err = b.CreateSnapshot(volumeID, "nova", backupTags("test-backup-3"))
+	assert.ErrorContains(t, err, "Glance multiple stores are not enabled")
+}
+
+func TestImageCopy(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.ImageStores = []string{"file", "backup"}
+	srv.ImageRegions = []string{"RegionTwo"}
+	config := map[string]string{
+		"method":           "image",
+		"imageProtected":   "true",
+		"imageCopyStores":  "backup",
+		"imageCopyRegions": "RegionTwo",
+	}
+	b := newTestBlockStore(t, config)
+	keyID := srv.Add(fakeopenstack.Secrets, nil)
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{
+		"size":              1,
+		"metadata":          map[string]string{"app": "db"},
+		"encrypted":         true,
+		"encryption_key_id": keyID,
+	})
+	regionTwo := fakeopenstack.ImagesIn("RegionTwo")
+
+	imageID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	image := srv.Get(fakeopenstack.Images, imageID)
+	assert.Equal(t, "file,backup", image["stores"])
+	copyID, _ := image[imageCopyPrefix+"RegionTwo"].(string)
+	require.NotEmpty(t, copyID)
+	imageCopy := srv.Get(regionTwo, copyID)
+	assert.Equal(t, "active", imageCopy["status"])
+	assert.Equal(t, true, imageCopy["protected"])
+	assert.Equal(t, imageID, imageCopy[imageSourceKey])
+	assert.Equal(t, fakeopenstack.Region, imageCopy[imageSourceRegionKey])
+	assert.Equal(t, "test-backup", imageCopy[imageTagPrefix+utils.BackupTag])
+	assert.Equal(t, "db", imageCopy[imageVolumeMetadataPrefix+"app"])
+
+	// properties reserved by Glance and bound to the source region aren't copied
+	assert.Contains(t, image, "os_glance_failed_import")
+	assert.NotEmpty(t, image["cinder_encryption_key_id"])
+	for key := range imageCopy {
+		assert.False(t, strings.HasPrefix(key, glanceReservedPrefix), key)
+	}
+	assert.NotContains(t, imageCopy, "cinder_encryption_key_id")
+	assert.NotContains(t, imageCopy, "cinder_encryption_key_deletion_policy")
+
+	// a plugin in the second region restores and deletes the image copy
+	b2 := newTestBlockStore(t, config)
+	b2.imgClient, err = b.getImageRegionClient("RegionTwo")
+	require.Nil(t, err)
+	b2.region = "RegionTwo"
+	foundID, err := b2.findImage(b2.log.WithField("test", t.Name()), imageID)
+	assert.Nil(t, err)
+	assert.Equal(t, copyID, foundID)
+	assert.Nil(t, b2.DeleteSnapshot(imageID))
+	assert.Nil(t, srv.Get(regionTwo, copyID))
+	assert.NotNil(t, srv.Get(fakeopenstack.Images, imageID))
+	_, err = b2.findImage(b2.log.WithField("test", t.Name()), imageID)
+	assert.ErrorContains(t, err, "nor its copy exist")
+
+	// the image is deleted together with its copies
+	imageID, err = b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	copyID = srv.Get(fakeopenstack.Images, imageID)[imageCopyPrefix+"RegionTwo"].(string)
+	assert.Nil(t, b.DeleteSnapshot(imageID))
+	assert.Nil(t, srv.Get(fakeopenstack.Images, imageID))
+	assert.Nil(t, srv.Get(regionTwo, copyID))
+}
+
+func TestImageMethodConfigNotValid(t *testing.T) {
+	fakeopenstack.NewTestServer(t)
+	b := NewBlockStore(logrus.New())
+	err := b.Init(map[string]string{"method": "image", "imageDiskFormat": "iso"})
+	assert.ErrorContains(t, err, `unsupported "iso" image disk format`)
+
+	err = b.Init(map[string]string{"method": "image", "imageVisibility": "everyone"})
+	assert.ErrorContains(t, err, `unsupported "everyone" image visibility`)
+}
+
+// newTestPV returns a CSI persistent volume
+func newTestPV(volumeID, namespace string, labels map[string]string) v1.PersistentVolume {
+	return v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "pv-" + volumeID,
+			Labels: labels,
+		},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{
+					Driver:       "cinder.csi.openstack.org",
+					VolumeHandle: volumeID,
+				},
+			},
+			ClaimRef: &v1.ObjectReference{Namespace: namespace},
+		},
+	}
+}
+
+func TestGroupSnapshot(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.VolumeTypes = []string{"ssd", "hdd"}
+	b := newTestBlockStore(t, map[string]string{
+		"volumeGroupKey":  "example.com/volume-group",
+		"volumeGroupType": "default",
+	})
+	ok, err := utils.CompareMicroversions("lte", groupSnapshotMicroversion, b.client.Microversion)
+	require.Nil(t, err)
+	assert.True(t, ok)
+	b.veleroClient = velerofake.NewSimpleClientset(&velerov1.Backup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "test-backup", UID: "test-uid"},
+	})
+	labels := map[string]string{"example.com/volume-group": "postgres"}
+	dataID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{"volume_type": "ssd"})
+	walID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{"volume_type": "hdd"})
+	otherID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{"volume_type": "ssd"})
+	pvs := []v1.PersistentVolume{newTestPV(dataID, "db", labels), newTestPV(walID, "db", labels), newTestPV(otherID, "db", nil)}
+	b.kubeClient = k8sfake.NewSimpleClientset(&pvs[0], &pvs[1], &pvs[2])
+	pvTags := func(volumeID string) map[string]string {
+		return utils.Merge(testTags, map[string]string{utils.PVTag: "pv-" + volumeID})
+	}
+
+	// GetVolumeID doesn't change the volume groups
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&pvs[0])
+	require.Nil(t, err)
+	id, err := b.GetVolumeID(&unstructured.Unstructured{Object: obj})
+	require.Nil(t, err)
+	assert.Equal(t, dataID, id)
+	assert.Empty(t, srv.List(fakeopenstack.Groups, nil))
+
+	// both volumes are snapshotted by a single group snapshot and leave the
+	// group as soon as the group snapshot is taken
+	dataSnapshotID, err := b.CreateSnapshot(dataID, "nova", pvTags(dataID))
+	require.Nil(t, err)
+	assert.Empty(t, srv.Get(fakeopenstack.Volumes, dataID)["group_id"])
+	assert.Empty(t, srv.Get(fakeopenstack.Volumes, walID)["group_id"])
+	walSnapshotID, err := b.CreateSnapshot(walID, "nova", pvTags(walID))
+	require.Nil(t, err)
+	dataSnapshot := srv.Get(fakeopenstack.VolumeSnapshots, dataSnapshotID)
+	walSnapshot := srv.Get(fakeopenstack.VolumeSnapshots, walSnapshotID)
+	assert.Equal(t, dataID, dataSnapshot["volume_id"])
+	assert.Equal(t, walID, walSnapshot["volume_id"])
+	assert.NotEmpty(t, dataSnapshot["group_snapshot_id"])
+	assert.Equal(t, dataSnapshot["group_snapshot_id"], walSnapshot["group_snapshot_id"])
+	assert.Equal(t, testTags[utils.BackupTag], walSnapshot["metadata"].(map[string]interface{})[utils.BackupTag])
+	assert.Equal(t, 1, srv.CountCalls("POST", "/group_snapshots"))
+	groupSnapshotID := dataSnapshot["group_snapshot_id"].(string)
+	groupSnapshot := srv.Get(fakeopenstack.GroupSnapshots, groupSnapshotID)
+	assert.Equal(t, "velero-db-postgres.group.test-uid", groupSnapshot["name"])
+	groupID := groupSnapshot["group_id"].(string)
+	assert.ElementsMatch(t, []interface{}{"ssd", "hdd"}, srv.Get(fakeopenstack.Groups, groupID)["volume_types"])
+
+	// volumes without the label are snapshotted individually
+	otherSnapshotID, err := b.CreateSnapshot(otherID, "nova", pvTags(otherID))
+	require.Nil(t, err)
+	assert.Empty(t, srv.Get(fakeopenstack.VolumeSnapshots, otherSnapshotID)["group_snapshot_id"])
+
+	// the group snapshot and the group are deleted together with the last member
+	assert.Nil(t, b.DeleteSnapshot(dataSnapshotID))
+	assert.Equal(t, "available", srv.Get(fakeopenstack.GroupSnapshots, groupSnapshotID)["status"])
+	assert.Nil(t, b.DeleteSnapshot(walSnapshotID))
+	assert.Nil(t, srv.Get(fakeopenstack.GroupSnapshots, groupSnapshotID))
+	assert.Equal(t, "deleting", srv.Get(fakeopenstack.VolumeSnapshots, walSnapshotID)["status"])
+	assert.Equal(t, "deleting", srv.Get(fakeopenstack.Groups, groupID)["status"])
+}
+
+func TestGroupSnapshotFailure(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	b := newTestBlockStore(t, map[string]string{
+		"volumeGroupKey":  "example.com/volume-group",
+		"volumeGroupType": "default",
+	})
+	b.veleroClient = velerofake.NewSimpleClientset(&velerov1.Backup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "test-backup", UID: "test-uid"},
+	})
+	labels := map[string]string{"example.com/volume-group": "postgres"}
+	dataID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{"volume_type": "ssd"})
+	otherID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{"volume_type": "ssd", "availability_zone": "nova2"})
+	pvs := []v1.PersistentVolume{newTestPV(dataID, "db", labels), newTestPV(otherID, "db", labels)}
+	b.kubeClient = k8sfake.NewSimpleClientset(&pvs[0], &pvs[1])
+	tags := utils.Merge(testTags, map[string]string{utils.PVTag: "pv-" + dataID})
+
+	// volumes of different availability zones cannot be grouped
+	_, err := b.CreateSnapshot(dataID, "nova", tags)
+	assert.ErrorContains(t, err, "different availability zones")
+	assert.Empty(t, srv.List(fakeopenstack.Groups, nil))
+
+	// the group is deleted, when the group snapshot cannot be created
+	err = b.kubeClient.CoreV1().PersistentVolumes().Delete(context.Background(), pvs[1].Name, metav1.DeleteOptions{})
+	require.Nil(t, err)
+	srv.Fail("POST", "/group_snapshots", 400, 1)
+	_, err = b.CreateSnapshot(dataID, "nova", tags)
+	assert.ErrorContains(t, err, "failed to create group snapshot")
+	assert.Empty(t, srv.Get(fakeopenstack.Volumes, dataID)["group_id"])
+	groups := srv.List(fakeopenstack.Groups, nil)
+	require.Len(t, groups, 1)
+	assert.Equal(t, "deleting", groups[0]["status"])
+
+	// an unknown backup UID snapshots the volume individually
+	b.veleroClient = velerofake.NewSimpleClientset()
+	snapshotID, err := b.CreateSnapshot(dataID, "nova", tags)
+	require.Nil(t, err)
+	assert.Empty(t, srv.Get(fakeopenstack.VolumeSnapshots, snapshotID)["group_snapshot_id"])
+}
+
+func TestGroupSnapshotConfigNotValid(t *testing.T) {
+	fakeopenstack.NewTestServer(t)
+	b := NewBlockStore(logrus.New())
+	err := b.Init(map[string]string{
+		"method":          "clone",
+		"volumeGroupKey":  "example.com/volume-group",
+		"volumeGroupType": "default",
+	})
+	assert.ErrorContains(t, err, "volumeGroupKey config option is supported only by the snapshot method")
+
+	err = b.Init(map[string]string{"volumeGroupKey": "example.com/volume-group"})
+	assert.ErrorContains(t, err, "volumeGroupType config variable is required")
+}
+
+func TestVolumeTypeMapping(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.VolumeTypes = []string{"fast", "standard"}
+	b := newTestBlockStore(t, map[string]string{
+		"volumeTypeMapping":          "ssd:fast, nvme:missing",
+		"volumeTypeMappingConfigMap": "velero/cinder-volume-types",
+		"defaultVolumeType":          "standard",
+	})
+	b.kubeClient = k8sfake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "cinder-volume-types"},
+		Data:       map[string]string{"hdd": "fast"},
+	})
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{"volume_type": "ssd"})
+	snapshotID := srv.Add(fakeopenstack.VolumeSnapshots, map[string]interface{}{"volume_id": volumeID})
+
+	newVolumeID, err := b.CreateVolumeFromSnapshot(snapshotID, "ssd", "nova", nil)
+	require.Nil(t, err)
+	assert.Equal(t, "fast", srv.Get(fakeopenstack.Volumes, newVolumeID)["volume_type"])
+
+	for volumeType, expected := range map[string]string{
+		"hdd":      "fast",
+		"standard": "standard",
+		"nvme":     "standard",
+		"unknown":  "standard",
+		"":         "standard",
+	} {
+		newVolumeType, err := b.resolveVolumeType(volumeType)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, newVolumeType, volumeType)
+	}
+
+	b.defaultVolumeType = ""
+	newVolumeType, err := b.resolveVolumeType("")
+	assert.Nil(t, err)
+	assert.Empty(t, newVolumeType)
+	_, err = b.resolveVolumeType("unknown")
+	assert.ErrorContains(t, err, `"unknown" volume type doesn't exist`)
+
+	b.volumeTypeMappingConfigMap = "missing"
+	_, err = b.resolveVolumeType("ssd")
+	assert.ErrorContains(t, err, "failed to get velero/missing ConfigMap")
+}
+
+func TestAvailabilityZoneMapping(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.VolumeAvailabilityZones = []string{"nova", "zone-a", "zone-b"}
+	b := newTestBlockStore(t, map[string]string{
+		"availabilityZoneMapping":   "az1:zone-a,az2:zone-c",
+		"availabilityZoneFromNodes": "true",
+		"availabilityZoneFallback":  "true",
+	})
+	newNode := func(name string, labels map[string]string, unschedulable bool) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			Spec:       v1.NodeSpec{Unschedulable: unschedulable},
+		}
+	}
+	b.kubeClient = k8sfake.NewSimpleClientset(
+		newNode("node-1", map[string]string{cinderZoneKey: "zone-a"}, false),
+		newNode("node-2", map[string]string{v1.LabelTopologyZone: "zone-b"}, false),
+		newNode("node-3", map[string]string{v1.LabelTopologyZone: "zone-b"}, false),
+		newNode("node-4", map[string]string{v1.LabelTopologyZone: "zone-c"}, true),
+	)
+
+	for volumeAZ, expected := range map[string]string{
+		"az1":    "zone-a",
+		"zone-a": "zone-a",
+		"az2":    "zone-b",
+		"nova":   "zone-b",
+	} {
+		newVolumeAZ, err := b.resolveVolumeAZ(volumeAZ)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, newVolumeAZ, volumeAZ)
+	}
+
+	// the volume is created without the invalid availability zone
+	b.azFromNodes = false
+	volumeID := srv.Add(fakeopenstack.Volumes, nil)
+	snapshotID := srv.Add(fakeopenstack.VolumeSnapshots, map[string]interface{}{"volume_id": volumeID})
+	newVolumeID, err := b.CreateVolumeFromSnapshot(snapshotID, "", "az2", nil)
+	require.Nil(t, err)
+	assert.Equal(t, "nova", srv.Get(fakeopenstack.Volumes, newVolumeID)["availability_zone"])
+
+	b.azFallback = false
+	_, err = b.CreateVolumeFromSnapshot(snapshotID, "", "az2", nil)
+	assert.ErrorContains(t, err, "Availability zone 'zone-c' is invalid")
+
+	// the persistent volume topology follows the restored volume
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "pv",
+			Labels: map[string]string{v1.LabelTopologyZone: "az2", "app": "db"},
+		},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{
+					Driver:       "cinder.csi.openstack.org",
+					VolumeHandle: volumeID,
+				},
+			},
+			NodeAffinity: &v1.VolumeNodeAffinity{
+				Required: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{{
+						MatchExpressions: []v1.NodeSelectorRequirement{
+							{Key: cinderZoneKey, Operator: v1.NodeSelectorOpIn, Values: []string{"az2"}},
+							{Key: "example.com/rack", Operator: v1.NodeSelectorOpIn, Values: []string{"r1"}},
+						},
+					}},
+				},
+			},
+		},
+	}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pv)
+	require.Nil(t, err)
+	res, err := b.SetVolumeID(&unstructured.Unstructured{Object: obj}, newVolumeID)
+	require.Nil(t, err)
+	newPV := new(v1.PersistentVolume)
+	require.Nil(t, runtime.DefaultUnstructuredConverter.FromUnstructured(res.UnstructuredContent(), newPV))
+	assert.Equal(t, newVolumeID, newPV.Spec.CSI.VolumeHandle)
+	assert.Equal(t, map[string]string{v1.LabelTopologyZone: "nova", "app": "db"}, newPV.Labels)
+	exprs := newPV.Spec.NodeAffinity.Required.NodeSelectorTerms[0].MatchExpressions
+	assert.Equal(t, []string{"nova"}, exprs[0].Values)
+	assert.Equal(t, []string{"r1"}, exprs[1].Values)
+}
+
+func TestVolumeTransfer(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	cloudsYAML := filepath.Join(t.TempDir(), "clouds.yaml")
+	require.Nil(t, os.WriteFile(cloudsYAML, []byte(srv.CloudsYAML()), 0600))
+	t.Setenv("OS_CLIENT_CONFIG_FILE", cloudsYAML)
+
+	b := NewBlockStore(logrus.New())
+	err := b.Init(map[string]string{"transferCloud": "missing"})
+	assert.ErrorContains(t, err, "missing")
+
+	b = newTestBlockStore(t, map[string]string{"transferCloud": fakeopenstack.TransferProjectName})
+	volumeID := srv.Add(fakeopenstack.Volumes, nil)
+	snapshotID := srv.Add(fakeopenstack.VolumeSnapshots, map[string]interface{}{"volume_id": volumeID})
+
+	// the restored volume is owned by the transfer project
+	newVolumeID, err := b.CreateVolumeFromSnapshot(snapshotID, "", "nova", nil)
+	require.Nil(t, err)
+	volume := srv.Get(fakeopenstack.Volumes, newVolumeID)
+	assert.Equal(t, "available", volume["status"])
+	assert.Equal(t, fakeopenstack.TransferProjectID, volume["os-vol-tenant-attr:tenant_id"])
+	assert.Empty(t, srv.List(fakeopenstack.VolumeTransfers, nil))
+	ready, err := b.IsVolumeReady(newVolumeID, "nova")
+	assert.Nil(t, err)
+	assert.True(t, ready)
+	_, _, err = b.GetVolumeInfo(newVolumeID, "nova")
+	assert.ErrorContains(t, err, "could not be found")
+
+	// the volume isn't left behind, when the transfer fails
+	srv.Fail("POST", "/accept", 400, 1)
+	newVolumeID, err = b.CreateVolumeFromSnapshot(snapshotID, "", "nova", nil)
+	assert.ErrorContains(t, err, "failed to accept volume")
+	assert.Empty(t, newVolumeID)
+	assert.Empty(t, srv.List(fakeopenstack.VolumeTransfers, nil))
+	volumes := srv.List(fakeopenstack.Volumes, map[string]string{"status": "deleting"})
+	require.Len(t, volumes, 1)
+	assert.Equal(t, fakeopenstack.ProjectID, volumes[0]["os-vol-tenant-attr:tenant_id"])
+
+	// the accepted volume is deleted in the target project
+	srv.Fail("GET", fakeopenstack.TransferProjectID+"/volumes/", 500, 1)
+	newVolumeID, err = b.CreateVolumeFromSnapshot(snapshotID, "", "nova", nil)
+	assert.ErrorContains(t, err, "didn't get into 'available' state")
+	assert.Empty(t, newVolumeID)
+	volumes = srv.List(fakeopenstack.Volumes, map[string]string{"status": "deleting"})
+	require.Len(t, volumes, 2)
+	assert.Equal(t, fakeopenstack.TransferProjectID, volumes[1]["os-vol-tenant-attr:tenant_id"])
+}
+
+func TestVolumeTransferQuotaCheck(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	cloudsYAML := filepath.Join(t.TempDir(), "clouds.yaml")
+	require.Nil(t, os.WriteFile(cloudsYAML, []byte(srv.CloudsYAML()), 0600))
+	t.Setenv("OS_CLIENT_CONFIG_FILE", cloudsYAML)
+	srv.VolumeQuotas = map[string]int{"volumes": 2}
+
+	b := newTestBlockStore(t, map[string]string{
+		"transferCloud": fakeopenstack.TransferProjectName,
+		"quotaCheck":    "true",
+	})
+	volumeID := srv.Add(fakeopenstack.Volumes, nil)
+	snapshotID := srv.Add(fakeopenstack.VolumeSnapshots, map[string]interface{}{"volume_id": volumeID})
+
+	// the quota of the target project is checked
+	newVolumeID, err := b.CreateVolumeFromSnapshot(snapshotID, "", "nova", nil)
+	require.Nil(t, err)
+	assert.Equal(t, fakeopenstack.TransferProjectID, srv.Get(fakeopenstack.Volumes, newVolumeID)["os-vol-tenant-attr:tenant_id"])
+	_, err = b.CreateVolumeFromSnapshot(snapshotID, "", "nova", nil)
+	require.Nil(t, err)
+	_, err = b.CreateVolumeFromSnapshot(snapshotID, "", "nova", nil)
+	assert.ErrorContains(t, err, "in project "+fakeopenstack.TransferProjectID)
+}
+
+func TestVolumeEncryption(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.VolumeMicroversion = "3.64"
+	srv.VolumeTypes = []string{"luks", "luks-512", "plain"}
+	srv.VolumeTypeEncryption = map[string]map[string]interface{}{
+		"luks":     {"provider": "luks", "cipher": "aes-xts-plain64", "key_size": 256, "control_location": "front-end"},
+		"luks-512": {"provider": "luks", "cipher": "aes-xts-plain64", "key_size": 512, "control_location": "front-end"},
+	}
+	b := newTestBlockStore(t, nil)
+	keyID := srv.Add(fakeopenstack.Secrets, nil)
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{
+		"volume_type":       "luks",
+		"encrypted":         true,
+		"encryption_key_id": keyID,
+	})
+
+	// the encryption key and type are kept in the snapshot metadata
+	snapshotID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		utils.BackupTag:         "test-backup",
+		utils.PVTag:             "test-pv",
+		encryptedKey:            "true",
+		encryptionKeyIDKey:      keyID,
+		encryptionTypeKey:       "luks/aes-xts-plain64/256",
+		encryptionVolumeTypeKey: "luks",
+	}, withoutOwnership(srv.Get(fakeopenstack.VolumeSnapshots, snapshotID)["metadata"]))
+
+	newVolumeID, err := b.CreateVolumeFromSnapshot(snapshotID, "luks", "nova", nil)
+	require.Nil(t, err)
+	assert.Equal(t, true, srv.Get(fakeopenstack.Volumes, newVolumeID)["encrypted"])
+	_, err = b.CreateVolumeFromSnapshot(snapshotID, "", "nova", nil)
+	assert.Nil(t, err)
+
+	// the target volume type must have the same encryption type
+	_, err = b.CreateVolumeFromSnapshot(snapshotID, "plain", "nova", nil)
+	assert.ErrorContains(t, err, `the "plain" volume type, which is not encrypted`)
+	_, err = b.CreateVolumeFromSnapshot(snapshotID, "luks-512", "nova", nil)
+	assert.ErrorContains(t, err, `"luks-512" volume type with the "luks/aes-xts-plain64/512" encryption type`)
+
+	// the encryption key must be accessible
+	srv.Delete(fakeopenstack.Secrets, keyID)
+	_, err = b.CreateVolumeFromSnapshot(snapshotID, "luks", "nova", nil)
+	assert.ErrorContains(t, err, "doesn't exist in Barbican")
+	srv.Add(fakeopenstack.Secrets, map[string]interface{}{"id": keyID})
+	srv.Fail("GET", "/secrets/", 403, 1)
+	_, err = b.CreateVolumeFromSnapshot(snapshotID, "luks", "nova", nil)
+	assert.ErrorContains(t, err, "is not accessible")
+
+	// the volume type encryption is shown only to admins, the encrypted flag
+	// and the volume type are kept for non-admin users
+	volumeID = srv.Add(fakeopenstack.Volumes, map[string]interface{}{
+		"volume_type":       "luks",
+		"encrypted":         true,
+		"encryption_key_id": keyID,
+	})
+	srv.Fail("GET", "/encryption", 403, 1)
+	snapshotID, err = b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	metadata := srv.Get(fakeopenstack.VolumeSnapshots, snapshotID)["metadata"].(map[string]interface{})
+	assert.Equal(t, "true", metadata[encryptedKey])
+	assert.Equal(t, "luks", metadata[encryptionVolumeTypeKey])
+	assert.Equal(t, keyID, metadata[encryptionKeyIDKey])
+	assert.NotContains(t, metadata, encryptionTypeKey)
+	srv.Fail("GET", "/encryption", 403, 1)
+	_, err = b.CreateVolumeFromSnapshot(snapshotID, "luks", "nova", nil)
+	assert.Nil(t, err)
+	_, err = b.CreateVolumeFromSnapshot(snapshotID, "plain", "nova", nil)
+	assert.ErrorContains(t, err, `the "plain" volume type, which is not encrypted`)
+
+	// unencrypted volumes don't have encryption metadata
+	volumeID = srv.Add(fakeopenstack.Volumes, map[string]interface{}{"volume_type": "plain"})
+	snapshotID, err = b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	assert.NotContains(t, srv.Get(fakeopenstack.VolumeSnapshots, snapshotID)["metadata"], encryptionTypeKey)
+	_, err = b.CreateVolumeFromSnapshot(snapshotID, "plain", "nova", nil)
+	assert.Nil(t, err)
+}
+
+func TestQuotaCheck(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.VolumeQuotas = map[string]int{"gigabytes": 25, "volumes": 10}
+	b := newTestBlockStore(t, map[string]string{
+		"quotaCheck":  "true",
+		"quotaMargin": "20%",
+	})
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{"size": 10})
+
+	// 10 GiB volume and 10 GiB snapshot fit into 80% of the 25 GiB limit
+	snapshotID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	_, err = b.CreateSnapshot(volumeID, "nova", testTags)
+	assert.ErrorContains(t, err, "refusing to create a snapshot of volume "+volumeID)
+	assert.ErrorContains(t, err, "gigabytes (requested 10, in use 20, reserved 0, limit 20 with a 20% margin)")
+	assert.Len(t, srv.List(fakeopenstack.VolumeSnapshots, nil), 1)
+	_, err = b.CreateVolumeFromSnapshot(snapshotID, "", "nova", nil)
+	assert.ErrorContains(t, err, "refusing to create a volume from snapshot "+snapshotID)
+
+	srv.VolumeQuotas["gigabytes"] = -1
+	_, err = b.CreateVolumeFromSnapshot(snapshotID, "", "nova", nil)
+	assert.Nil(t, err)
+
+	// quota usage is not checked by default
+	srv.VolumeQuotas["gigabytes"] = 0
+	b = newTestBlockStore(t, nil)
+	_, err = b.CreateSnapshot(volumeID, "nova", testTags)
+	assert.Nil(t, err)
+
+	// a retried backup reuses its snapshot in a project at the quota
+	srv.VolumeQuotas["gigabytes"] = -1
+	b = newTestBlockStore(t, map[string]string{"quotaCheck": "true"})
+	b.veleroClient = velerofake.NewSimpleClientset(&velerov1.Backup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "test-backup", UID: "test-uid"},
+	})
+	snapshotID, err = b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	srv.VolumeQuotas["gigabytes"] = 0
+	retriedID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	assert.Equal(t, snapshotID, retriedID)
+
+	b = NewBlockStore(logrus.New())
+	assert.ErrorContains(t, b.Init(map[string]string{"quotaMargin": "100"}), "cannot parse quotaMargin")
+}
+
+func TestOwnershipMetadata(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	b := newTestBlockStore(t, map[string]string{"method": "clone"})
+	b.kubeClient = k8sfake.NewSimpleClientset(&v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pv"},
+		Spec: v1.PersistentVolumeSpec{
+			ClaimRef: &v1.ObjectReference{Namespace: "app", Name: "data"},
+		},
+	}, &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "cluster-uid"},
+	})
+	volumeID := srv.Add(fakeopenstack.Volumes, nil)
+
+	cloneID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	metadata := srv.Get(fakeopenstack.Volumes, cloneID)["metadata"].(map[string]interface{})
+	assert.Equal(t, "unknown", metadata[utils.VersionKey])
+	assert.Equal(t, "clone", metadata[utils.MethodKey])
+	assert.Equal(t, volumeID, metadata[utils.SourceKey])
+	assert.Equal(t, "test-backup", metadata[utils.BackupTag])
+	assert.Equal(t, "test-pv", metadata[utils.PVTag])
+	assert.Equal(t, "app/data", metadata[utils.PVCKey])
+	assert.Equal(t, "cluster-uid/velero", metadata[utils.InstallationKey])
+	_, err = time.Parse(time.RFC3339, metadata[utils.CreatedAtKey].(string))
+	assert.Nil(t, err)
+
+	// restored volumes keep the ownership metadata of the snapshot
+	newVolumeID, err := b.CreateVolumeFromSnapshot(cloneID, "", "nova", nil)
+	require.Nil(t, err)
+	metadata = srv.Get(fakeopenstack.Volumes, newVolumeID)["metadata"].(map[string]interface{})
+	assert.Equal(t, cloneID, metadata[utils.SourceKey])
+	assert.Equal(t, "test-backup", metadata[utils.BackupTag])
+	assert.Equal(t, "app/data", metadata[utils.PVCKey])
+}
+
+func TestIdempotentNaming(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	b := newTestBlockStore(t, nil)
+	b.veleroClient = velerofake.NewSimpleClientset(&velerov1.Backup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "test-backup", UID: "test-uid"},
+	})
+	volumeID := srv.Add(fakeopenstack.Volumes, nil)
+
+	// the snapshot name is derived from the backup UID
+	snapshotID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	snapshot := srv.Get(fakeopenstack.VolumeSnapshots, snapshotID)
+	assert.Equal(t, volumeID+".snap.test-uid", snapshot["name"])
+	assert.Equal(t, "test-uid", snapshot["metadata"].(map[string]interface{})[utils.BackupUIDTag])
+
+	// a retried backup reuses the snapshot
+	retriedID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	assert.Equal(t, snapshotID, retriedID)
+	assert.Equal(t, 1, srv.CountCalls("POST", "/snapshots"))
+
+	// a failed snapshot isn't reused
+	require.Nil(t, srv.Update(fakeopenstack.VolumeSnapshots, snapshotID, map[string]interface{}{"status": "error"}))
+	retriedID, err = b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	assert.NotEqual(t, snapshotID, retriedID)
+
+	// a retried backup reuses the volume backup
+	b2 := newTestBlockStore(t, map[string]string{"method": "backup"})
+	b2.veleroClient = b.veleroClient
+	backupID, err := b2.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	assert.Equal(t, volumeID+".backup.test-uid", srv.Get(fakeopenstack.Backups, backupID)["name"])
+	retriedID, err = b2.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	assert.Equal(t, backupID, retriedID)
+	assert.Equal(t, 1, srv.CountCalls("POST", "/backups"))
+
+	// untagged snapshots get random names
+	firstID, err := b.CreateSnapshot(volumeID, "nova", nil)
+	require.Nil(t, err)
+	secondID, err := b.CreateSnapshot(volumeID, "nova", nil)
+	require.Nil(t, err)
+	assert.NotEqual(t, firstID, secondID)
+
+	// a new backup with the same name doesn't reuse the snapshots, when the
+	// backup UID is unknown
+	b3 := newTestBlockStore(t, nil)
+	b3.veleroClient = velerofake.NewSimpleClientset()
+	firstID, err = b3.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	secondID, err = b3.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	assert.NotEqual(t, firstID, secondID)
+
+	// a retried restore reuses the volume named after the restore UID
+	_, err = b2.veleroClient.VeleroV1().Restores("velero").Create(context.Background(), &velerov1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "test-restore", UID: "restore-uid"},
+		Spec:       velerov1.RestoreSpec{BackupName: "test-backup"},
+		Status:     velerov1.RestoreStatus{Phase: velerov1.RestorePhaseInProgress},
+	}, metav1.CreateOptions{})
+	require.Nil(t, err)
+	restoredID, err := b2.CreateVolumeFromSnapshot(backupID, "", "nova", nil)
+	require.Nil(t, err)
+	assert.Equal(t, backupID+".backup.restore-uid", srv.Get(fakeopenstack.Volumes, restoredID)["name"])
+	metadata := srv.Get(fakeopenstack.Volumes, restoredID)["metadata"].(map[string]interface{})
+	assert.Equal(t, "test-restore", metadata[utils.RestoreTag])
+	retriedID, err = b2.CreateVolumeFromSnapshot(backupID, "", "nova", nil)
+	require.Nil(t, err)
+	assert.Equal(t, restoredID, retriedID)
+
+	// restores of the backup, which are not in progress, are ignored
+	_, err = b3.veleroClient.VeleroV1().Restores("velero").Create(context.Background(), &velerov1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "test-restore", UID: "restore-uid"},
+		Spec:       velerov1.RestoreSpec{BackupName: "test-backup"},
+		Status:     velerov1.RestoreStatus{Phase: velerov1.RestorePhaseCompleted},
+	}, metav1.CreateOptions{})
+	require.Nil(t, err)
+	restoredID, err = b3.CreateVolumeFromSnapshot(firstID, "", "nova", nil)
+	require.Nil(t, err)
+	retriedID, err = b3.CreateVolumeFromSnapshot(firstID, "", "nova", nil)
+	require.Nil(t, err)
+	assert.NotEqual(t, restoredID, retriedID)
+}
+
+func TestAttachmentProperties(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.VolumeTypes = []string{fakeopenstack.DefaultVolumeType, "multiattach"}
+	srv.MultiattachVolumeTypes = []string{"multiattach"}
+	b := newTestBlockStore(t, nil)
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{
+		"volume_type": "multiattach",
+		"multiattach": true,
+		"metadata":    map[string]string{"readonly": "True"},
+	})
+
+	snapshotID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	metadata := srv.Get(fakeopenstack.VolumeSnapshots, snapshotID)["metadata"].(map[string]interface{})
+	assert.Equal(t, "multiattach", metadata[multiattachVolumeTypeKey])
+	assert.Equal(t, "true", metadata[readonlyKey])
+
+	// the volume restored into a volume type without multi-attach is retyped
+	newVolumeID, err := b.CreateVolumeFromSnapshot(snapshotID, fakeopenstack.DefaultVolumeType, "nova", nil)
+	require.Nil(t, err)
+	newVolume := srv.Get(fakeopenstack.Volumes, newVolumeID)
+	assert.Equal(t, "multiattach", newVolume["volume_type"])
+	assert.Equal(t, true, newVolume["multiattach"])
+	assert.Equal(t, "True", newVolume["metadata"].(map[string]interface{})["readonly"])
+	// os-retype and os-update_readonly_flag
+	assert.Equal(t, 2, srv.CountCalls("POST", "/volumes/"+newVolumeID+"/action"))
+
+	// the persistent volume of a read-only multi-attach volume
+	pv := &v1.PersistentVolume{
+		Spec: v1.PersistentVolumeSpec{
+			AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteMany},
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{
+					Driver:       "cinder.csi.openstack.org",
+					VolumeHandle: volumeID,
+				},
+			},
+		},
+	}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pv)
+	require.Nil(t, err)
+	res, err := b.SetVolumeID(&unstructured.Unstructured{Object: obj}, newVolumeID)
+	require.Nil(t, err)
+	newPV := new(v1.PersistentVolume)
+	require.Nil(t, runtime.DefaultUnstructuredConverter.FromUnstructured(res.UnstructuredContent(), newPV))
+	assert.Equal(t, []v1.PersistentVolumeAccessMode{v1.ReadWriteMany}, newPV.Spec.AccessModes)
+	assert.True(t, newPV.Spec.CSI.ReadOnly)
+
+	// the ReadWriteMany access mode requires a multi-attach volume
+	plainVolumeID := srv.Add(fakeopenstack.Volumes, nil)
+	res, err = b.SetVolumeID(&unstructured.Unstructured{Object: obj}, plainVolumeID)
+	require.Nil(t, err)
+	newPV = new(v1.PersistentVolume)
+	require.Nil(t, runtime.DefaultUnstructuredConverter.FromUnstructured(res.UnstructuredContent(), newPV))
+	assert.Equal(t, []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce}, newPV.Spec.AccessModes)
+	assert.False(t, newPV.Spec.CSI.ReadOnly)
+
+	// a retype to another backend migrates the volume only on demand
+	srv.VolumeTypeBackends = map[string]string{"multiattach": "ssd"}
+	newVolumeID, err = b.CreateVolumeFromSnapshot(snapshotID, fakeopenstack.DefaultVolumeType, "nova", nil)
+	require.Nil(t, err)
+	newVolume = srv.Get(fakeopenstack.Volumes, newVolumeID)
+	assert.Equal(t, fakeopenstack.DefaultVolumeType, newVolume["volume_type"])
+	assert.Nil(t, newVolume["migration_status"])
+	migrating := newTestBlockStore(t, map[string]string{"multiattachRetypeMigration": "true"})
+	newVolumeID, err = migrating.CreateVolumeFromSnapshot(snapshotID, fakeopenstack.DefaultVolumeType, "nova", nil)
+	require.Nil(t, err)
+	newVolume = srv.Get(fakeopenstack.Volumes, newVolumeID)
+	assert.Equal(t, "multiattach", newVolume["volume_type"])
+	assert.Equal(t, "success", newVolume["migration_status"])
+
+	// the volume isn't left behind, when the retype fails
+	srv.Fail("POST", "/action", 400, 1)
+	newVolumeID, err = b.CreateVolumeFromSnapshot(snapshotID, fakeopenstack.DefaultVolumeType, "nova", nil)
+	assert.ErrorContains(t, err, "failed to retype volume")
+	assert.Empty(t, newVolumeID)
+	assert.Len(t, srv.List(fakeopenstack.Volumes, map[string]string{"status": "deleting"}), 1)
+}
+
+func TestRestoreSize(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	b := newTestBlockStore(t, nil)
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{"size": 1})
+	snapshotID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+
+	setVolumeID := func(pv *v1.PersistentVolume, volumeID string) (*v1.PersistentVolume, error) {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pv)
+		require.Nil(t, err)
+		res, err := b.SetVolumeID(&unstructured.Unstructured{Object: obj}, volumeID)
+		if err != nil {
+			return nil, err
+		}
+		newPV := new(v1.PersistentVolume)
+		require.Nil(t, runtime.DefaultUnstructuredConverter.FromUnstructured(res.UnstructuredContent(), newPV))
+		return newPV, nil
+	}
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{restoreSizeAnnotation: "3Gi"},
+		},
+		Spec: v1.PersistentVolumeSpec{
+			Capacity: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")},
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				Cinder: &v1.CinderPersistentVolumeSource{VolumeID: volumeID},
+			},
+		},
+	}
+
+	// the restored volume is extended to the annotated size
+	newVolumeID, err := b.CreateVolumeFromSnapshot(snapshotID, "", "nova", nil)
+	require.Nil(t, err)
+	newPV, err := setVolumeID(pv, newVolumeID)
+	require.Nil(t, err)
+	assert.Equal(t, 3, srv.Get(fakeopenstack.Volumes, newVolumeID)["size"])
+	capacity := newPV.Spec.Capacity[v1.ResourceStorage]
+	assert.Equal(t, "3Gi", capacity.String())
+
+	// the restored volume isn't shrunk
+	pv.Annotations[restoreSizeAnnotation] = "512Mi"
+	newPV, err = setVolumeID(pv, newVolumeID)
+	require.Nil(t, err)
+	capacity = newPV.Spec.Capacity[v1.ResourceStorage]
+	assert.Equal(t, "3Gi", capacity.String())
+
+	// the restored volume is extended to the persistent volume capacity
+	newVolumeID, err = b.CreateVolumeFromSnapshot(snapshotID, "", "nova", nil)
+	require.Nil(t, err)
+	delete(pv.Annotations, restoreSizeAnnotation)
+	pv.Spec.Capacity[v1.ResourceStorage] = resource.MustParse("1500Mi")
+	_, err = setVolumeID(pv, newVolumeID)
+	require.Nil(t, err)
+	assert.Equal(t, 2, srv.Get(fakeopenstack.Volumes, newVolumeID)["size"])
+
+	pv.Annotations[restoreSizeAnnotation] = "large"
+	_, err = setVolumeID(pv, newVolumeID)
+	assert.ErrorContains(t, err, `invalid "large" value of the velero-plugin-for-openstack/restore-size annotation`)
+}
+
+func TestBootableVolume(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	b := newTestBlockStore(t, map[string]string{"method": "backup"})
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{
+		"bootable": "true",
+		"volume_image_metadata": map[string]interface{}{
+			"image_id":        "4bd4c7d2-5d1f-4a47-9a4e-8a5f2c0f1d2e",
+			"hw_machine_type": "q35",
+		},
+	})
+
+	backupID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	metadata := srv.Get(fakeopenstack.Backups, backupID)["metadata"].(map[string]interface{})
+	assert.Equal(t, "true", metadata[bootableKey])
+	assert.Equal(t, "q35", metadata[imageMetadataKeyPrefix+"hw_machine_type"])
+
+	// volumes restored from backups don't have the image metadata
+	newVolumeID, err := b.CreateVolumeFromSnapshot(backupID, "", "nova", nil)
+	require.Nil(t, err)
+	newVolume := srv.Get(fakeopenstack.Volumes, newVolumeID)
+	assert.Equal(t, "true", newVolume["bootable"])
+	assert.Equal(t, map[string]interface{}{
+		"image_id":        "4bd4c7d2-5d1f-4a47-9a4e-8a5f2c0f1d2e",
+		"hw_machine_type": "q35",
+	}, newVolume["volume_image_metadata"])
+
+	// volumes restored from snapshots keep the image metadata
+	b2 := newTestBlockStore(t, nil)
+	snapshotID, err := b2.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	newVolumeID, err = b2.CreateVolumeFromSnapshot(snapshotID, "", "nova", nil)
+	require.Nil(t, err)
+	assert.Equal(t, "true", srv.Get(fakeopenstack.Volumes, newVolumeID)["bootable"])
+	// only the bootable flag is set
+	assert.Equal(t, 1, srv.CountCalls("POST", "/volumes/"+newVolumeID+"/action"))
+
+	// the volume isn't left behind, when the bootable flag cannot be set
+	srv.Fail("POST", "/action", 400, 1)
+	newVolumeID, err = b2.CreateVolumeFromSnapshot(snapshotID, "", "nova", nil)
+	assert.ErrorContains(t, err, "failed to set volume")
+	assert.Empty(t, newVolumeID)
+	assert.Len(t, srv.List(fakeopenstack.Volumes, map[string]string{"status": "deleting"}), 1)
+}
+
+func TestMethodFallback(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	b := newTestBlockStore(t, map[string]string{"methodFallback": "backup, image"})
+	assert.Equal(t, []string{"snapshot", "backup", "image"}, b.methods)
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{"status": "in-use"})
+
+	// the snapshot of the attached volume isn't supported
+	srv.Fail("POST", "/snapshots", 400, 1)
+	snapshotID, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(snapshotID, "backup:"), snapshotID)
+	backupID := strings.TrimPrefix(snapshotID, "backup:")
+	assert.Equal(t, volumeID, srv.Get(fakeopenstack.Backups, backupID)["volume_id"])
+
+	// the method in the snapshot ID takes precedence over the configured method
+	b2 := newTestBlockStore(t, map[string]string{"method": "image"})
+	newVolumeID, err := b2.CreateVolumeFromSnapshot(snapshotID, "", "nova", nil)
+	require.Nil(t, err)
+	assert.Equal(t, backupID, srv.Get(fakeopenstack.Volumes, newVolumeID)["backup_id"])
+	assert.Nil(t, b2.DeleteSnapshot(snapshotID))
+	assert.Equal(t, 1, srv.CountCalls("DELETE", "/backups/"+backupID))
+
+	// the image method is set up by the default snapshot location as well
+	imageID, err := newTestBlockStore(t, map[string]string{"method": "image"}).CreateSnapshot(volumeID, "nova", backupTags("test-backup-2"))
+	require.Nil(t, err)
+	b3 := newTestBlockStore(t, nil)
+	require.NotNil(t, b3.imgClient)
+	newVolumeID, err = b3.CreateVolumeFromSnapshot("image:"+imageID, "", "nova", nil)
+	require.Nil(t, err)
+	assert.Equal(t, imageID, srv.Get(fakeopenstack.Volumes, newVolumeID)["volume_image_metadata"].(map[string]interface{})["image_id"])
+	assert.Nil(t, b3.DeleteSnapshot("image:"+imageID))
+	assert.Nil(t, srv.Get(fakeopenstack.Images, imageID))
+
+	// other errors don't fall back
+	for _, code := range []int{404, 500, 503} {
+		srv.Fail("POST", "/snapshots", code, 1)
+		_, err = b.CreateSnapshot(volumeID, "nova", backupTags(fmt.Sprintf("test-backup-%d", code)))
+		assert.ErrorContains(t, err, "failed to create snapshot")
+	}
+
+	// a cloud without the backup service falls back to the image method
+	srv.NoBackupService = true
+	backupCalls := srv.CountCalls("POST", "/backups")
+	b4 := newTestBlockStore(t, map[string]string{"method": "backup", "methodFallback": "image"})
+	snapshotID, err = b4.CreateSnapshot(volumeID, "nova", backupTags("test-backup-3"))
+	require.Nil(t, err)
+	assert.True(t, strings.HasPrefix(snapshotID, "image:"), snapshotID)
+	assert.Equal(t, backupCalls+1, srv.CountCalls("POST", "/backups"))
+	b5 := newTestBlockStore(t, map[string]string{"method": "backup"})
+	_, err = b5.CreateSnapshot(volumeID, "nova", backupTags("test-backup-4"))
+	assert.True(t, utils.IsServiceNotFound(err), err)
+	assert.Equal(t, backupCalls+2, srv.CountCalls("POST", "/backups"))
+
+	// the snapshot of a method unsupported by the cloud cannot be restored
+	srv.VolumeMicroversion = "3.40"
+	b6 := newTestBlockStore(t, nil)
+	_, err = b6.CreateVolumeFromSnapshot(snapshotID, "", "nova", nil)
+	assert.Nil(t, err)
+	_, err = b6.CreateVolumeFromSnapshot("backup:"+backupID, "", "nova", nil)
+	assert.ErrorContains(t, err, `failed to set up the "backup" snapshot method`)
+
+	err = NewBlockStore(logrus.New()).Init(map[string]string{"methodFallback": "copy"})
+	assert.ErrorContains(t, err, `unsupported "copy" fallback snapshot method`)
+}
+
+func TestRequestIDInErrors(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	b := newTestBlockStore(t, nil)
+	volumeID := srv.Add(fakeopenstack.Volumes, nil)
+
+	srv.Fail("POST", "/snapshots", 500, 1)
+	_, err := b.CreateSnapshot(volumeID, "nova", testTags)
+	assert.ErrorContains(t, err, "failed to create snapshot")
+	assert.Regexp(t, `request ID: req-`, err.Error())
+	assert.NotEmpty(t, utils.RequestID(err))
+}
@@ -0,0 +1,246 @@
+package cinder
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/imagedata"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// image property prefix of the image copy IDs in other regions
+	imageCopyPrefix = "velero_image_copy:"
+	// image copy properties, which keep the source image ID and region
+	imageSourceKey       = "velero_source_image"
+	imageSourceRegionKey = "velero_source_region"
+	// prefix of the image properties reserved by Glance
+	glanceReservedPrefix = "os_glance_"
+)
+
+// imageListOpts filters images by the source image ID
+type imageListOpts struct {
+	sourceImage string
+}
+
+func (opts imageListOpts) ToImageListQuery() (string, error) {
+	q := url.Values{}
+	q.Set(imageSourceKey, opts.sourceImage)
+	return "?" + q.Encode(), nil
+}
+
+// getImageRegionClient returns the Glance client of the region
+func (b *BlockStore) getImageRegionClient(region string) (*gophercloud.ServiceClient, error) {
+	if region == b.region {
+		return b.imgClient, nil
+	}
+	b.imgRegionMu.Lock()
+	defer b.imgRegionMu.Unlock()
+	if client, ok := b.imgRegionClients[region]; ok {
+		return client, nil
+	}
+	client, err := openstack.NewImageServiceV2(b.provider, gophercloud.EndpointOpts{
+		Region: region,
+	})
+	if err != nil {
+		return nil, utils.WithRequestID(fmt.Errorf("failed to create glance image client in the %q region: %w", region, err))
+	}
+	b.imgRegionClients[region] = client
+	return client, nil
+}
+
+// copyImage copies the image to the additional Glance stores and regions and
+// keeps IDs of the region copies in the image properties
+func (b *BlockStore) copyImage(logWithFields *logrus.Entry, image *images.Image) error {
+	var stores []string
+	for _, store := range b.imageCopyStores {
+		if !utils.SliceContains(imageStores(image), store) {
+			stores = append(stores, store)
+		}
+	}
+	if len(stores) > 0 {
+		err := b.copyImageToStores(logWithFields, image.ID, stores)
+		if err != nil {
+			return err
+		}
+	}
+
+	var updateProperties images.UpdateOpts
+	for _, region := range b.imageCopyRegions {
+		if region == b.region {
+			continue
+		}
+		copyID, err := b.copyImageToRegion(logWithFields.WithField("region", region), image, region)
+		if err != nil {
+			return err
+		}
+		updateProperties = append(updateProperties, images.UpdateImageProperty{
+			Op:    images.AddOp,
+			Name:  imageCopyPrefix + region,
+			Value: copyID,
+		})
+	}
+	if len(updateProperties) == 0 {
+		return nil
+	}
+
+	_, err := images.Update(b.imgClient, image.ID, updateProperties).Extract()
+	if err != nil {
+		logWithFields.Error("failed to update image properties")
+		return fmt.Errorf("failed to update image %v properties: %w", image.ID, err)
+	}
+
+	return nil
+}
+
+// copyImageToRegion downloads the image and uploads it to the Glance of
+// another region
+func (b *BlockStore) copyImageToRegion(logWithFields *logrus.Entry, image *images.Image, region string) (string, error) {
+	client, err := b.getImageRegionClient(region)
+	if err != nil {
+		return "", err
+	}
+
+	properties := map[string]string{
+		imageSourceKey:       image.ID,
+		imageSourceRegionKey: b.region,
+	}
+	for key, value := range image.Properties {
+		v, ok := value.(string)
+		if !ok || utils.SliceContains(skipVolumeAttributes, key) || utils.SliceContains(regionImageProperties, key) {
+			continue
+		}
+		if strings.HasPrefix(key, glanceReservedPrefix) || strings.HasPrefix(key, imageCopyPrefix) {
+			continue
+		}
+		properties[key] = v
+	}
+	containerFormat := image.ContainerFormat
+	if containerFormat == "" {
+		containerFormat = "bare"
+	}
+	diskFormat := image.DiskFormat
+	if diskFormat == "" {
+		diskFormat = "raw"
+	}
+	visibility := image.Visibility
+
+	logWithFields.Info("Copying image to the region")
+	imageCopy, err := images.Create(client, images.CreateOpts{
+		Name:            image.Name,
+		ContainerFormat: containerFormat,
+		DiskFormat:      diskFormat,
+		Visibility:      &visibility,
+		MinDisk:         image.MinDiskGigabytes,
+		MinRAM:          image.MinRAMMegabytes,
+		Properties:      properties,
+	}).Extract()
+	if err != nil {
+		logWithFields.Error("failed to create image copy")
+		return "", fmt.Errorf("failed to create image %v copy in the %q region: %w", image.ID, region, err)
+	}
+
+	err = b.uploadImageCopy(client, image.ID, imageCopy.ID)
+	if err != nil {
+		logWithFields.Error("failed to upload image copy")
+		if err := b.removeImage(logWithFields, client, imageCopy.ID); err != nil {
+			logWithFields.WithError(err).Error("failed to delete image copy")
+		}
+		return "", fmt.Errorf("failed to upload image %v copy to the %q region: %w", image.ID, region, err)
+	}
+
+	if b.imageProtected {
+		_, err = images.Update(client, imageCopy.ID, images.UpdateOpts{
+			images.ReplaceImageProtected{NewProtected: true},
+		}).Extract()
+		if err != nil {
+			logWithFields.Error("failed to protect image copy")
+			return imageCopy.ID, fmt.Errorf("failed to protect image %v copy in the %q region: %w", image.ID, region, err)
+		}
+	}
+
+	logWithFields.WithField("imageCopyID", imageCopy.ID).Info("Image was copied to the region")
+	return imageCopy.ID, nil
+}
+
+// uploadImageCopy streams the image data into the image copy and waits until
+// the copy is active
+func (b *BlockStore) uploadImageCopy(client *gophercloud.ServiceClient, imageID, copyID string) error {
+	data, err := imagedata.Download(b.imgClient, imageID).Extract()
+	if err != nil {
+		return fmt.Errorf("failed to download image data: %w", err)
+	}
+	defer data.Close()
+
+	err = imagedata.Upload(client, copyID, data).ExtractErr()
+	if err != nil {
+		return fmt.Errorf("failed to upload image data: %w", err)
+	}
+
+	return utils.WaitForStatus(imageStatuses, b.imageTimeout, b.pollInterval, func() (string, error) {
+		current, err := images.Get(client, copyID).Extract()
+		if err != nil {
+			return "", err
+		}
+		return string(current.Status), nil
+	})
+}
+
+// findImage returns the image ID or the ID of its copy in the current region
+func (b *BlockStore) findImage(logWithFields *logrus.Entry, imageID string) (string, error) {
+	_, err := images.Get(b.imgClient, imageID).Extract()
+	if err == nil {
+		return imageID, nil
+	}
+	if _, ok := err.(gophercloud.ErrDefault404); !ok {
+		logWithFields.Error("failed to get image")
+		return "", fmt.Errorf("failed to get image %v: %w", imageID, err)
+	}
+
+	copies, err := b.listImageCopies(imageID)
+	if err != nil {
+		return "", err
+	}
+	if len(copies) == 0 {
+		return "", fmt.Errorf("neither image %v, nor its copy exist in the %q region", imageID, b.region)
+	}
+	logWithFields.Infof("Using the %v image copy", copies[0].ID)
+
+	return copies[0].ID, nil
+}
+
+// listImageCopies lists copies of the image in the current region
+func (b *BlockStore) listImageCopies(imageID string) ([]images.Image, error) {
+	allPages, err := images.List(b.imgClient, imageListOpts{sourceImage: imageID}).AllPages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list image %v copies: %w", imageID, err)
+	}
+	copies, err := images.ExtractImages(allPages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract image %v copies: %w", imageID, err)
+	}
+	return copies, nil
+}
+
+// deleteLocalImageCopies deletes copies of the image in the current region
+func (b *BlockStore) deleteLocalImageCopies(logWithFields *logrus.Entry, imageID string) error {
+	copies, err := b.listImageCopies(imageID)
+	if err != nil {
+		return err
+	}
+	if len(copies) == 0 {
+		logWithFields.Info("volume image is already deleted")
+	}
+	for _, imageCopy := range copies {
+		err = b.removeImage(logWithFields, b.imgClient, imageCopy.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
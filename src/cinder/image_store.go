@@ -0,0 +1,114 @@
+package cinder
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/sirupsen/logrus"
+)
+
+// isCompressionNotAllowed checks whether the image upload failed, because the
+// "allow_compression_on_image_upload" Cinder option is disabled
+func isCompressionNotAllowed(err error) bool {
+	_, ok := err.(gophercloud.ErrDefault400)
+	return ok && strings.Contains(strings.ToLower(err.Error()), "compression")
+}
+
+// imageStores returns Glance stores of the image, which are set only when
+// Glance multiple stores are enabled
+func imageStores(image *images.Image) []string {
+	stores, _ := image.Properties["stores"].(string)
+	if stores == "" {
+		return nil
+	}
+	return strings.Split(stores, ",")
+}
+
+// moveImageToStore copies the image to the configured Glance store using the
+// "copy-image" import method and removes the image from other stores
+func (b *BlockStore) moveImageToStore(logWithFields *logrus.Entry, image *images.Image) error {
+	logWithFields = logWithFields.WithFields(logrus.Fields{
+		"imageID":    image.ID,
+		"imageStore": b.imageStore,
+	})
+
+	stores := imageStores(image)
+	if len(stores) == 0 {
+		return fmt.Errorf("image %v doesn't have any store, Glance multiple stores are not enabled", image.ID)
+	}
+
+	if !utils.SliceContains(stores, b.imageStore) {
+		err := b.copyImageToStores(logWithFields, image.ID, []string{b.imageStore})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, store := range stores {
+		if store == b.imageStore {
+			continue
+		}
+		_, err := b.imgClient.Delete(b.imgClient.ServiceURL("stores", store, image.ID), &gophercloud.RequestOpts{
+			OkCodes: []int{204},
+		})
+		if err != nil {
+			logWithFields.Errorf("failed to delete image from the %q store", store)
+			return fmt.Errorf("failed to delete image %v from the %q store: %w", image.ID, store, err)
+		}
+		logWithFields.Infof("Image was deleted from the %q store", store)
+	}
+
+	return nil
+}
+
+// copyImageToStores copies the image to the Glance stores using the
+// "copy-image" import method
+func (b *BlockStore) copyImageToStores(logWithFields *logrus.Entry, imageID string, stores []string) error {
+	logWithFields = logWithFields.WithFields(logrus.Fields{
+		"imageID": imageID,
+		"stores":  stores,
+	})
+	logWithFields.Info("Copying image to the stores")
+
+	body := map[string]interface{}{
+		"method": map[string]interface{}{
+			"name": "copy-image",
+		},
+		"stores":                  stores,
+		"all_stores_must_succeed": true,
+	}
+	_, err := b.imgClient.Post(b.imgClient.ServiceURL("images", imageID, "import"), body, nil, &gophercloud.RequestOpts{
+		OkCodes: []int{202},
+	})
+	if err != nil {
+		logWithFields.Error("failed to copy image to the stores")
+		return fmt.Errorf("failed to copy image %v to the %q stores: %w", imageID, stores, err)
+	}
+
+	err = utils.WaitForStatus([]string{"copied"}, b.imageTimeout, b.pollInterval, func() (string, error) {
+		current, err := images.Get(b.imgClient, imageID).Extract()
+		if err != nil {
+			return "", err
+		}
+		failed, _ := current.Properties["os_glance_failed_import"].(string)
+		for _, store := range stores {
+			if utils.SliceContains(strings.Split(failed, ","), store) {
+				return "", fmt.Errorf("image import to the %q store failed", store)
+			}
+			if !utils.SliceContains(imageStores(current), store) {
+				return "copying", nil
+			}
+		}
+		return "copied", nil
+	})
+	if err != nil {
+		logWithFields.Error("image wasn't copied to the stores within the time limit")
+		return fmt.Errorf("image %v wasn't copied to the %q stores within the time limit: %w", imageID, stores, err)
+	}
+	logWithFields.Info("Image was copied to the stores")
+
+	return nil
+}
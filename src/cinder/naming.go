@@ -0,0 +1,144 @@
+package cinder
+
+import (
+	"fmt"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/backups"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/snapshots"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	veleroclient "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned"
+)
+
+var (
+	// pending statuses of resources, which are still being created and can be
+	// reused by a retried backup
+	pendingVolumeStatuses   = []string{"creating"}
+	pendingSnapshotStatuses = []string{"creating"}
+	pendingBackupStatuses   = []string{"creating"}
+	pendingImageStatuses    = []string{"queued", "saving", "uploading", "importing"}
+)
+
+// findSnapshotByName returns a pending or available snapshot of the volume with
+// the given name, or nil when there is none
+func (b *BlockStore) findSnapshotByName(name, volumeID string) (*snapshots.Snapshot, error) {
+	pages, err := snapshots.List(b.client, snapshots.ListOpts{Name: name, VolumeID: volumeID}).AllPages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %v snapshots: %w", name, err)
+	}
+	allSnapshots, err := snapshots.ExtractSnapshots(pages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract %v snapshots: %w", name, err)
+	}
+	for i, s := range allSnapshots {
+		if s.Name == name && (utils.SliceContains(snapshotStatuses, s.Status) || utils.SliceContains(pendingSnapshotStatuses, s.Status)) {
+			return &allSnapshots[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// findVolumeByName returns a pending or available volume of the client project
+// with the given name, or nil when there is none
+func (b *BlockStore) findVolumeByName(client *gophercloud.ServiceClient, name string) (*volumes.Volume, error) {
+	pages, err := volumes.List(client, volumes.ListOpts{Name: name}).AllPages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %v volumes: %w", name, err)
+	}
+	allVolumes, err := volumes.ExtractVolumes(pages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract %v volumes: %w", name, err)
+	}
+	for i, v := range allVolumes {
+		if v.Name == name && (utils.SliceContains(volumeStatuses, v.Status) || utils.SliceContains(pendingVolumeStatuses, v.Status)) {
+			return &allVolumes[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// findRestoredVolume returns the ID of the volume with the given name created
+// by a previous attempt of the restore, and whether the volume was already
+// transferred into the project of the transferCloud. A pending volume is
+// awaited. An empty ID is returned, when there is no such volume.
+func (b *BlockStore) findRestoredVolume(name string) (string, bool, error) {
+	logWithFields := b.log.WithField("volumeName", name)
+	if b.transferClient != nil {
+		volume, err := b.findVolumeByName(b.transferClient, name)
+		if err != nil {
+			return "", false, err
+		}
+		if volume != nil {
+			logWithFields.WithField("volumeID", volume.ID).Info("Reusing the transferred volume of the retried restore")
+			return volume.ID, true, nil
+		}
+	}
+
+	volume, err := b.findVolumeByName(b.client, name)
+	if err != nil || volume == nil {
+		return "", false, err
+	}
+	logWithFields = logWithFields.WithField("volumeID", volume.ID)
+	logWithFields.Info("Reusing the volume of the retried restore")
+
+	_, err = b.waitForVolumeStatus(volume.ID, volumeStatuses, b.volumeTimeout)
+	if err != nil {
+		logWithFields.Error("volume didn't get into 'available' state within the time limit")
+		return "", false, fmt.Errorf("volume %v didn't get into 'available' state within the time limit: %w", volume.ID, err)
+	}
+	return volume.ID, false, nil
+}
+
+// findBackupByName returns a pending or available backup of the volume with the
+// given name, or nil when there is none
+func (b *BlockStore) findBackupByName(name, volumeID string) (*backups.Backup, error) {
+	pages, err := backups.ListDetail(b.client, backupListOpts{Name: name, VolumeID: volumeID}).AllPages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %v backups: %w", name, err)
+	}
+	allBackups, err := backups.ExtractBackups(pages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract %v backups: %w", name, err)
+	}
+	for i, v := range allBackups {
+		if v.Name == name && (utils.SliceContains(backupStatuses, v.Status) || utils.SliceContains(pendingBackupStatuses, v.Status)) {
+			return &allBackups[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// findImageByName returns a pending or active image with the given name, or nil
+// when there is none
+func (b *BlockStore) findImageByName(name string) (*images.Image, error) {
+	pages, err := images.List(b.imgClient, images.ListOpts{Name: name}).AllPages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %v images: %w", name, err)
+	}
+	allImages, err := images.ExtractImages(pages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract %v images: %w", name, err)
+	}
+	for i, v := range allImages {
+		status := string(v.Status)
+		if v.Name == name && (utils.SliceContains(imageStatuses, status) || utils.SliceContains(pendingImageStatuses, status)) {
+			return &allImages[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// getVeleroClient returns the Velero client of the cluster, where the
+// volumes are backed up
+func (b *BlockStore) getVeleroClient() (veleroclient.Interface, error) {
+	if b.veleroClient == nil {
+		client, err := utils.NewVeleroClient()
+		if err != nil {
+			return nil, err
+		}
+		b.veleroClient = client
+	}
+	return b.veleroClient, nil
+}
@@ -0,0 +1,186 @@
+package cinder
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/backups"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/snapshots"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+// a description of the intermediate snapshots
+const tempSnapshotDesc = "Velero temp snapshot"
+
+// CollectOrphans finds Cinder snapshots, clones and backups and Glance images
+// created by the plugin of the Velero installation, which don't belong to any
+// existing Velero backup. Restored volumes belong to the restored workloads
+// and are never collected.
+func (b *BlockStore) CollectOrphans(c *utils.OrphanCollector) error {
+	for _, collect := range []func(*utils.OrphanCollector) error{
+		b.collectOrphanedSnapshots,
+		b.collectOrphanedVolumes,
+		b.collectOrphanedBackups,
+		b.collectOrphanedImages,
+	} {
+		if err := collect(c); err != nil {
+			return utils.WithRequestID(err)
+		}
+	}
+	return nil
+}
+
+func (b *BlockStore) collectOrphanedSnapshots(c *utils.OrphanCollector) error {
+	pages, err := snapshots.List(b.client, snapshots.ListOpts{}).AllPages()
+	if err != nil {
+		return fmt.Errorf("failed to list volume snapshots: %w", err)
+	}
+	allSnapshots, err := snapshots.ExtractSnapshots(pages)
+	if err != nil {
+		return fmt.Errorf("failed to extract volume snapshots: %w", err)
+	}
+
+	for _, snapshot := range allSnapshots {
+		if !c.Expired(snapshot.CreatedAt) || !c.Owned(snapshot.Metadata) {
+			continue
+		}
+		orphan := utils.Orphan{
+			Service: "cinder",
+			Kind:    "snapshot",
+			ID:      snapshot.ID,
+			Name:    snapshot.Name,
+			Backup:  snapshot.Metadata[utils.BackupTag],
+		}
+		switch {
+		case snapshot.Description == tempSnapshotDesc:
+			orphan.Reason = "intermediate snapshot wasn't deleted"
+		case strings.Contains(snapshot.Name, ".snap.") && !c.BackupExists(orphan.Backup):
+			orphan.Reason = "backup doesn't exist"
+		default:
+			continue
+		}
+		id := snapshot.ID
+		c.Add(orphan, func() error { return b.deleteSnapshot(id) })
+	}
+
+	return nil
+}
+
+func (b *BlockStore) collectOrphanedVolumes(c *utils.OrphanCollector) error {
+	pages, err := volumes.List(b.client, volumes.ListOpts{}).AllPages()
+	if err != nil {
+		return fmt.Errorf("failed to list volumes: %w", err)
+	}
+	allVolumes, err := volumes.ExtractVolumes(pages)
+	if err != nil {
+		return fmt.Errorf("failed to extract volumes: %w", err)
+	}
+
+	for _, volume := range allVolumes {
+		// restored volumes keep the metadata of the backed up volume, but
+		// not the clone name
+		if !c.Expired(volume.CreatedAt) || !c.Owned(volume.Metadata) || !strings.Contains(volume.Name, ".clone.") {
+			continue
+		}
+		name := volume.Metadata[utils.BackupTag]
+		if c.BackupExists(name) {
+			continue
+		}
+		id := volume.ID
+		c.Add(utils.Orphan{
+			Service: "cinder",
+			Kind:    "volume",
+			ID:      volume.ID,
+			Name:    volume.Name,
+			Backup:  name,
+			Reason:  "backup doesn't exist",
+		}, func() error { return b.deleteClone(id) })
+	}
+
+	return nil
+}
+
+func (b *BlockStore) collectOrphanedBackups(c *utils.OrphanCollector) error {
+	pages, err := backups.ListDetail(b.client, backups.ListDetailOpts{}).AllPages()
+	if err != nil {
+		return fmt.Errorf("failed to list volume backups: %w", err)
+	}
+	allBackups, err := backups.ExtractBackups(pages)
+	if err != nil {
+		return fmt.Errorf("failed to extract volume backups: %w", err)
+	}
+
+	for _, backup := range allBackups {
+		if !c.Expired(backup.CreatedAt) || backup.Metadata == nil || !c.Owned(*backup.Metadata) {
+			continue
+		}
+		// backup names may be customized by the backupNameTemplate, the
+		// Velero backup name is kept in the metadata
+		name := (*backup.Metadata)[utils.BackupTag]
+		if name == "" || c.BackupExists(name) {
+			continue
+		}
+		id := backup.ID
+		c.Add(utils.Orphan{
+			Service: "cinder",
+			Kind:    "backup",
+			ID:      backup.ID,
+			Name:    backup.Name,
+			Backup:  name,
+			Reason:  "backup doesn't exist",
+		}, func() error { return b.deleteBackup(id) })
+	}
+
+	return nil
+}
+
+func (b *BlockStore) collectOrphanedImages(c *utils.OrphanCollector) error {
+	if b.imgClient == nil {
+		client, err := openstack.NewImageServiceV2(b.provider, gophercloud.EndpointOpts{
+			Region: b.region,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create glance image client: %w", err)
+		}
+		b.imgClient = client
+		b.imgRegionClients = make(map[string]*gophercloud.ServiceClient)
+	}
+
+	pages, err := images.List(b.imgClient, images.ListOpts{}).AllPages()
+	if err != nil {
+		return fmt.Errorf("failed to list volume images: %w", err)
+	}
+	allImages, err := images.ExtractImages(pages)
+	if err != nil {
+		return fmt.Errorf("failed to extract volume images: %w", err)
+	}
+
+	for _, image := range allImages {
+		// images keep the tags in the prefixed image properties
+		tags := make(map[string]string)
+		for key, value := range image.Properties {
+			if v, ok := value.(string); ok && strings.HasPrefix(key, imageTagPrefix) {
+				tags[strings.TrimPrefix(key, imageTagPrefix)] = v
+			}
+		}
+		name := tags[utils.BackupTag]
+		if !c.Expired(image.CreatedAt) || !c.Owned(tags) || name == "" || c.BackupExists(name) {
+			continue
+		}
+		id := image.ID
+		c.Add(utils.Orphan{
+			Service: "glance",
+			Kind:    "image",
+			ID:      image.ID,
+			Name:    image.Name,
+			Backup:  name,
+			Reason:  "backup doesn't exist",
+		}, func() error { return b.deleteImage(id) })
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package cinder
+
+import (
+	"fmt"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/quotasets"
+	"github.com/sirupsen/logrus"
+)
+
+// snapshotQuotaRequest returns the amount of Cinder resources, which are
+// required to create a snapshot of the volume using the snapshot method
+func (b *BlockStore) snapshotQuotaRequest(method string, size int) map[string]int {
+	switch method {
+	case "clone":
+		return map[string]int{"volumes": 1, "gigabytes": size}
+	case "backup":
+		request := map[string]int{"backups": 1, "backup_gigabytes": size}
+		if b.backupFromSnapshot {
+			// the intermediate snapshot
+			request["snapshots"] = 1
+			request["gigabytes"] = size
+		}
+		return request
+	case "image":
+		// images are stored in Glance
+		return nil
+	}
+	return map[string]int{"snapshots": 1, "gigabytes": size}
+}
+
+// checkSnapshotQuota checks the quota of a new snapshot of the volume using
+// the snapshot method. Resources reused by a retried backup are not checked,
+// so the retry isn't refused in a project at the quota.
+func (b *BlockStore) checkSnapshotQuota(method, volumeID string, size int) error {
+	return b.checkQuota(b.client, fmt.Sprintf("a %s of volume %v", method, volumeID), b.snapshotQuotaRequest(method, size))
+}
+
+// checkQuota refuses to create the resource, when the requested amount of
+// Cinder resources would exceed the quota of the client project reduced by
+// the quotaMargin. Quota usage is checked only, when quotaCheck is enabled.
+func (b *BlockStore) checkQuota(client *gophercloud.ServiceClient, resource string, request map[string]int) error {
+	if !b.quotaCheck || len(request) == 0 {
+		return nil
+	}
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"resource":    resource,
+		"request":     request,
+		"quotaMargin": b.quotaMargin,
+	})
+
+	projectID, err := utils.GetProjectID(client.ProviderClient)
+	if err != nil {
+		return fmt.Errorf("failed to check quota: %w", err)
+	}
+	logWithFields = logWithFields.WithField("projectID", projectID)
+	usage, err := quotasets.GetUsage(client, projectID).Extract()
+	if err != nil {
+		logWithFields.Error("failed to get quota usage")
+		return fmt.Errorf("failed to get project %v quota usage: %w", projectID, err)
+	}
+
+	quotaUsage := func(u quotasets.QuotaUsage) utils.QuotaUsage {
+		return utils.QuotaUsage{Limit: u.Limit, InUse: u.InUse, Reserved: u.Reserved}
+	}
+	err = utils.CheckQuota(map[string]utils.QuotaUsage{
+		"volumes":          quotaUsage(usage.Volumes),
+		"snapshots":        quotaUsage(usage.Snapshots),
+		"gigabytes":        quotaUsage(usage.Gigabytes),
+		"backups":          quotaUsage(usage.Backups),
+		"backup_gigabytes": quotaUsage(usage.BackupGigabytes),
+	}, request, b.quotaMargin)
+	if err != nil {
+		logWithFields.Error("project quota would be exceeded")
+		return fmt.Errorf("refusing to create %s in project %v: %w", resource, projectID, err)
+	}
+	logWithFields.Info("Project quota is sufficient")
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package cinder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/sirupsen/logrus"
+)
+
+// snapshot ID separator between the snapshot method and the ID of the
+// resource, e.g. "backup:0b0e5e3e-..."
+const snapshotMethodSeparator = ":"
+
+// capabilityStatusCodes are the HTTP status codes of the responses, when the
+// snapshot method isn't supported, e.g. a snapshot of an attached volume, a
+// forbidden volume upload or a missing API extension. A missing cinder-backup
+// service is reported by the "503 Service Unavailable" response code.
+var capabilityStatusCodes = []int{400, 403, 501}
+
+// formatSnapshotID returns the snapshot ID with the snapshot method, when
+// fallback methods are configured, so that the snapshot can be restored and
+// deleted by any snapshot location configuration
+func (b *BlockStore) formatSnapshotID(method, snapshotID string) string {
+	if snapshotID == "" || len(b.methods) < 2 {
+		return snapshotID
+	}
+	return method + snapshotMethodSeparator + snapshotID
+}
+
+// parseSnapshotID returns the snapshot method and the ID of the resource. IDs
+// without the snapshot method use the configured method. An error is
+// returned, when the snapshot method of the ID isn't supported by the cloud.
+func (b *BlockStore) parseSnapshotID(snapshotID string) (string, string, error) {
+	method, id, ok := strings.Cut(snapshotID, snapshotMethodSeparator)
+	if !ok || !utils.SliceContains(supportedMethods, method) {
+		return b.config["method"], snapshotID, nil
+	}
+	if err := b.methodErrors[method]; err != nil {
+		return "", "", fmt.Errorf("failed to set up the %q snapshot method of snapshot %v: %w", method, snapshotID, err)
+	}
+	return method, id, nil
+}
+
+// initMethods sets up the snapshot method and its fallback methods, and the
+// other supported methods, which restore and delete the snapshots with the
+// method prefixed IDs. The clients are set up only once, because the plugin
+// is called concurrently. A failed set up of a method, which isn't
+// configured, is returned when its snapshot is restored or deleted.
+func (b *BlockStore) initMethods() error {
+	b.methodErrors = make(map[string]error)
+	for _, method := range b.methods {
+		if err := b.initMethod(method); err != nil {
+			return err
+		}
+	}
+	for _, method := range supportedMethods {
+		if utils.SliceContains(b.methods, method) {
+			continue
+		}
+		if err := b.initMethod(method); err != nil {
+			b.log.WithField("method", method).WithError(err).Infof("The %q snapshot method is not supported, its snapshots cannot be restored or deleted", method)
+			b.methodErrors[method] = err
+		}
+	}
+	return nil
+}
+
+// initMethod sets the minimum supported Cinder microversion and creates the
+// clients required by the snapshot method
+func (b *BlockStore) initMethod(method string) error {
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"endpoint": b.client.Endpoint,
+		"region":   b.region,
+		"method":   method,
+	})
+
+	var err error
+	switch method {
+	case "image":
+		err = b.setCinderMicroversion(volumeImageMicroversion, "images")
+		if err != nil {
+			return err
+		}
+		logWithFields.Infof("Setting the supported %v microversion", b.client.Microversion)
+
+		b.imgClient, err = openstack.NewImageServiceV2(b.provider, gophercloud.EndpointOpts{
+			Region: b.region,
+		})
+		if err != nil {
+			return utils.WithRequestID(fmt.Errorf("failed to create glance image client: %w", err))
+		}
+		b.imgRegionClients = make(map[string]*gophercloud.ServiceClient)
+		for _, r := range b.imageCopyRegions {
+			if _, err = b.getImageRegionClient(r); err != nil {
+				return err
+			}
+		}
+
+		logWithFields.Info("Successfully created image service client")
+	case "backup":
+		err = b.setCinderMicroversion(volumeBackupMicroversion, "backups")
+		if err != nil {
+			return err
+		}
+		if b.backupAZ != "" {
+			err = b.setCinderMicroversion(volumeBackupAZMicroversion, "backup availability zones")
+			if err != nil {
+				return fmt.Errorf("backupAvailabilityZone config option is not supported: %w", err)
+			}
+		}
+		if b.backupRecordContainer != "" {
+			b.objClient, err = openstack.NewObjectStorageV1(b.provider, gophercloud.EndpointOpts{
+				Region: b.region,
+			})
+			if err != nil {
+				return utils.WithRequestID(fmt.Errorf("failed to create swift object storage client: %w", err))
+			}
+
+			logWithFields.Info("Successfully created object storage service client")
+		}
+		logWithFields.Infof("Setting the supported %v microversion", b.client.Microversion)
+	}
+
+	return nil
+}
+
+// isCapabilityError returns true, when the snapshot method failed, because
+// the volume or the cloud doesn't support the method
+func isCapabilityError(err error) bool {
+	if utils.IsServiceNotFound(err) {
+		return true
+	}
+	var statusErr gophercloud.StatusCodeError
+	if errors.As(err, &statusErr) {
+		for _, code := range capabilityStatusCodes {
+			if statusErr.GetStatusCode() == code {
+				return true
+			}
+		}
+		return false
+	}
+	// the resource got into the error state
+	var statusError utils.ErrStatus
+	return errors.As(err, &statusError)
+}
+
+// cleanupFailedSnapshot deletes the resource left by the failed snapshot
+// method, before the fallback method is tried
+func (b *BlockStore) cleanupFailedSnapshot(method, snapshotID string) {
+	if snapshotID == "" {
+		return
+	}
+	var err error
+	switch method {
+	case "clone":
+		err = b.deleteClone(snapshotID)
+	case "backup":
+		err = b.deleteBackup(snapshotID)
+	case "image":
+		err = b.deleteImage(snapshotID)
+	default:
+		err = b.deleteSnapshot(snapshotID)
+	}
+	if err != nil {
+		b.log.WithFields(logrus.Fields{
+			"snapshotID": snapshotID,
+			"method":     method,
+		}).WithError(err).Warn("failed to delete the resource of the failed snapshot method")
+	}
+}
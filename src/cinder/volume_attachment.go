@@ -0,0 +1,159 @@
+package cinder
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/volumeactions"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// snapshot metadata keys, which keep the volume type of a multi-attach
+	// volume and the read-only flag of a volume
+	multiattachVolumeTypeKey = "velero-plugin-for-openstack/multiattach-volume-type"
+	readonlyKey              = "velero-plugin-for-openstack/readonly"
+	// Cinder shows the read-only admin flag in the volume metadata
+	readonlyMetadataKey = "readonly"
+)
+
+// attachmentTags returns the tags extended with the attachment properties of
+// the volume, which are kept in the snapshot metadata. Multi-attach is a
+// property of the volume type, so the volume type is kept.
+func attachmentTags(volume *volumes.Volume, tags map[string]string) map[string]string {
+	attachment := map[string]string{}
+	if volume.Multiattach {
+		attachment[multiattachVolumeTypeKey] = volume.VolumeType
+	}
+	if isReadonly(volume) {
+		attachment[readonlyKey] = "true"
+	}
+	if len(attachment) == 0 {
+		return tags
+	}
+	return utils.Merge(tags, attachment)
+}
+
+// isReadonly returns true, when the volume read-only flag is set
+func isReadonly(volume *volumes.Volume) bool {
+	readonly, _ := strconv.ParseBool(volume.Metadata[readonlyMetadataKey])
+	return readonly
+}
+
+// restoreAttachment reapplies the attachment properties kept in the snapshot
+// metadata on the restored volume: a volume restored from a multi-attach
+// volume is retyped to a multi-attach volume type, when the restored volume
+// type isn't multi-attach, and the read-only flag is set
+func (b *BlockStore) restoreAttachment(volumeID string, tags map[string]string) error {
+	multiattachType := tags[multiattachVolumeTypeKey]
+	readonly := tags[readonlyKey] == "true"
+	if multiattachType == "" && !readonly {
+		return nil
+	}
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"volumeID":    volumeID,
+		"multiattach": multiattachType != "",
+		"readonly":    readonly,
+	})
+
+	if multiattachType != "" {
+		volume, err := volumes.Get(b.client, volumeID).Extract()
+		if err != nil {
+			logWithFields.Error("failed to get volume from cinder")
+			return fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err)
+		}
+		if b.multiattachVolumeType != "" {
+			multiattachType = b.multiattachVolumeType
+		}
+		if !volume.Multiattach && volume.VolumeType != multiattachType {
+			// a retype, which requires a migration to another backend,
+			// copies the whole volume and is allowed only on demand
+			policy := volumeactions.MigrationPolicyNever
+			if b.multiattachRetypeMigration {
+				policy = volumeactions.MigrationPolicyOnDemand
+			}
+			logWithFields.Infof("Retyping the restored volume to the %q multi-attach volume type with the %q migration policy", multiattachType, policy)
+			err = volumeactions.ChangeType(b.client, volumeID, volumeactions.ChangeTypeOpts{
+				NewType:         multiattachType,
+				MigrationPolicy: policy,
+			}).ExtractErr()
+			if err != nil {
+				logWithFields.Error("failed to retype volume")
+				return fmt.Errorf("failed to retype volume %v to the %q multi-attach volume type: %w", volumeID, multiattachType, err)
+			}
+			volume, err = b.waitForVolumeStatus(volumeID, volumeStatuses, b.volumeTimeout)
+			if err != nil {
+				logWithFields.Error("volume didn't get into 'available' state within the time limit")
+				return fmt.Errorf("volume %v didn't get into 'available' state within the time limit: %w", volumeID, err)
+			}
+		}
+		if !volume.Multiattach {
+			logWithFields.Warnf("Restored volume of the %q volume type is not multi-attach, set the multiattachVolumeType or multiattachRetypeMigration config option", volume.VolumeType)
+		}
+	}
+
+	if readonly {
+		_, err := b.client.Post(b.client.ServiceURL("volumes", volumeID, "action"), map[string]interface{}{
+			"os-update_readonly_flag": map[string]interface{}{"readonly": true},
+		}, nil, &gophercloud.RequestOpts{
+			OkCodes: []int{202},
+		})
+		if err != nil {
+			logWithFields.Error("failed to set volume read-only flag")
+			return fmt.Errorf("failed to set volume %v read-only flag: %w", volumeID, err)
+		}
+	}
+	logWithFields.Info("Restored volume attachment properties")
+
+	return nil
+}
+
+// setPersistentVolumeAccess keeps the persistent volume consistent with the
+// restored volume: the ReadWriteMany access mode requires a multi-attach
+// volume and a read-only volume is attached read-only
+func (b *BlockStore) setPersistentVolumeAccess(logWithFields *logrus.Entry, pv *v1.PersistentVolume, volumeID string) error {
+	volume, err := volumes.Get(b.restoreClient(), volumeID).Extract()
+	if err != nil {
+		logWithFields.Error("failed to get volume from cinder")
+		return fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err)
+	}
+
+	if !volume.Multiattach {
+		var modes []v1.PersistentVolumeAccessMode
+		for _, mode := range pv.Spec.AccessModes {
+			if mode == v1.ReadWriteMany {
+				logWithFields.Warn("Restored volume is not multi-attach, replacing the ReadWriteMany access mode with ReadWriteOnce")
+				mode = v1.ReadWriteOnce
+			}
+			if !accessModesContain(modes, mode) {
+				modes = append(modes, mode)
+			}
+		}
+		pv.Spec.AccessModes = modes
+	}
+
+	if isReadonly(volume) {
+		logWithFields.Info("Restored volume is read-only, setting the persistent volume read-only")
+		if pv.Spec.Cinder != nil {
+			pv.Spec.Cinder.ReadOnly = true
+		}
+		if pv.Spec.CSI != nil {
+			pv.Spec.CSI.ReadOnly = true
+		}
+	}
+
+	return nil
+}
+
+func accessModesContain(modes []v1.PersistentVolumeAccessMode, mode v1.PersistentVolumeAccessMode) bool {
+	for _, m := range modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package cinder
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumetypes"
+	"github.com/gophercloud/gophercloud/openstack/keymanager/v1/secrets"
+	"github.com/sirupsen/logrus"
+)
+
+// addEncryptionTags returns the tags extended with the encrypted flag, the
+// encryption key ID, the encryption type and the volume type of an encrypted
+// volume, which are kept in the snapshot metadata. The encryption type is
+// omitted, when the volume type encryption is not accessible by the user.
+func (b *BlockStore) addEncryptionTags(volume *volumes.Volume, tags map[string]string) (map[string]string, error) {
+	volumeID := volume.ID
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"volumeID": volumeID,
+	})
+
+	if !volume.Encrypted {
+		return tags, nil
+	}
+	logWithFields = logWithFields.WithField("volumeType", volume.VolumeType)
+
+	encryptionTags := map[string]string{
+		encryptedKey:            "true",
+		encryptionVolumeTypeKey: volume.VolumeType,
+	}
+	encryption, err := b.getVolumeTypeEncryption(volume.VolumeType)
+	switch {
+	case isForbidden(err):
+		// the volume type encryption is shown only to admins
+		logWithFields.Warnf("The volume type encryption is not accessible by the authenticated user, the encryption type can't be validated on restore: %v", utils.WithRequestID(err))
+	case err != nil:
+		logWithFields.Error("failed to get volume type encryption")
+		return nil, err
+	default:
+		encryptionTags[encryptionTypeKey] = encryption
+	}
+
+	// encryption key IDs are shown since the 3.64 microversion
+	mv, err := b.getCinderMicroversion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain supported Cinder microversions: %w", err)
+	}
+	ok, err := utils.CompareMicroversions("lte", volumeEncryptionKeyMicroversion, mv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare supported Cinder microversions: %v", err)
+	}
+	if ok {
+		client := *b.client
+		client.Microversion = volumeEncryptionKeyMicroversion
+		var res struct {
+			EncryptionKeyID string `json:"encryption_key_id"`
+		}
+		err = volumes.Get(&client, volumeID).ExtractInto(&res)
+		if err != nil {
+			logWithFields.Error("failed to get volume encryption key ID")
+			return nil, fmt.Errorf("failed to get volume %v encryption key ID: %w", volumeID, err)
+		}
+		encryptionTags[encryptionKeyIDKey] = res.EncryptionKeyID
+	} else {
+		logWithFields.Warnf("The %v Cinder microversion doesn't show encryption key IDs, the encryption key can't be validated on restore", mv)
+	}
+	logWithFields.WithFields(logrus.Fields{
+		"encryptionType":  encryption,
+		"encryptionKeyID": encryptionTags[encryptionKeyIDKey],
+	}).Info("Volume is encrypted")
+
+	return utils.Merge(tags, encryptionTags), nil
+}
+
+// validateEncryption makes sure the encrypted volume can be restored from the
+// snapshot: the target volume type must have the same encryption type and the
+// encryption key must be accessible
+func (b *BlockStore) validateEncryption(method, snapshotID, volumeType string, tags map[string]string) error {
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"snapshotID": snapshotID,
+		"volumeType": volumeType,
+	})
+
+	// the encryption type is missing, when the volume type encryption wasn't
+	// accessible during the backup
+	encryption := tags[encryptionTypeKey]
+	if encryption == "" && tags[encryptedKey] != "true" {
+		return nil
+	}
+	logWithFields = logWithFields.WithFields(logrus.Fields{
+		"encryptionType":  encryption,
+		"encryptionKeyID": tags[encryptionKeyIDKey],
+	})
+
+	if volumeType == "" {
+		if method == "backup" || method == "image" {
+			return fmt.Errorf("snapshot %v of an encrypted volume requires an encrypted target volume type, set the defaultVolumeType or volumeTypeMapping config option", snapshotID)
+		}
+		// volumes created from snapshots and clones keep the volume type
+		volumeType = tags[encryptionVolumeTypeKey]
+	}
+	targetEncryption, err := b.getVolumeTypeEncryption(volumeType)
+	switch {
+	case isForbidden(err):
+		logWithFields.Warnf("The volume type encryption is not accessible by the authenticated user, skipping the encryption type validation: %v", utils.WithRequestID(err))
+	case err != nil:
+		return err
+	case targetEncryption == "":
+		logWithFields.Error("target volume type is not encrypted")
+		return fmt.Errorf("snapshot %v of an encrypted volume cannot be restored into the %q volume type, which is not encrypted, map the %q volume type to an encrypted volume type using the volumeTypeMapping config option", snapshotID, volumeType, tags[encryptionVolumeTypeKey])
+	case encryption == "":
+		logWithFields.Warn("Encryption type wasn't recorded, skipping the encryption type validation")
+	case targetEncryption != encryption:
+		logWithFields.Error("target volume type encryption type doesn't match")
+		return fmt.Errorf("snapshot %v encrypted with the %q encryption type cannot be restored into the %q volume type with the %q encryption type", snapshotID, encryption, volumeType, targetEncryption)
+	}
+
+	keyID := tags[encryptionKeyIDKey]
+	if keyID == "" {
+		logWithFields.Warn("Encryption key ID wasn't recorded, skipping the encryption key validation")
+		return nil
+	}
+	client, err := b.getKeyManagerClient()
+	if err != nil {
+		return fmt.Errorf("cannot validate the %v encryption key of snapshot %v: %w", keyID, snapshotID, err)
+	}
+	_, err = secrets.Get(client, keyID).Extract()
+	if err != nil {
+		logWithFields.Error("encryption key is not accessible")
+		switch err.(type) {
+		case gophercloud.ErrDefault404:
+			return fmt.Errorf("encryption key %v of snapshot %v doesn't exist in Barbican, the encrypted volume cannot be restored: %w", keyID, snapshotID, err)
+		case gophercloud.ErrDefault403:
+			return fmt.Errorf("encryption key %v of snapshot %v is not accessible by the authenticated user, grant the user access to the Barbican secret: %w", keyID, snapshotID, err)
+		}
+		return fmt.Errorf("failed to get encryption key %v of snapshot %v: %w", keyID, snapshotID, err)
+	}
+	logWithFields.Info("Encryption key is accessible")
+
+	return nil
+}
+
+// getVolumeTypeEncryption returns the "provider/cipher/key size" encryption
+// type of the volume type or an empty string, when the volume type is not
+// encrypted
+func (b *BlockStore) getVolumeTypeEncryption(volumeType string) (string, error) {
+	allPages, err := volumetypes.List(b.client, volumetypes.ListOpts{}).AllPages()
+	if err != nil {
+		return "", fmt.Errorf("failed to list volume types: %w", err)
+	}
+	allTypes, err := volumetypes.ExtractVolumeTypes(allPages)
+	if err != nil {
+		return "", fmt.Errorf("failed to extract volume types: %w", err)
+	}
+	volumeTypeID := ""
+	for _, t := range allTypes {
+		if t.Name == volumeType || t.ID == volumeType {
+			volumeTypeID = t.ID
+			break
+		}
+	}
+	if volumeTypeID == "" {
+		return "", fmt.Errorf("%q volume type doesn't exist", volumeType)
+	}
+
+	encryption, err := volumetypes.GetEncryption(b.client, volumeTypeID).Extract()
+	if err != nil {
+		return "", fmt.Errorf("failed to get %q volume type encryption: %w", volumeType, err)
+	}
+	if encryption.Provider == "" {
+		return "", nil
+	}
+	return fmt.Sprintf("%s/%s/%d", encryption.Provider, encryption.Cipher, encryption.KeySize), nil
+}
+
+// isForbidden returns true, when the API call was refused, because the
+// authenticated user is not allowed to call it, e.g. admin-only APIs
+func isForbidden(err error) bool {
+	var forbidden gophercloud.ErrDefault403
+	return errors.As(err, &forbidden)
+}
+
+// getKeyManagerClient lazily creates the Barbican client, which is required
+// only to restore encrypted volumes
+func (b *BlockStore) getKeyManagerClient() (*gophercloud.ServiceClient, error) {
+	if b.kmClient == nil {
+		client, err := openstack.NewKeyManagerV1(b.provider, gophercloud.EndpointOpts{
+			Region: b.region,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create barbican key manager client: %w", err)
+		}
+		b.kmClient = client
+	}
+	return b.kmClient, nil
+}
@@ -0,0 +1,625 @@
+package cinder
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/snapshots"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/pagination"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// gophercloud doesn't support generic volume groups, therefore the group and
+// group snapshot API calls are implemented here
+
+// a description of the volume groups of the backups, which are deleted
+// together with their group snapshot
+const volumeGroupDescription = "Velero volume group"
+
+// active group and group snapshot statuses
+var groupStatuses = []string{
+	"available",
+}
+
+// group snapshot statuses, which are reused by a retried backup
+var pendingGroupSnapshotStatuses = []string{
+	"creating",
+	"available",
+}
+
+// groupVolume contains volume fields related to generic volume groups
+type groupVolume struct {
+	ID               string            `json:"id"`
+	VolumeType       string            `json:"volume_type"`
+	AvailabilityZone string            `json:"availability_zone"`
+	GroupID          string            `json:"group_id"`
+	Size             int               `json:"size"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+// volumeGroup is a Cinder generic volume group
+type volumeGroup struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+}
+
+// groupSnapshot is a Cinder group snapshot
+type groupSnapshot struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	GroupID string `json:"group_id"`
+}
+
+// groupMemberSnapshot contains snapshot fields related to group snapshots
+type groupMemberSnapshot struct {
+	ID              string            `json:"id"`
+	VolumeID        string            `json:"volume_id"`
+	Status          string            `json:"status"`
+	GroupSnapshotID string            `json:"group_snapshot_id"`
+	Metadata        map[string]string `json:"metadata"`
+}
+
+// groupListOpts filters groups and group snapshots
+type groupListOpts struct {
+	Name    string `q:"name"`
+	GroupID string `q:"group_id"`
+}
+
+// createGroupSnapshot returns the volume snapshot from the group snapshot of
+// the volume group of the persistent volume, which is created once per Velero
+// backup. The group volumes join a volume group of the backup only until the
+// group snapshot is taken, so the group never blocks the volume deletion.
+// False is returned, when the persistent volume doesn't have the
+// volumeGroupKey label or annotation or the group snapshot doesn't contain
+// the volume.
+func (b *BlockStore) createGroupSnapshot(logWithFields *logrus.Entry, volumeID string, tags map[string]string) (string, bool, error) {
+	groupName, err := b.persistentVolumeGroupName(tags[utils.PVTag])
+	if err != nil {
+		logWithFields.WithError(err).Warn("Failed to get the volume group of the persistent volume, the volume will be snapshotted individually")
+		return "", false, nil
+	}
+	if groupName == "" {
+		return "", false, nil
+	}
+	if tags[utils.BackupUIDTag] == "" {
+		logWithFields.Warn("Backup UID is unknown, the volume will be snapshotted individually")
+		return "", false, nil
+	}
+
+	b.groupMu.Lock()
+	defer b.groupMu.Unlock()
+
+	// the group and the group snapshot are named after the backup UID, so the
+	// other group volumes of the backup and a retried backup find them
+	name := utils.ResourceName(groupName, "group", tags[utils.BackupUIDTag])
+	logWithFields = logWithFields.WithFields(logrus.Fields{
+		"volumeGroupName":   groupName,
+		"groupSnapshotName": name,
+	})
+
+	var allGroupSnapshots []groupSnapshot
+	err = b.listAll(b.client.ServiceURL("group_snapshots", "detail"), groupListOpts{Name: name}, "group_snapshots", &allGroupSnapshots)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to list %s group snapshots: %w", name, err)
+	}
+	var gs *groupSnapshot
+	for i := range allGroupSnapshots {
+		if allGroupSnapshots[i].Name == name && utils.SliceContains(pendingGroupSnapshotStatuses, allGroupSnapshots[i].Status) {
+			gs = &allGroupSnapshots[i]
+			break
+		}
+	}
+
+	if gs == nil {
+		volumeIDs, err := b.groupVolumeIDs(groupName)
+		if err != nil {
+			return "", false, err
+		}
+		if !utils.SliceContains(volumeIDs, volumeID) {
+			volumeIDs = append(volumeIDs, volumeID)
+		}
+		gs, err = b.snapshotVolumeGroup(logWithFields, name, volumeIDs)
+		if err != nil {
+			return "", false, err
+		}
+	}
+	logWithFields = logWithFields.WithFields(logrus.Fields{
+		"groupID":         gs.GroupID,
+		"groupSnapshotID": gs.ID,
+	})
+
+	_, err = b.waitForGroupSnapshotStatus(gs.ID, groupStatuses, b.snapshotTimeout)
+	// the volumes leave the group as soon as the group snapshot is taken
+	releaseErr := b.releaseVolumeGroup(logWithFields, gs.GroupID)
+	if err != nil {
+		logWithFields.Error("group snapshot didn't get into 'available' state within the time limit")
+		return "", false, fmt.Errorf("group snapshot %v didn't get into 'available' state within the time limit: %w", gs.ID, err)
+	}
+	if releaseErr != nil {
+		return "", false, releaseErr
+	}
+
+	members, err := b.listGroupMemberSnapshots(volumeID, "")
+	if err != nil {
+		return "", false, err
+	}
+	var member *groupMemberSnapshot
+	for i := range members {
+		if members[i].GroupSnapshotID == gs.ID {
+			member = &members[i]
+			break
+		}
+	}
+	if member == nil {
+		logWithFields.Warningf("Group snapshot %s doesn't contain the volume, the volume will be snapshotted individually", gs.ID)
+		return "", false, nil
+	}
+
+	_, err = b.waitForSnapshotStatus(member.ID, snapshotStatuses, b.snapshotTimeout)
+	if err != nil {
+		logWithFields.Error("snapshot didn't get into 'available' state within the time limit")
+		return "", false, fmt.Errorf("snapshot %v didn't get into 'available' state within the time limit: %w", member.ID, err)
+	}
+
+	// group snapshot members are created without metadata
+	volume, err := b.getGroupVolume(volumeID)
+	if err != nil {
+		return "", false, err
+	}
+	opts := snapshots.UpdateMetadataOpts{
+		Metadata: toInterfaceMap(utils.Merge(volume.Metadata, tags)),
+	}
+	_, err = snapshots.UpdateMetadata(b.client, member.ID, opts).ExtractMetadata()
+	if err != nil {
+		logWithFields.Error("failed to update snapshot metadata")
+		return "", false, fmt.Errorf("failed to update snapshot %v metadata: %w", member.ID, err)
+	}
+
+	logWithFields.WithFields(logrus.Fields{
+		"snapshotID": member.ID,
+	}).Info("Group snapshot finished successfuly")
+	return member.ID, true, nil
+}
+
+// snapshotVolumeGroup adds the volumes into the volume group of the backup
+// and creates the group snapshot. The group is created with the volume types
+// of all its volumes and it is deleted, when the group snapshot cannot be
+// created.
+func (b *BlockStore) snapshotVolumeGroup(logWithFields *logrus.Entry, name string, volumeIDs []string) (gs *groupSnapshot, err error) {
+	logWithFields = logWithFields.WithField("volumeIDs", volumeIDs)
+
+	var volumeTypes []string
+	var volumeAZ string
+	var size int
+	for _, volumeID := range volumeIDs {
+		volume, err := b.getGroupVolume(volumeID)
+		if err != nil {
+			logWithFields.Error("failed to get volume from cinder")
+			return nil, err
+		}
+		if volumeAZ == "" {
+			volumeAZ = volume.AvailabilityZone
+		}
+		if volume.AvailabilityZone != volumeAZ {
+			logWithFields.Error("volume group volumes are in different availability zones")
+			return nil, fmt.Errorf("%s volume group volumes are in different availability zones: %v and %v", name, volumeAZ, volume.AvailabilityZone)
+		}
+		if volume.GroupID != "" {
+			logWithFields.Error("volume already belongs to a volume group")
+			return nil, fmt.Errorf("volume %v already belongs to the %v group", volumeID, volume.GroupID)
+		}
+		if !utils.SliceContains(volumeTypes, volume.VolumeType) {
+			volumeTypes = append(volumeTypes, volume.VolumeType)
+		}
+		size += volume.Size
+	}
+	err = b.checkQuota(b.client, fmt.Sprintf("a group snapshot of the %s volume group", name), map[string]int{
+		"snapshots": len(volumeIDs),
+		"gigabytes": size,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logWithFields.WithField("volumeTypes", volumeTypes).Info("Creating a volume group")
+	body := map[string]interface{}{
+		"group": map[string]interface{}{
+			"name":              name,
+			"description":       volumeGroupDescription,
+			"group_type":        b.volumeGroupType,
+			"volume_types":      volumeTypes,
+			"availability_zone": volumeAZ,
+		},
+	}
+	var res struct {
+		Group volumeGroup `json:"group"`
+	}
+	_, err = b.client.Post(b.client.ServiceURL("groups"), body, &res, &gophercloud.RequestOpts{
+		OkCodes: []int{202},
+	})
+	if err != nil {
+		logWithFields.Error("failed to create volume group")
+		return nil, fmt.Errorf("failed to create %s volume group: %w", name, err)
+	}
+	groupID := res.Group.ID
+	logWithFields = logWithFields.WithField("groupID", groupID)
+	defer func() {
+		if err != nil {
+			b.deleteVolumeGroup(logWithFields, groupID)
+		}
+	}()
+
+	logWithFields.Info("Adding volumes to the volume group")
+	if err = b.updateGroupVolumes(groupID, "add_volumes", volumeIDs); err != nil {
+		logWithFields.Error("failed to add volumes to the volume group")
+		return nil, err
+	}
+	// volumes are added asynchronously
+	for _, volumeID := range volumeIDs {
+		volume, err := b.getGroupVolume(volumeID)
+		if err != nil {
+			logWithFields.Error("failed to get volume from cinder")
+			return nil, err
+		}
+		if volume.GroupID != groupID {
+			logWithFields.Error("volume didn't join the volume group")
+			return nil, fmt.Errorf("volume %v didn't join the %v volume group", volumeID, groupID)
+		}
+	}
+
+	logWithFields.Info("Creating a group snapshot")
+	body = map[string]interface{}{
+		"group_snapshot": map[string]interface{}{
+			"group_id":    groupID,
+			"name":        name,
+			"description": "Velero group snapshot",
+		},
+	}
+	var snapshotRes struct {
+		GroupSnapshot groupSnapshot `json:"group_snapshot"`
+	}
+	_, err = b.client.Post(b.client.ServiceURL("group_snapshots"), body, &snapshotRes, &gophercloud.RequestOpts{
+		OkCodes: []int{202},
+	})
+	if err != nil {
+		logWithFields.Error("failed to create group snapshot")
+		return nil, fmt.Errorf("failed to create group snapshot of the %v volume group: %w", groupID, err)
+	}
+
+	return &snapshotRes.GroupSnapshot, nil
+}
+
+// releaseVolumeGroup removes all the volumes from the volume group
+func (b *BlockStore) releaseVolumeGroup(logWithFields *logrus.Entry, groupID string) error {
+	var members []groupVolume
+	err := b.listAll(b.client.ServiceURL("volumes", "detail"), groupListOpts{GroupID: groupID}, "volumes", &members)
+	if err != nil {
+		logWithFields.Error("failed to list volume group volumes")
+		return fmt.Errorf("failed to list %v volume group volumes: %w", groupID, err)
+	}
+	var volumeIDs []string
+	for _, member := range members {
+		if member.GroupID == groupID {
+			volumeIDs = append(volumeIDs, member.ID)
+		}
+	}
+	if len(volumeIDs) == 0 {
+		return nil
+	}
+
+	logWithFields.WithField("volumeIDs", volumeIDs).Info("Removing volumes from the volume group")
+	err = b.updateGroupVolumes(groupID, "remove_volumes", volumeIDs)
+	if err != nil {
+		logWithFields.Error("failed to remove volumes from the volume group")
+		return err
+	}
+	return nil
+}
+
+// deleteVolumeGroup removes the volumes from the volume group created by the
+// plugin and deletes the group. Groups, which were not created by the plugin,
+// are kept.
+func (b *BlockStore) deleteVolumeGroup(logWithFields *logrus.Entry, groupID string) {
+	var res struct {
+		Group volumeGroup `json:"group"`
+	}
+	_, err := b.client.Get(b.client.ServiceURL("groups", groupID), &res, nil)
+	if err != nil {
+		if _, ok := err.(gophercloud.ErrDefault404); !ok {
+			logWithFields.Warningf("Failed to get the volume group: %v", utils.WithRequestID(err))
+		}
+		return
+	}
+	if res.Group.Description != volumeGroupDescription {
+		return
+	}
+
+	if err := b.releaseVolumeGroup(logWithFields, groupID); err != nil {
+		logWithFields.Warningf("Failed to remove volumes from the volume group: %v", utils.WithRequestID(err))
+		return
+	}
+	logWithFields.Info("Deleting the volume group")
+	body := map[string]interface{}{
+		"delete": map[string]interface{}{
+			"delete-volumes": false,
+		},
+	}
+	_, err = b.client.Post(b.client.ServiceURL("groups", groupID, "action"), body, nil, &gophercloud.RequestOpts{
+		OkCodes: []int{202},
+	})
+	if err != nil {
+		logWithFields.Warningf("Failed to delete the volume group: %v", utils.WithRequestID(err))
+	}
+}
+
+// updateGroupVolumes adds or removes the group volumes and waits for the group
+// to get into the available status
+func (b *BlockStore) updateGroupVolumes(groupID, action string, volumeIDs []string) error {
+	// Make sure the group is in available status
+	_, err := b.waitForGroupStatus(groupID, groupStatuses, b.volumeTimeout)
+	if err != nil {
+		return fmt.Errorf("volume group %v didn't get into 'available' state within the time limit: %w", groupID, err)
+	}
+
+	body := map[string]interface{}{
+		"group": map[string]interface{}{
+			action: strings.Join(volumeIDs, ","),
+		},
+	}
+	_, err = b.client.Put(b.client.ServiceURL("groups", groupID), body, nil, &gophercloud.RequestOpts{
+		OkCodes: []int{202},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update %v volume group volumes %v: %w", groupID, volumeIDs, err)
+	}
+
+	_, err = b.waitForGroupStatus(groupID, groupStatuses, b.volumeTimeout)
+	if err != nil {
+		return fmt.Errorf("volume group %v didn't get into 'available' state within the time limit: %w", groupID, err)
+	}
+
+	return nil
+}
+
+// persistentVolumeGroupName returns the name of the volume group of the
+// persistent volume or an empty string, when the volume doesn't belong to a
+// volume group
+func (b *BlockStore) persistentVolumeGroupName(pvName string) (string, error) {
+	if pvName == "" {
+		return "", nil
+	}
+	client, err := b.getKubeClient()
+	if err != nil {
+		return "", err
+	}
+	pv, err := client.CoreV1().PersistentVolumes().Get(context.TODO(), pvName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s persistent volume: %w", pvName, err)
+	}
+	return b.volumeGroupName(pv), nil
+}
+
+// groupVolumeIDs returns the Cinder volume IDs of the persistent volumes of
+// the volume group
+func (b *BlockStore) groupVolumeIDs(groupName string) ([]string, error) {
+	client, err := b.getKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	pvs, err := client.CoreV1().PersistentVolumes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volumes: %w", err)
+	}
+	var volumeIDs []string
+	for i := range pvs.Items {
+		volumeID := persistentVolumeID(&pvs.Items[i])
+		if volumeID != "" && b.volumeGroupName(&pvs.Items[i]) == groupName {
+			volumeIDs = append(volumeIDs, volumeID)
+		}
+	}
+	return volumeIDs, nil
+}
+
+// volumeGroupName returns the name of the volume group of the persistent
+// volume or an empty string, when the volume doesn't have the volumeGroupKey
+// label or annotation
+func (b *BlockStore) volumeGroupName(pv *v1.PersistentVolume) string {
+	value, ok := pv.Labels[b.volumeGroupKey]
+	if !ok {
+		value = pv.Annotations[b.volumeGroupKey]
+	}
+	if value == "" {
+		return ""
+	}
+
+	if pv.Spec.ClaimRef != nil && pv.Spec.ClaimRef.Namespace != "" {
+		return "velero-" + pv.Spec.ClaimRef.Namespace + "-" + value
+	}
+	return "velero-" + value
+}
+
+// deleteGroupSnapshot marks the group snapshot member to be deleted and
+// deletes the group snapshot, when all its members are marked. Group snapshot
+// members cannot be deleted individually.
+func (b *BlockStore) deleteGroupSnapshot(logWithFields *logrus.Entry, snapshot *groupMemberSnapshot) error {
+	b.groupMu.Lock()
+	defer b.groupMu.Unlock()
+
+	logWithFields = logWithFields.WithField("groupSnapshotID", snapshot.GroupSnapshotID)
+	opts := snapshots.UpdateMetadataOpts{
+		Metadata: toInterfaceMap(utils.Merge(snapshot.Metadata, map[string]string{deletePendingKey: "true"})),
+	}
+	_, err := snapshots.UpdateMetadata(b.client, snapshot.ID, opts).ExtractMetadata()
+	if err != nil {
+		logWithFields.Error("failed to mark snapshot to be deleted")
+		return fmt.Errorf("failed to mark snapshot %v to be deleted: %w", snapshot.ID, err)
+	}
+
+	// snapshots cannot be filtered by the group snapshot ID
+	members, err := b.listGroupMemberSnapshots("", snapshot.GroupSnapshotID)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if member.ID != snapshot.ID && member.Metadata[deletePendingKey] != "true" {
+			logWithFields.Info("Snapshot is marked to be deleted together with the group snapshot")
+			return nil
+		}
+	}
+
+	var res struct {
+		GroupSnapshot groupSnapshot `json:"group_snapshot"`
+	}
+	_, err = b.client.Get(b.client.ServiceURL("group_snapshots", snapshot.GroupSnapshotID), &res, nil)
+	if err != nil {
+		if _, ok := err.(gophercloud.ErrDefault404); ok {
+			logWithFields.Info("group snapshot is already deleted")
+			return nil
+		}
+		logWithFields.Error("failed to get group snapshot")
+		return fmt.Errorf("failed to get group snapshot %v: %w", snapshot.GroupSnapshotID, err)
+	}
+	logWithFields = logWithFields.WithField("groupID", res.GroupSnapshot.GroupID)
+
+	logWithFields.Info("Deleting the group snapshot")
+	_, err = b.client.Delete(b.client.ServiceURL("group_snapshots", snapshot.GroupSnapshotID), nil)
+	if err != nil {
+		if _, ok := err.(gophercloud.ErrDefault404); ok {
+			logWithFields.Info("group snapshot is already deleted")
+			return nil
+		}
+		logWithFields.Error("failed to delete group snapshot")
+		return fmt.Errorf("failed to delete group snapshot %v: %w", snapshot.GroupSnapshotID, err)
+	}
+
+	// the volume group of the backup can be deleted only after its group
+	// snapshot is deleted
+	logWithFields.Info("waiting for the group snapshot to be deleted")
+	_, err = b.waitForGroupSnapshotStatus(snapshot.GroupSnapshotID, []string{"deleted"}, b.snapshotTimeout)
+	if err != nil {
+		return fmt.Errorf("group snapshot %v wasn't deleted within the time limit: %w", snapshot.GroupSnapshotID, err)
+	}
+	b.deleteVolumeGroup(logWithFields, res.GroupSnapshot.GroupID)
+
+	return nil
+}
+
+func toInterfaceMap(m map[string]string) map[string]interface{} {
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
+
+func (b *BlockStore) getGroupVolume(volumeID string) (*groupVolume, error) {
+	var volume groupVolume
+	err := volumes.Get(b.client, volumeID).ExtractInto(&volume)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err)
+	}
+	return &volume, nil
+}
+
+func (b *BlockStore) getGroupMemberSnapshot(snapshotID string) (*groupMemberSnapshot, error) {
+	var res struct {
+		Snapshot groupMemberSnapshot `json:"snapshot"`
+	}
+	err := snapshots.Get(b.client, snapshotID).ExtractInto(&res)
+	if err != nil {
+		return nil, err
+	}
+	return &res.Snapshot, nil
+}
+
+// listGroupMemberSnapshots lists detailed snapshots of the volume or the
+// group snapshot
+func (b *BlockStore) listGroupMemberSnapshots(volumeID, groupSnapshotID string) ([]groupMemberSnapshot, error) {
+	var allSnapshots []groupMemberSnapshot
+	err := b.listAll(b.client.ServiceURL("snapshots", "detail"), snapshots.ListOpts{VolumeID: volumeID}, "snapshots", &allSnapshots)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	if groupSnapshotID == "" {
+		return allSnapshots, nil
+	}
+
+	var members []groupMemberSnapshot
+	for _, snapshot := range allSnapshots {
+		if snapshot.GroupSnapshotID == groupSnapshotID {
+			members = append(members, snapshot)
+		}
+	}
+	return members, nil
+}
+
+// listAll extracts all the pages of the Cinder resource list into the slice
+func (b *BlockStore) listAll(url string, opts interface{}, key string, slice interface{}) error {
+	query, err := gophercloud.BuildQueryString(opts)
+	if err != nil {
+		return err
+	}
+	pages, err := pagination.NewPager(b.client, url+query.String(), func(r pagination.PageResult) pagination.Page {
+		return cinderPage{
+			LinkedPageBase: pagination.LinkedPageBase{PageResult: r, LinkPath: []string{key + "_links"}},
+			key:            key,
+		}
+	}).AllPages()
+	if err != nil {
+		return err
+	}
+	return pages.(cinderPage).ExtractIntoSlicePtr(slice, key)
+}
+
+// cinderPage is a generic Cinder resource list page
+type cinderPage struct {
+	pagination.LinkedPageBase
+	key string
+}
+
+// IsEmpty returns true, when the page contains no resources.
+func (p cinderPage) IsEmpty() (bool, error) {
+	if p.StatusCode == 204 {
+		return true, nil
+	}
+	var items []interface{}
+	err := p.ExtractIntoSlicePtr(&items, p.key)
+	return len(items) == 0, err
+}
+
+func (b *BlockStore) waitForGroupStatus(id string, statuses []string, secs int) (current *volumeGroup, err error) {
+	return current, utils.WaitForStatus(statuses, secs, b.pollInterval, func() (string, error) {
+		var res struct {
+			Group volumeGroup `json:"group"`
+		}
+		_, err := b.client.Get(b.client.ServiceURL("groups", id), &res, nil)
+		if err != nil {
+			return "", err
+		}
+		current = &res.Group
+		return current.Status, nil
+	})
+}
+
+func (b *BlockStore) waitForGroupSnapshotStatus(id string, statuses []string, secs int) (current *groupSnapshot, err error) {
+	return current, utils.WaitForStatus(statuses, secs, b.pollInterval, func() (string, error) {
+		var res struct {
+			GroupSnapshot groupSnapshot `json:"group_snapshot"`
+		}
+		_, err := b.client.Get(b.client.ServiceURL("group_snapshots", id), &res, nil)
+		if err != nil {
+			return "", err
+		}
+		current = &res.GroupSnapshot
+		return current.Status, nil
+	})
+}
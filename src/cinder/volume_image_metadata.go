@@ -0,0 +1,98 @@
+package cinder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/volumeactions"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// snapshot metadata key of the volume bootable flag and the key prefix of
+	// the volume image metadata
+	bootableKey            = "velero-plugin-for-openstack/bootable"
+	imageMetadataKeyPrefix = "velero-plugin-for-openstack/image-metadata/"
+	// maximum length of Cinder metadata keys and values
+	maxMetadataLength = 255
+)
+
+// bootableTags returns the tags extended with the bootable flag and the image
+// metadata of the volume, e.g. the hw_* properties of the image the volume
+// was created from, which are kept in the snapshot metadata
+func bootableTags(log logrus.FieldLogger, volume *volumes.Volume, tags map[string]string) map[string]string {
+	bootable := map[string]string{}
+	if ok, _ := strconv.ParseBool(volume.Bootable); ok {
+		bootable[bootableKey] = "true"
+	}
+	for key, value := range volume.VolumeImageMetadata {
+		if len(imageMetadataKeyPrefix+key) > maxMetadataLength || len(value) > maxMetadataLength {
+			log.WithField("volumeID", volume.ID).Warnf("The %q volume image metadata is too long to be kept in the snapshot metadata", key)
+			continue
+		}
+		bootable[imageMetadataKeyPrefix+key] = value
+	}
+	if len(bootable) == 0 {
+		return tags
+	}
+	return utils.Merge(tags, bootable)
+}
+
+// restoreBootable sets the bootable flag and the image metadata kept in the
+// snapshot metadata on the restored volume, when the restored volume doesn't
+// have them, e.g. volumes restored from backups
+func (b *BlockStore) restoreBootable(volumeID string, tags map[string]string) error {
+	imageMetadata := map[string]string{}
+	for key, value := range tags {
+		if k := strings.TrimPrefix(key, imageMetadataKeyPrefix); k != key {
+			imageMetadata[k] = value
+		}
+	}
+	bootable := tags[bootableKey] == "true"
+	if !bootable && len(imageMetadata) == 0 {
+		return nil
+	}
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"volumeID": volumeID,
+		"bootable": bootable,
+	})
+
+	volume, err := volumes.Get(b.client, volumeID).Extract()
+	if err != nil {
+		logWithFields.Error("failed to get volume from cinder")
+		return fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err)
+	}
+
+	missing := map[string]string{}
+	for key, value := range imageMetadata {
+		if v, ok := volume.VolumeImageMetadata[key]; !ok || v != value {
+			missing[key] = value
+		}
+	}
+	if len(missing) > 0 {
+		logWithFields.Infof("Setting %d volume image metadata properties", len(missing))
+		err = volumeactions.SetImageMetadata(b.client, volumeID, volumeactions.ImageMetadataOpts{
+			Metadata: missing,
+		}).ExtractErr()
+		if err != nil {
+			logWithFields.Error("failed to set volume image metadata")
+			return fmt.Errorf("failed to set volume %v image metadata: %w", volumeID, err)
+		}
+	}
+
+	if ok, _ := strconv.ParseBool(volume.Bootable); bootable && !ok {
+		logWithFields.Info("Setting the volume bootable flag")
+		err = volumeactions.SetBootable(b.client, volumeID, volumeactions.BootableOpts{
+			Bootable: true,
+		}).ExtractErr()
+		if err != nil {
+			logWithFields.Error("failed to set volume bootable flag")
+			return fmt.Errorf("failed to set volume %v bootable flag: %w", volumeID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package cinder
+
+import (
+	"fmt"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/volumeactions"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// restoreSizeAnnotation is a persistent volume annotation with the requested
+// size of the restored volume, e.g. "20Gi". The annotation can be set by a
+// Velero resource modifier or a RestoreItemAction, when the claim was resized
+// after the backup.
+const restoreSizeAnnotation = "velero-plugin-for-openstack/restore-size"
+
+const gib = 1 << 30
+
+// resizeRestoredVolume extends the restored volume, when it is smaller than
+// the size requested by the restoreSizeAnnotation or than the persistent
+// volume capacity, and sets the persistent volume capacity to the size of the
+// restored volume
+func (b *BlockStore) resizeRestoredVolume(logWithFields *logrus.Entry, pv *v1.PersistentVolume, volumeID string) error {
+	requested := pv.Spec.Capacity[v1.ResourceStorage]
+	if v, ok := pv.Annotations[restoreSizeAnnotation]; ok {
+		size, err := resource.ParseQuantity(v)
+		if err != nil {
+			logWithFields.Errorf("invalid %q restore size", v)
+			return fmt.Errorf("invalid %q value of the %s annotation: %w", v, restoreSizeAnnotation, err)
+		}
+		if size.Cmp(requested) > 0 {
+			requested = size
+		}
+	}
+	if requested.IsZero() {
+		return nil
+	}
+	// Cinder volume sizes are in GiB
+	newSize := int((requested.Value() + gib - 1) / gib)
+
+	client := b.restoreClient()
+	volume, err := volumes.Get(client, volumeID).Extract()
+	if err != nil {
+		logWithFields.Error("failed to get volume from cinder")
+		return fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err)
+	}
+
+	if volume.Size < newSize {
+		logWithFields = logWithFields.WithFields(logrus.Fields{
+			"size":    volume.Size,
+			"newSize": newSize,
+		})
+		logWithFields.Info("Extending the restored volume to the requested size")
+		err = volumeactions.ExtendSize(client, volumeID, volumeactions.ExtendSizeOpts{
+			NewSize: newSize,
+		}).ExtractErr()
+		if err != nil {
+			logWithFields.Error("failed to extend volume")
+			return fmt.Errorf("failed to extend volume %v to %d GiB: %w", volumeID, newSize, err)
+		}
+		err = utils.WaitForStatus(volumeStatuses, b.volumeTimeout, b.pollInterval, func() (string, error) {
+			volume, err = volumes.Get(client, volumeID).Extract()
+			if err != nil {
+				return "", err
+			}
+			return volume.Status, nil
+		})
+		if err != nil {
+			logWithFields.Error("volume didn't get into 'available' state within the time limit")
+			return fmt.Errorf("volume %v didn't get into 'available' state within the time limit: %w", volumeID, err)
+		}
+		if volume.Size < newSize {
+			return fmt.Errorf("volume %v wasn't extended to %d GiB, the volume size is %d GiB", volumeID, newSize, volume.Size)
+		}
+		logWithFields.Info("Restored volume is extended")
+	}
+
+	capacity := resource.NewQuantity(int64(volume.Size)*gib, resource.BinarySI)
+	if current := pv.Spec.Capacity[v1.ResourceStorage]; current.Cmp(*capacity) < 0 {
+		logWithFields.Infof("Setting the persistent volume capacity to %s", capacity)
+		if pv.Spec.Capacity == nil {
+			pv.Spec.Capacity = v1.ResourceList{}
+		}
+		pv.Spec.Capacity[v1.ResourceStorage] = *capacity
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package cinder
+
+import (
+	"fmt"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/volumetransfers"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/sirupsen/logrus"
+)
+
+// initTransferClient authenticates against the transferCloud and creates a
+// block storage client of the project, which accepts the restored volumes
+func (b *BlockStore) initTransferClient(config map[string]string, region string) error {
+	err := utils.Authenticate(&b.transferProvider, "cinder", utils.Merge(config, map[string]string{
+		"cloud": b.transferCloud,
+	}), b.log)
+	if err != nil {
+		return fmt.Errorf("failed to authenticate against the %q transfer cloud: %w", b.transferCloud, err)
+	}
+
+	b.transferClient, err = openstack.NewBlockStorageV3(b.transferProvider, gophercloud.EndpointOpts{
+		Region: region,
+	})
+	if err != nil {
+		return utils.WithRequestID(fmt.Errorf("failed to create cinder storage client of the %q transfer cloud: %w", b.transferCloud, err))
+	}
+
+	b.log.WithFields(logrus.Fields{
+		"endpoint":      b.transferClient.Endpoint,
+		"region":        region,
+		"transferCloud": b.transferCloud,
+	}).Info("Successfully created transfer block storage service client")
+
+	return nil
+}
+
+// restoreClient returns the block storage client of the project, which owns
+// the restored volumes
+func (b *BlockStore) restoreClient() *gophercloud.ServiceClient {
+	if b.transferClient != nil {
+		return b.transferClient
+	}
+	return b.client
+}
+
+// transferVolume transfers the restored volume from the authenticated project
+// to the project of the transferCloud. The volume is deleted, when the
+// transfer fails.
+func (b *BlockStore) transferVolume(volumeID string) error {
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"volumeID":      volumeID,
+		"transferCloud": b.transferCloud,
+		"volumeTimeout": b.volumeTimeout,
+	})
+	logWithFields.Info("Transferring volume to the target project")
+
+	opts := volumetransfers.CreateOpts{
+		VolumeID: volumeID,
+		Name:     "velero-" + volumeID,
+	}
+	transfer, err := volumetransfers.Create(b.client, opts).Extract()
+	if err != nil {
+		logWithFields.Error("failed to create volume transfer")
+		err = fmt.Errorf("failed to create volume %v transfer: %w", volumeID, err)
+		return b.abortTransfer(logWithFields, volumeID, "", err)
+	}
+	logWithFields = logWithFields.WithField("transferID", transfer.ID)
+
+	_, err = volumetransfers.Accept(b.transferClient, transfer.ID, volumetransfers.AcceptOpts{
+		AuthKey: transfer.AuthKey,
+	}).Extract()
+	if err != nil {
+		logWithFields.Error("failed to accept volume transfer")
+		err = fmt.Errorf("failed to accept volume %v transfer %v: %w", volumeID, transfer.ID, err)
+		return b.abortTransfer(logWithFields, volumeID, transfer.ID, err)
+	}
+
+	err = utils.WaitForStatus(volumeStatuses, b.volumeTimeout, b.pollInterval, func() (string, error) {
+		volume, err := volumes.Get(b.transferClient, volumeID).Extract()
+		if err != nil {
+			return "", err
+		}
+		return volume.Status, nil
+	})
+	if err != nil {
+		logWithFields.Error("transferred volume didn't get into 'available' state within the time limit")
+		// the volume belongs to the target project after the transfer was
+		// accepted
+		if e := volumes.Delete(b.transferClient, volumeID, nil).ExtractErr(); e != nil {
+			logWithFields.WithError(e).Warn("failed to delete transferred volume")
+		}
+		return fmt.Errorf("transferred volume %v didn't get into 'available' state within the time limit: %w", volumeID, err)
+	}
+	logWithFields.Info("Volume was transferred to the target project")
+
+	return nil
+}
+
+// abortTransfer deletes the volume transfer and the volume, which remained in
+// the authenticated project, and returns the transfer error
+func (b *BlockStore) abortTransfer(logWithFields *logrus.Entry, volumeID, transferID string, err error) error {
+	if transferID != "" {
+		if e := volumetransfers.Delete(b.client, transferID).ExtractErr(); e != nil {
+			logWithFields.WithError(e).Warn("failed to delete volume transfer")
+		}
+	}
+	if e := volumes.Delete(b.client, volumeID, nil).ExtractErr(); e != nil {
+		logWithFields.WithError(e).Warn("failed to delete volume, which wasn't transferred")
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package cinder
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumetypes"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+)
+
+// resolveVolumeType maps the original volume type to the volume type of the
+// restored volume and makes sure the volume type exists. The
+// defaultVolumeType is used, when the mapped volume type doesn't exist.
+func (b *BlockStore) resolveVolumeType(volumeType string) (string, error) {
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"volumeType":        volumeType,
+		"defaultVolumeType": b.defaultVolumeType,
+	})
+
+	mapping, err := b.getVolumeTypeMapping()
+	if err != nil {
+		return "", err
+	}
+	newVolumeType, ok := mapping[volumeType]
+	if !ok {
+		newVolumeType = volumeType
+	}
+	if newVolumeType == "" {
+		if b.defaultVolumeType == "" {
+			// let Cinder choose its default volume type
+			return "", nil
+		}
+		newVolumeType = b.defaultVolumeType
+	}
+
+	allPages, err := volumetypes.List(b.client, volumetypes.ListOpts{}).AllPages()
+	if err != nil {
+		logWithFields.Error("failed to list volume types")
+		return "", fmt.Errorf("failed to list volume types: %w", err)
+	}
+	allTypes, err := volumetypes.ExtractVolumeTypes(allPages)
+	if err != nil {
+		return "", fmt.Errorf("failed to extract volume types: %w", err)
+	}
+	exists := func(name string) bool {
+		for _, t := range allTypes {
+			if t.Name == name || t.ID == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	if exists(newVolumeType) {
+		if newVolumeType != volumeType {
+			logWithFields.Infof("Volume type is mapped to the %q volume type", newVolumeType)
+		}
+		return newVolumeType, nil
+	}
+	if b.defaultVolumeType != "" && exists(b.defaultVolumeType) {
+		logWithFields.Warnf("Volume type %q doesn't exist, using the default volume type", newVolumeType)
+		return b.defaultVolumeType, nil
+	}
+
+	logWithFields.Error("volume type doesn't exist")
+	if b.defaultVolumeType != "" && b.defaultVolumeType != newVolumeType {
+		return "", fmt.Errorf("neither %q volume type, nor %q default volume type exist", newVolumeType, b.defaultVolumeType)
+	}
+	return "", fmt.Errorf("%q volume type doesn't exist", newVolumeType)
+}
+
+// getVolumeTypeMapping returns the volume type mapping, entries of the
+// volumeTypeMappingConfigMap take precedence over the volumeTypeMapping
+func (b *BlockStore) getVolumeTypeMapping() (map[string]string, error) {
+	if b.volumeTypeMappingConfigMap == "" {
+		return b.volumeTypeMapping, nil
+	}
+
+	client, err := b.getKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	data, err := utils.GetConfigMapData(context.TODO(), client, b.volumeTypeMappingConfigMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get volume type mapping: %w", err)
+	}
+	return utils.Merge(b.volumeTypeMapping, data), nil
+}
+
+// getKubeClient returns the Kubernetes client of the cluster, where the
+// volumes are restored
+func (b *BlockStore) getKubeClient() (kubernetes.Interface, error) {
+	if b.kubeClient == nil {
+		client, err := utils.NewKubeClient()
+		if err != nil {
+			return nil, err
+		}
+		b.kubeClient = client
+	}
+	return b.kubeClient, nil
+}
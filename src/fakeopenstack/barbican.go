@@ -0,0 +1,33 @@
+package fakeopenstack
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// serveBarbican serves the Barbican v1 secret metadata requests, which are
+// used to check whether volume encryption keys are accessible
+func (s *Server) serveBarbican(w http.ResponseWriter, r *http.Request, path []string) {
+	if len(path) != 3 || path[0] != "v1" || path[1] != "secrets" || r.Method != http.MethodGet {
+		writeError(w, http.StatusNotFound, "the resource could not be found")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secret := s.store.get(Secrets, path[2])
+	if secret == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("secret %s could not be found", path[2]))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"name":        secret.str("name"),
+		"status":      "ACTIVE",
+		"secret_type": "symmetric",
+		"algorithm":   "aes",
+		"bit_length":  256,
+		"mode":        "cbc",
+		"secret_ref":  s.URL + "/key-manager/v1/secrets/" + path[2],
+	})
+}
@@ -0,0 +1,1049 @@
+package fakeopenstack
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	minVolumeMicroversion = "3.0"
+	// the minimum microversion, which supports backup metadata
+	backupMetadataMicroversion = "3.43"
+	// the minimum microversion, which supports backup availability zones
+	backupAZMicroversion = "3.51"
+	// the minimum microversions, which support generic volume groups and
+	// group snapshots
+	groupMicroversion         = "3.13"
+	groupSnapshotMicroversion = "3.14"
+)
+
+// volumeProjectKey is a volume field, which contains the volume project ID
+const volumeProjectKey = "os-vol-tenant-attr:tenant_id"
+
+var (
+	// volume statuses, which allow a volume to be deleted
+	volumeDeletable = []string{"available", "error", "error_restoring", "error_extending", "error_managing"}
+	// snapshot and backup statuses, which allow them to be deleted
+	deletable = []string{"available", "error"}
+)
+
+// serveCinder serves the Cinder v3 API of the project
+func (s *Server) serveCinder(w http.ResponseWriter, r *http.Request, path []string, project string) {
+	if len(path) == 0 {
+		// version discovery
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"versions": []map[string]interface{}{
+				{
+					"id":          "v3.0",
+					"status":      "CURRENT",
+					"version":     s.VolumeMicroversion,
+					"min_version": minVolumeMicroversion,
+					"updated":     "2016-02-08T12:20:21Z",
+				},
+			},
+		})
+		return
+	}
+	if len(path) < 3 || path[0] != "v3" || path[1] != project {
+		writeError(w, http.StatusNotFound, "the resource could not be found")
+		return
+	}
+
+	mv := microversion(r, "volume", minVolumeMicroversion)
+	if !checkMicroversion(w, mv, minVolumeMicroversion, s.VolumeMicroversion) {
+		return
+	}
+	w.Header().Set("OpenStack-API-Version", "volume "+mv)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	coll, rest := path[2], path[3:]
+	switch coll {
+	case "os-availability-zone":
+		zones := []map[string]interface{}{}
+		for _, az := range s.VolumeAvailabilityZones {
+			zones = append(zones, map[string]interface{}{
+				"zoneName":  az,
+				"zoneState": map[string]interface{}{"available": true},
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"availabilityZoneInfo": zones})
+	case "types":
+		if len(rest) == 2 && rest[1] == "encryption" && r.Method == http.MethodGet {
+			s.getVolumeTypeEncryption(w, rest[0])
+			return
+		}
+		types := []map[string]interface{}{}
+		for _, name := range s.VolumeTypes {
+			types = append(types, map[string]interface{}{
+				"id":        name,
+				"name":      name,
+				"is_public": true,
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"volume_types": types})
+	case "volumes":
+		s.serveCollection(w, r, rest, collection{
+			kind:   Volumes,
+			single: "volume",
+			plural: "volumes",
+			filter: []string{"name", "status", "group_id"},
+			scope:  map[string]string{volumeProjectKey: project},
+			create: func(w http.ResponseWriter, r *http.Request) {
+				s.createVolume(w, r, project)
+			},
+			delete: s.deleteVolume,
+			action: s.volumeAction,
+		})
+	case "os-volume-transfer":
+		s.serveVolumeTransfers(w, r, rest, project)
+	case "os-quota-sets":
+		s.getVolumeQuotaUsage(w, r, rest, project)
+	case "snapshots":
+		s.serveCollection(w, r, rest, collection{
+			kind:   VolumeSnapshots,
+			single: "snapshot",
+			plural: "snapshots",
+			filter: []string{"name", "status", "volume_id"},
+			create: s.createVolumeSnapshot,
+			delete: func(w http.ResponseWriter, _ *http.Request, res *resource) bool {
+				if res.str("group_snapshot_id") != "" {
+					writeError(w, http.StatusBadRequest, "snapshot is part of a group snapshot and cannot be deleted individually")
+					return false
+				}
+				return s.startDelete(w, res, deletable, 0)
+			},
+			action: s.statusAction(VolumeSnapshots),
+		})
+	case "backups":
+		switch {
+		case len(rest) == 2 && rest[1] == "export_record" && r.Method == http.MethodGet:
+			s.exportBackupRecord(w, rest[0])
+			return
+		case len(rest) == 1 && rest[0] == "import_record" && r.Method == http.MethodPost:
+			s.importBackupRecord(w, r)
+			return
+		}
+		s.serveCollection(w, r, rest, collection{
+			kind:   Backups,
+			single: "backup",
+			plural: "backups",
+			filter: []string{"name", "status", "volume_id"},
+			create: func(w http.ResponseWriter, r *http.Request) {
+				s.createBackup(w, r, mv)
+			},
+			update: func(w http.ResponseWriter, r *http.Request, res *resource) {
+				s.updateBackup(w, r, res, mv)
+			},
+			delete: func(w http.ResponseWriter, _ *http.Request, res *resource) bool {
+				if len(s.store.list(Backups, map[string]string{"parent_id": res.str("id")})) > 0 {
+					writeError(w, http.StatusBadRequest, "incremental backups exist for this backup")
+					return false
+				}
+				return s.startDelete(w, res, deletable, 0)
+			},
+			action: s.statusAction(Backups),
+		})
+	case "groups":
+		if compareMicroversions(mv, groupMicroversion) < 0 {
+			writeError(w, http.StatusNotFound, "the resource could not be found")
+			return
+		}
+		s.serveCollection(w, r, rest, collection{
+			kind:   Groups,
+			single: "group",
+			plural: "groups",
+			filter: []string{"name", "status"},
+			create: s.createGroup,
+			update: s.updateGroup,
+			delete: s.deleteGroup,
+			action: func(w http.ResponseWriter, r *http.Request, res *resource, action string, body map[string]interface{}) {
+				// groups are deleted by the "delete" action
+				if action == "delete" {
+					if s.deleteGroup(w, r, res) {
+						w.WriteHeader(http.StatusAccepted)
+					}
+					return
+				}
+				s.statusAction(Groups)(w, r, res, action, body)
+			},
+		})
+	case "group_snapshots":
+		if compareMicroversions(mv, groupSnapshotMicroversion) < 0 {
+			writeError(w, http.StatusNotFound, "the resource could not be found")
+			return
+		}
+		s.serveCollection(w, r, rest, collection{
+			kind:   GroupSnapshots,
+			single: "group_snapshot",
+			plural: "group_snapshots",
+			filter: []string{"name", "status", "group_id"},
+			create: s.createGroupSnapshot,
+			delete: s.deleteGroupSnapshot,
+			action: s.statusAction(GroupSnapshots),
+		})
+	default:
+		writeError(w, http.StatusNotFound, "the resource could not be found")
+	}
+}
+
+// collection describes a REST collection of resources
+type collection struct {
+	kind   string
+	single string
+	plural string
+	// query parameters, which are used to filter the list
+	filter []string
+	// scope hides resources, which don't match it, e.g. of other projects
+	scope  map[string]string
+	create func(w http.ResponseWriter, r *http.Request)
+	// update is optional, the collection doesn't support updates without it
+	update func(w http.ResponseWriter, r *http.Request, res *resource)
+	// delete starts the resource deletion and returns false, when the
+	// resource cannot be deleted
+	delete func(w http.ResponseWriter, r *http.Request, res *resource) bool
+	action func(w http.ResponseWriter, r *http.Request, res *resource, action string, body map[string]interface{})
+}
+
+// serveCollection serves list, create, get, update, delete and action requests
+// of the collection
+func (s *Server) serveCollection(w http.ResponseWriter, r *http.Request, path []string, c collection) {
+	switch {
+	case len(path) == 0 && r.Method == http.MethodPost:
+		c.create(w, r)
+	case (len(path) == 0 || len(path) == 1 && path[0] == "detail") && r.Method == http.MethodGet:
+		filter := map[string]string{}
+		for _, k := range c.filter {
+			filter[k] = r.URL.Query().Get(k)
+		}
+		for k, v := range c.scope {
+			filter[k] = v
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			c.plural: s.observeAll(c.kind, filter),
+		})
+	case len(path) == 1 && r.Method == http.MethodGet:
+		if res := s.find(w, c, path[0], true); res != nil {
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				c.single: res.fields,
+			})
+		}
+	case len(path) == 1 && r.Method == http.MethodPut && c.update != nil:
+		if res := s.find(w, c, path[0], false); res != nil {
+			c.update(w, r, res)
+		}
+	case len(path) == 1 && r.Method == http.MethodDelete:
+		if res := s.find(w, c, path[0], false); res != nil {
+			if c.delete(w, r, res) {
+				w.WriteHeader(http.StatusAccepted)
+			}
+		}
+	case len(path) == 2 && path[1] == "metadata" && (r.Method == http.MethodPut || r.Method == http.MethodPost):
+		// PUT replaces and POST merges the resource metadata
+		res := s.find(w, c, path[0], false)
+		if res == nil {
+			return
+		}
+		var body struct {
+			Metadata map[string]interface{} `json:"metadata"`
+		}
+		if err := readJSON(r, &body); err != nil || body.Metadata == nil {
+			writeError(w, http.StatusBadRequest, "invalid metadata request body")
+			return
+		}
+		metadata := map[string]interface{}{}
+		if old, ok := res.fields["metadata"].(map[string]interface{}); ok && r.Method == http.MethodPost {
+			for k, v := range old {
+				metadata[k] = v
+			}
+		}
+		for k, v := range body.Metadata {
+			metadata[k] = v
+		}
+		res.fields["metadata"] = metadata
+		writeJSON(w, http.StatusOK, map[string]interface{}{"metadata": metadata})
+	case len(path) == 2 && path[1] == "action" && r.Method == http.MethodPost:
+		res := s.find(w, c, path[0], false)
+		if res == nil {
+			return
+		}
+		var body map[string]interface{}
+		if err := readJSON(r, &body); err != nil || len(body) != 1 {
+			writeError(w, http.StatusBadRequest, "invalid action request body")
+			return
+		}
+		for action, v := range body {
+			params, _ := v.(map[string]interface{})
+			c.action(w, r, res, action, params)
+		}
+	default:
+		writeError(w, http.StatusNotFound, "the resource could not be found")
+	}
+}
+
+// find returns the resource of the collection or writes a 404 response, when
+// the resource doesn't exist or it is out of the collection scope
+func (s *Server) find(w http.ResponseWriter, c collection, id string, observe bool) *resource {
+	var r *resource
+	if observe {
+		r = s.observeOne(w, c.kind, id)
+	} else {
+		r = s.lookup(w, c.kind, id)
+	}
+	if r != nil && !r.matches(c.scope) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s could not be found", c.kind, id))
+		return nil
+	}
+	return r
+}
+
+// statusAction serves status reset and force delete actions
+func (s *Server) statusAction(kind string) func(w http.ResponseWriter, r *http.Request, res *resource, action string, body map[string]interface{}) {
+	return func(w http.ResponseWriter, r *http.Request, res *resource, action string, body map[string]interface{}) {
+		switch action {
+		case "os-reset_status", "reset_status":
+			status, _ := body["status"].(string)
+			if status == "" {
+				writeError(w, http.StatusBadRequest, "status is required")
+				return
+			}
+			res.fields["status"] = status
+			res.pending = nil
+			w.WriteHeader(http.StatusAccepted)
+		case "os-force_delete", "force_delete":
+			res.fields["status"] = "deleting"
+			res.scheduleRemoval(s.Polls)
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported %s action", action))
+		}
+	}
+}
+
+func (s *Server) createVolume(w http.ResponseWriter, r *http.Request, project string) {
+	var req struct {
+		Volume map[string]interface{} `json:"volume"`
+	}
+	if err := readJSON(r, &req); err != nil || req.Volume == nil {
+		writeError(w, http.StatusBadRequest, "invalid volume request body")
+		return
+	}
+	fields := req.Volume
+	size, _ := fields["size"].(float64)
+
+	// resolve the volume source
+	var src, origin *resource
+	var srcSize float64
+	switch {
+	case fields["snapshot_id"] != nil:
+		if src = s.lookup(w, VolumeSnapshots, fmt.Sprint(fields["snapshot_id"])); src == nil {
+			return
+		}
+		if origin = s.store.get(Volumes, src.str("volume_id")); origin != nil {
+			setDefault(fields, "volume_type", origin.fields["volume_type"])
+			setDefault(fields, "volume_image_metadata", origin.fields["volume_image_metadata"])
+		}
+	case fields["source_volid"] != nil:
+		if src = s.lookup(w, Volumes, fmt.Sprint(fields["source_volid"])); src == nil {
+			return
+		}
+		origin = src
+		setDefault(fields, "volume_type", src.fields["volume_type"])
+		setDefault(fields, "volume_image_metadata", src.fields["volume_image_metadata"])
+	case fields["backup_id"] != nil:
+		if src = s.lookup(w, Backups, fmt.Sprint(fields["backup_id"])); src == nil {
+			return
+		}
+	case fields["imageRef"] != nil:
+		if src = s.lookup(w, Images, fmt.Sprint(fields["imageRef"])); src == nil {
+			return
+		}
+		if src.str("status") != "active" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("image %s is not active", src.str("id")))
+			return
+		}
+		fields["volume_image_metadata"] = imageMetadata(src)
+		srcSize = float64(toInt(src.fields["min_disk"]))
+	}
+	if src != nil && fields["imageRef"] == nil {
+		srcSize = float64(toInt(src.fields["size"]))
+		if st := src.str("status"); !sliceContains([]string{"available", "in-use", "active"}, st) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("source %s has invalid %q status", src.str("id"), st))
+			return
+		}
+	}
+	if size == 0 {
+		size = srcSize
+	}
+	if size < 1 || size < srcSize {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid volume size %v, source size is %v", size, srcSize))
+		return
+	}
+	fields["size"] = int(size)
+	fields[volumeProjectKey] = project
+	fields["updated_at"] = time.Now().UTC().Format(milliNoZ)
+	if az, _ := fields["availability_zone"].(string); az == "" {
+		delete(fields, "availability_zone")
+	} else if !sliceContains(s.VolumeAvailabilityZones, az) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Availability zone '%s' is invalid.", az))
+		return
+	}
+	if vt, _ := fields["volume_type"].(string); vt == "" {
+		delete(fields, "volume_type")
+	} else if !sliceContains(s.VolumeTypes, vt) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("volume type with name %s could not be found", vt))
+		return
+	}
+	if !s.setVolumeEncryption(w, fields, origin) {
+		return
+	}
+	delete(fields, "imageRef")
+	if src != nil && fields["backup_id"] == nil {
+		delete(fields, "backup_id")
+	}
+
+	fields["multiattach"] = sliceContains(s.MultiattachVolumeTypes, fmt.Sprint(fields["volume_type"]))
+
+	res := s.create(Volumes, fields, "creating", map[string]interface{}{"status": "available"})
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"volume": res.fields})
+}
+
+// getVolumeTypeEncryption writes the volume type encryption type, which is
+// empty for volume types without encryption
+func (s *Server) getVolumeTypeEncryption(w http.ResponseWriter, volumeType string) {
+	if !sliceContains(s.VolumeTypes, volumeType) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("volume type %s could not be found", volumeType))
+		return
+	}
+	encryption := map[string]interface{}{}
+	for k, v := range s.VolumeTypeEncryption[volumeType] {
+		encryption[k] = v
+	}
+	if len(encryption) > 0 {
+		encryption["volume_type_id"] = volumeType
+		encryption["encryption_id"] = "encryption-" + volumeType
+	}
+	writeJSON(w, http.StatusOK, encryption)
+}
+
+// setVolumeEncryption encrypts volumes of encrypted volume types. Volumes
+// cloned from an encrypted volume or its snapshot require the same encryption
+// type and an existing encryption key of the origin volume.
+func (s *Server) setVolumeEncryption(w http.ResponseWriter, fields map[string]interface{}, origin *resource) bool {
+	volumeType, _ := fields["volume_type"].(string)
+	if volumeType == "" {
+		volumeType = DefaultVolumeType
+	}
+	encryption := s.VolumeTypeEncryption[volumeType]
+	if origin != nil && origin.fields["encrypted"] == true {
+		originEncryption := s.VolumeTypeEncryption[origin.str("volume_type")]
+		if fmt.Sprint(encryption) != fmt.Sprint(originEncryption) {
+			writeError(w, http.StatusBadRequest, "Invalid input received: Volume type encryption for the source and the new volume does not match.")
+			return false
+		}
+		if s.store.get(Secrets, origin.str("encryption_key_id")) == nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Failed to clone the encryption key %s of the source volume.", origin.str("encryption_key_id")))
+			return false
+		}
+	}
+	if encryption != nil {
+		fields["encrypted"] = true
+		fields["encryption_key_id"] = s.store.add(Secrets, map[string]interface{}{}).str("id")
+	}
+	return true
+}
+
+// serveVolumeTransfers serves the volume transfer requests. An accepted
+// transfer moves the volume to the accepting project.
+func (s *Server) serveVolumeTransfers(w http.ResponseWriter, r *http.Request, path []string, project string) {
+	switch {
+	case len(path) == 0 && r.Method == http.MethodPost:
+		var req struct {
+			Transfer struct {
+				VolumeID string `json:"volume_id"`
+				Name     string `json:"name"`
+			} `json:"transfer"`
+		}
+		if err := readJSON(r, &req); err != nil || req.Transfer.VolumeID == "" {
+			writeError(w, http.StatusBadRequest, "invalid transfer request body")
+			return
+		}
+		volume := s.store.get(Volumes, req.Transfer.VolumeID)
+		if volume == nil || volume.str(volumeProjectKey) != project {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("volume %s could not be found", req.Transfer.VolumeID))
+			return
+		}
+		if st := volume.str("status"); st != "available" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid volume: status must be available, but current status is: %s", st))
+			return
+		}
+		volume.fields["status"] = "awaiting-transfer"
+		res := s.store.add(VolumeTransfers, map[string]interface{}{
+			"name":       req.Transfer.Name,
+			"volume_id":  req.Transfer.VolumeID,
+			"auth_key":   newID()[:16],
+			"project_id": project,
+			"created_at": time.Now().UTC().Format(milliNoZ),
+		})
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{"transfer": res.fields})
+	case (len(path) == 0 || len(path) == 1 && path[0] == "detail") && r.Method == http.MethodGet:
+		transfers := []map[string]interface{}{}
+		for _, res := range s.store.list(VolumeTransfers, map[string]string{"project_id": project}) {
+			transfers = append(transfers, transferView(res))
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"transfers": transfers})
+	case len(path) == 1 && r.Method == http.MethodGet:
+		if res := s.lookupTransfer(w, path[0], project); res != nil {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"transfer": transferView(res)})
+		}
+	case len(path) == 1 && r.Method == http.MethodDelete:
+		res := s.lookupTransfer(w, path[0], project)
+		if res == nil {
+			return
+		}
+		if volume := s.store.get(Volumes, res.str("volume_id")); volume != nil {
+			volume.fields["status"] = "available"
+		}
+		s.store.delete(VolumeTransfers, path[0])
+		w.WriteHeader(http.StatusAccepted)
+	case len(path) == 2 && path[1] == "accept" && r.Method == http.MethodPost:
+		// transfers of other projects are accepted using the auth key
+		res := s.lookupTransfer(w, path[0], "")
+		if res == nil {
+			return
+		}
+		var req struct {
+			Accept struct {
+				AuthKey string `json:"auth_key"`
+			} `json:"accept"`
+		}
+		if err := readJSON(r, &req); err != nil || req.Accept.AuthKey != res.str("auth_key") {
+			writeError(w, http.StatusBadRequest, "invalid auth key")
+			return
+		}
+		if volume := s.store.get(Volumes, res.str("volume_id")); volume != nil {
+			volume.fields[volumeProjectKey] = project
+			volume.fields["status"] = "available"
+		}
+		s.store.delete(VolumeTransfers, path[0])
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{"transfer": transferView(res)})
+	default:
+		writeError(w, http.StatusNotFound, "the resource could not be found")
+	}
+}
+
+// lookupTransfer returns the volume transfer of the project or writes a 404
+// response. An empty project matches transfers of all projects.
+func (s *Server) lookupTransfer(w http.ResponseWriter, id, project string) *resource {
+	res := s.store.get(VolumeTransfers, id)
+	if res == nil || project != "" && res.str("project_id") != project {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("transfer %s could not be found", id))
+		return nil
+	}
+	return res
+}
+
+// transferView returns the volume transfer fields without the auth key,
+// which is returned only on the transfer creation
+func transferView(res *resource) map[string]interface{} {
+	fields := res.copyFields()
+	delete(fields, "auth_key")
+	delete(fields, "project_id")
+	return fields
+}
+
+func (s *Server) deleteVolume(w http.ResponseWriter, r *http.Request, res *resource) bool {
+	snaps := s.store.list(VolumeSnapshots, map[string]string{"volume_id": res.str("id")})
+	if r.URL.Query().Get("cascade") == "true" {
+		for _, snap := range snaps {
+			snap.fields["status"] = "deleting"
+			snap.scheduleRemoval(s.Polls)
+		}
+		snaps = nil
+	}
+	return s.startDelete(w, res, volumeDeletable, len(snaps))
+}
+
+func (s *Server) volumeAction(w http.ResponseWriter, r *http.Request, res *resource, action string, body map[string]interface{}) {
+	switch action {
+	case "os-extend":
+		newSize := toInt(body["new_size"])
+		if res.str("status") != "available" || newSize <= toInt(res.fields["size"]) {
+			writeError(w, http.StatusBadRequest, "invalid volume status or size")
+			return
+		}
+		res.fields["status"] = "extending"
+		res.transition(s.Polls, map[string]interface{}{"status": "available", "size": newSize})
+		w.WriteHeader(http.StatusAccepted)
+	case "os-retype":
+		newType := fmt.Sprint(body["new_type"])
+		if !sliceContains(s.VolumeTypes, newType) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("volume type %s could not be found", newType))
+			return
+		}
+		if res.str("status") != "available" {
+			writeError(w, http.StatusBadRequest, "invalid volume status")
+			return
+		}
+		res.fields["status"] = "retyping"
+		pending := map[string]interface{}{
+			"status":      "available",
+			"volume_type": newType,
+			"multiattach": sliceContains(s.MultiattachVolumeTypes, newType),
+		}
+		if s.VolumeTypeBackends[newType] != s.VolumeTypeBackends[res.str("volume_type")] {
+			if body["migration_policy"] != "on-demand" {
+				// the retype fails asynchronously without the migration
+				pending = map[string]interface{}{"status": "available"}
+			} else {
+				res.fields["migration_status"] = "migrating"
+				pending["migration_status"] = "success"
+			}
+		}
+		res.transition(s.Polls, pending)
+		w.WriteHeader(http.StatusAccepted)
+	case "os-update_readonly_flag":
+		// the readonly flag is shown in the volume metadata
+		md := map[string]interface{}{}
+		switch old := res.fields["metadata"].(type) {
+		case map[string]interface{}:
+			md = old
+		case map[string]string:
+			for k, v := range old {
+				md[k] = v
+			}
+		}
+		if body["readonly"] == true {
+			md["readonly"] = "True"
+		} else {
+			md["readonly"] = "False"
+		}
+		res.fields["metadata"] = md
+		w.WriteHeader(http.StatusAccepted)
+	case "os-set_bootable":
+		res.fields["bootable"] = fmt.Sprint(body["bootable"])
+		w.WriteHeader(http.StatusOK)
+	case "os-set_image_metadata":
+		md, _ := res.fields["volume_image_metadata"].(map[string]interface{})
+		if md == nil {
+			md = map[string]interface{}{}
+		}
+		if v, ok := body["metadata"].(map[string]interface{}); ok {
+			for k, v := range v {
+				md[k] = v
+			}
+		}
+		res.fields["volume_image_metadata"] = md
+		writeJSON(w, http.StatusOK, map[string]interface{}{"metadata": md})
+	case "os-volume_upload_image":
+		if st := res.str("status"); st != "available" && !(st == "in-use" && body["force"] == true) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("volume %s has invalid %q status", res.str("id"), st))
+			return
+		}
+		if body["container_format"] == "compressed" && !s.ImageCompression {
+			writeError(w, http.StatusBadRequest, "Image compression upload disallowed, but container_format is compressed.")
+			return
+		}
+		fields := map[string]interface{}{
+			"name":             body["image_name"],
+			"container_format": body["container_format"],
+			"disk_format":      body["disk_format"],
+			"visibility":       body["visibility"],
+			"protected":        body["protected"] == true,
+			"min_disk":         0,
+			"size":             toInt(res.fields["size"]) * 1024 * 1024 * 1024,
+		}
+		if len(s.ImageStores) > 0 {
+			fields["stores"] = s.ImageStores[0]
+		}
+		if res.fields["encrypted"] == true {
+			// images of encrypted volumes get a copy of the encryption key
+			fields["cinder_encryption_key_id"] = s.store.add(Secrets, map[string]interface{}{}).str("id")
+			fields["cinder_encryption_key_deletion_policy"] = "on_image_deletion"
+		}
+		img := s.create(Images, fields, "saving", map[string]interface{}{"status": "active"})
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{
+			"os-volume_upload_image": map[string]interface{}{
+				"id":               res.str("id"),
+				"image_id":         img.str("id"),
+				"image_name":       body["image_name"],
+				"container_format": body["container_format"],
+				"disk_format":      body["disk_format"],
+				"status":           "uploading",
+				"size":             res.fields["size"],
+				"updated_at":       time.Now().UTC().Format(milliNoZ),
+			},
+		})
+	default:
+		s.statusAction(Volumes)(w, r, res, action, body)
+	}
+}
+
+func (s *Server) createVolumeSnapshot(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Snapshot map[string]interface{} `json:"snapshot"`
+	}
+	if err := readJSON(r, &req); err != nil || req.Snapshot == nil {
+		writeError(w, http.StatusBadRequest, "invalid snapshot request body")
+		return
+	}
+	fields := req.Snapshot
+	vol := s.lookup(w, Volumes, fmt.Sprint(fields["volume_id"]))
+	if vol == nil {
+		return
+	}
+	if st := vol.str("status"); st != "available" && !(st == "in-use" && fields["force"] == true) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("volume %s has invalid %q status", vol.str("id"), st))
+		return
+	}
+	delete(fields, "force")
+	fields["size"] = vol.fields["size"]
+
+	res := s.create(VolumeSnapshots, fields, "creating", map[string]interface{}{"status": "available"})
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"snapshot": res.fields})
+}
+
+func (s *Server) createBackup(w http.ResponseWriter, r *http.Request, mv string) {
+	var req struct {
+		Backup map[string]interface{} `json:"backup"`
+	}
+	if err := readJSON(r, &req); err != nil || req.Backup == nil {
+		writeError(w, http.StatusBadRequest, "invalid backup request body")
+		return
+	}
+	if s.NoBackupService {
+		writeError(w, http.StatusServiceUnavailable, "Service cinder-backup could not be found.")
+		return
+	}
+	fields := req.Backup
+	if fields["metadata"] != nil && compareMicroversions(mv, backupMetadataMicroversion) < 0 {
+		writeError(w, http.StatusBadRequest, "additional properties are not allowed ('metadata' was unexpected)")
+		return
+	}
+	if fields["availability_zone"] != nil && compareMicroversions(mv, backupAZMicroversion) < 0 {
+		writeError(w, http.StatusBadRequest, "additional properties are not allowed ('availability_zone' was unexpected)")
+		return
+	}
+	vol := s.lookup(w, Volumes, fmt.Sprint(fields["volume_id"]))
+	if vol == nil {
+		return
+	}
+	if az, _ := fields["availability_zone"].(string); az != "" && !sliceContains(s.VolumeAvailabilityZones, az) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("availability zone %q is invalid", az))
+		return
+	}
+	if id, _ := fields["snapshot_id"].(string); id != "" {
+		// a backup from a snapshot doesn't require the force flag
+		snap := s.lookup(w, VolumeSnapshots, id)
+		if snap == nil {
+			return
+		}
+		if snap.str("volume_id") != vol.str("id") || snap.str("status") != "available" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("snapshot %s is not available or doesn't belong to the volume %s", id, vol.str("id")))
+			return
+		}
+		fields["force"] = true
+	}
+	if st := vol.str("status"); st != "available" && !(st == "in-use" && fields["force"] == true) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("volume %s has invalid %q status", vol.str("id"), st))
+		return
+	}
+	if fields["incremental"] == true {
+		// an incremental backup is based on the latest volume backup, which
+		// must be available
+		var parent *resource
+		for _, b := range s.store.list(Backups, map[string]string{"volume_id": vol.str("id")}) {
+			parent = b
+		}
+		if parent == nil || parent.str("status") != "available" {
+			writeError(w, http.StatusBadRequest, "no backups available to do an incremental backup")
+			return
+		}
+		fields["parent_id"] = parent.str("id")
+		parent.fields["has_dependent_backups"] = true
+	}
+	fields["is_incremental"] = fields["incremental"] == true
+	fields["has_dependent_backups"] = false
+	fields["size"] = vol.fields["size"]
+	fields["object_count"] = 0
+	setDefault(fields, "container", "volumebackups")
+	fields["data_timestamp"] = time.Now().UTC().Format(milliNoZ)
+	if az, _ := fields["availability_zone"].(string); az == "" {
+		fields["availability_zone"] = vol.fields["availability_zone"]
+	}
+	delete(fields, "incremental")
+	delete(fields, "force")
+
+	res := s.create(Backups, fields, "creating", map[string]interface{}{"status": "available"})
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"backup": res.fields})
+}
+
+// updateBackup updates the backup name, description and metadata
+func (s *Server) updateBackup(w http.ResponseWriter, r *http.Request, res *resource, mv string) {
+	var req struct {
+		Backup map[string]interface{} `json:"backup"`
+	}
+	if err := readJSON(r, &req); err != nil || req.Backup == nil {
+		writeError(w, http.StatusBadRequest, "invalid backup request body")
+		return
+	}
+	if req.Backup["metadata"] != nil && compareMicroversions(mv, backupMetadataMicroversion) < 0 {
+		writeError(w, http.StatusBadRequest, "additional properties are not allowed ('metadata' was unexpected)")
+		return
+	}
+	for _, k := range []string{"name", "description", "metadata"} {
+		if v, ok := req.Backup[k]; ok {
+			res.fields[k] = v
+		}
+	}
+	res.fields["updated_at"] = time.Now().UTC().Format(milliNoZ)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"backup": res.fields})
+}
+
+func (s *Server) createGroup(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Group map[string]interface{} `json:"group"`
+	}
+	if err := readJSON(r, &req); err != nil || req.Group == nil {
+		writeError(w, http.StatusBadRequest, "invalid group request body")
+		return
+	}
+	fields := req.Group
+	if types, _ := fields["volume_types"].([]interface{}); fields["group_type"] == nil || len(types) == 0 {
+		writeError(w, http.StatusBadRequest, "group_type and volume_types are required")
+		return
+	}
+	setDefault(fields, "availability_zone", DefaultAvailabilityZone)
+
+	res := s.create(Groups, fields, "creating", map[string]interface{}{"status": "available"})
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"group": res.fields})
+}
+
+// updateGroup updates the group name and description, and adds or removes
+// the comma separated group volumes
+func (s *Server) updateGroup(w http.ResponseWriter, r *http.Request, res *resource) {
+	var req struct {
+		Group map[string]interface{} `json:"group"`
+	}
+	if err := readJSON(r, &req); err != nil || req.Group == nil {
+		writeError(w, http.StatusBadRequest, "invalid group request body")
+		return
+	}
+	if st := res.str("status"); st != "available" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("group %s has invalid %q status", res.str("id"), st))
+		return
+	}
+	types, _ := res.fields["volume_types"].([]interface{})
+	var add, remove []*resource
+	for _, id := range splitIDs(req.Group["add_volumes"]) {
+		vol := s.lookup(w, Volumes, id)
+		if vol == nil {
+			return
+		}
+		if st := vol.str("status"); st != "available" && st != "in-use" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("volume %s has invalid %q status", id, st))
+			return
+		}
+		if vol.str("group_id") != "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("volume %s already belongs to the %s group", id, vol.str("group_id")))
+			return
+		}
+		found := false
+		for _, t := range types {
+			found = found || fmt.Sprint(t) == vol.str("volume_type")
+		}
+		if !found {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("volume %s type %q is not supported by the group", id, vol.str("volume_type")))
+			return
+		}
+		add = append(add, vol)
+	}
+	for _, id := range splitIDs(req.Group["remove_volumes"]) {
+		vol := s.lookup(w, Volumes, id)
+		if vol == nil {
+			return
+		}
+		remove = append(remove, vol)
+	}
+
+	for _, vol := range add {
+		vol.fields["group_id"] = res.str("id")
+	}
+	for _, vol := range remove {
+		delete(vol.fields, "group_id")
+	}
+	for _, k := range []string{"name", "description"} {
+		if v, ok := req.Group[k]; ok {
+			res.fields[k] = v
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// deleteGroup deletes the group without volumes and group snapshots
+func (s *Server) deleteGroup(w http.ResponseWriter, _ *http.Request, res *resource) bool {
+	dependents := len(s.store.list(Volumes, map[string]string{"group_id": res.str("id")})) +
+		len(s.store.list(GroupSnapshots, map[string]string{"group_id": res.str("id")}))
+	return s.startDelete(w, res, deletable, dependents)
+}
+
+// splitIDs splits the comma separated IDs
+func splitIDs(v interface{}) []string {
+	var ids []string
+	str, _ := v.(string)
+	for _, id := range strings.Split(str, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// createGroupSnapshot creates a group snapshot with a snapshot per group volume
+func (s *Server) createGroupSnapshot(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		GroupSnapshot map[string]interface{} `json:"group_snapshot"`
+	}
+	if err := readJSON(r, &req); err != nil || req.GroupSnapshot == nil {
+		writeError(w, http.StatusBadRequest, "invalid group snapshot request body")
+		return
+	}
+	fields := req.GroupSnapshot
+	group := s.lookup(w, Groups, fmt.Sprint(fields["group_id"]))
+	if group == nil {
+		return
+	}
+	if st := group.str("status"); st != "available" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("group %s has invalid %q status", group.str("id"), st))
+		return
+	}
+	members := s.store.list(Volumes, map[string]string{"group_id": group.str("id")})
+	if len(members) == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("group %s has no volumes", group.str("id")))
+		return
+	}
+	fields["group_type_id"] = group.fields["group_type"]
+
+	res := s.create(GroupSnapshots, fields, "creating", map[string]interface{}{"status": "available"})
+	for _, vol := range members {
+		s.create(VolumeSnapshots, map[string]interface{}{
+			"name":              "snapshot-" + vol.str("id"),
+			"volume_id":         vol.str("id"),
+			"size":              vol.fields["size"],
+			"group_snapshot_id": res.str("id"),
+		}, "creating", map[string]interface{}{"status": "available"})
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"group_snapshot": res.fields})
+}
+
+// deleteGroupSnapshot deletes the group snapshot together with its snapshots
+func (s *Server) deleteGroupSnapshot(w http.ResponseWriter, _ *http.Request, res *resource) bool {
+	if !s.startDelete(w, res, deletable, 0) {
+		return false
+	}
+	for _, snap := range s.store.list(VolumeSnapshots, map[string]string{"group_snapshot_id": res.str("id")}) {
+		snap.fields["status"] = "deleting"
+		snap.scheduleRemoval(s.Polls)
+	}
+	return true
+}
+
+// backupService is a fake backup driver name
+const backupService = "cinder.backup.drivers.swift.SwiftBackupDriver"
+
+// exportBackupRecord exports the backup fields as a base64 encoded backup URL
+func (s *Server) exportBackupRecord(w http.ResponseWriter, id string) {
+	res := s.lookup(w, Backups, id)
+	if res == nil {
+		return
+	}
+	if st := res.str("status"); st != "available" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("backup %s has invalid %q status", id, st))
+		return
+	}
+	data, err := json.Marshal(res.fields)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"backup-record": map[string]interface{}{
+			"backup_service": backupService,
+			"backup_url":     base64.StdEncoding.EncodeToString(data),
+		},
+	})
+}
+
+// importBackupRecord creates a backup with the same ID from the exported
+// backup record
+func (s *Server) importBackupRecord(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Record struct {
+			BackupService string `json:"backup_service"`
+			BackupURL     []byte `json:"backup_url"`
+		} `json:"backup-record"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid backup record request body")
+		return
+	}
+	var fields map[string]interface{}
+	if req.Record.BackupService != backupService || json.Unmarshal(req.Record.BackupURL, &fields) != nil {
+		writeError(w, http.StatusBadRequest, "invalid backup record")
+		return
+	}
+	id, _ := fields["id"].(string)
+	if s.store.get(Backups, id) != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("backup %s already exists", id))
+		return
+	}
+
+	res := s.create(Backups, fields, "creating", map[string]interface{}{"status": "available"})
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"backup": map[string]interface{}{
+			"id":   id,
+			"name": res.str("name"),
+		},
+	})
+}
+
+// imageMetadata returns the volume image metadata of the image
+func imageMetadata(img *resource) map[string]interface{} {
+	md := map[string]interface{}{
+		"image_id":   img.str("id"),
+		"image_name": img.str("name"),
+	}
+	for k, v := range img.fields {
+		switch k {
+		case "id", "name", "status", "visibility", "created_at", "updated_at", "size", "self", "file", "schema", "tags", "owner", "protected":
+			continue
+		}
+		md[k] = fmt.Sprint(v)
+	}
+	return md
+}
+
+func setDefault(fields map[string]interface{}, key string, value interface{}) {
+	if v, ok := fields[key]; (!ok || v == nil || v == "") && value != nil {
+		fields[key] = value
+	}
+}
+
+func toInt(v interface{}) int {
+	switch v := v.(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	case string:
+		var i int
+		fmt.Sscan(v, &i)
+		return i
+	}
+	return 0
+}
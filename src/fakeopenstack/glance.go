@@ -0,0 +1,231 @@
+package fakeopenstack
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ImagesIn returns the resource kind of images in the region
+func ImagesIn(region string) string {
+	if region == Region {
+		return Images
+	}
+	return Images + "@" + region
+}
+
+// serveGlance serves the Glance v2 API of the region
+func (s *Server) serveGlance(w http.ResponseWriter, r *http.Request, path []string, region string) {
+	if len(path) < 2 || path[0] != "v2" || (path[1] != "images" && path[1] != "stores") {
+		writeError(w, http.StatusNotFound, "the resource could not be found")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kind := ImagesIn(region)
+	if path[1] == "stores" {
+		if len(path) == 4 && r.Method == http.MethodDelete {
+			s.deleteImageFromStore(w, kind, path[2], path[3])
+		} else {
+			writeError(w, http.StatusNotFound, "the resource could not be found")
+		}
+		return
+	}
+
+	path = path[2:]
+	switch {
+	case len(path) == 0 && r.Method == http.MethodGet:
+		// images are filtered by any property
+		filter := map[string]string{}
+		for k, v := range r.URL.Query() {
+			switch k {
+			case "limit", "marker", "sort", "sort_key", "sort_dir":
+				continue
+			}
+			filter[k] = v[0]
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"images": s.observeAll(kind, filter),
+		})
+	case len(path) == 0 && r.Method == http.MethodPost:
+		var fields map[string]interface{}
+		if err := readJSON(r, &fields); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		fields["status"] = "queued"
+		writeJSON(w, http.StatusCreated, s.store.add(kind, defaults(Images, fields)).fields)
+	case len(path) == 1 && r.Method == http.MethodGet:
+		if res := s.observeOne(w, kind, path[0]); res != nil {
+			writeJSON(w, http.StatusOK, res.fields)
+		}
+	case len(path) == 1 && r.Method == http.MethodPatch:
+		if res := s.lookup(w, kind, path[0]); res != nil {
+			s.patchImage(w, r, res)
+		}
+	case len(path) == 2 && path[1] == "import" && r.Method == http.MethodPost:
+		if res := s.lookup(w, kind, path[0]); res != nil {
+			s.copyImage(w, r, res)
+		}
+	case len(path) == 2 && path[1] == "file" && r.Method == http.MethodPut:
+		if res := s.lookup(w, kind, path[0]); res != nil {
+			s.uploadImageData(w, r, res)
+		}
+	case len(path) == 2 && path[1] == "file" && r.Method == http.MethodGet:
+		if res := s.observeOne(w, kind, path[0]); res != nil {
+			s.downloadImageData(w, res)
+		}
+	case len(path) == 1 && r.Method == http.MethodDelete:
+		res := s.lookup(w, kind, path[0])
+		if res == nil {
+			return
+		}
+		if res.fields["protected"] == true {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("image %s is protected and cannot be deleted", path[0]))
+			return
+		}
+		s.store.delete(kind, path[0])
+		delete(s.imageData, path[0])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "the resource could not be found")
+	}
+}
+
+// uploadImageData stores the data of the queued image, the image becomes
+// active after the amount of polls
+func (s *Server) uploadImageData(w http.ResponseWriter, r *http.Request, res *resource) {
+	if st := res.str("status"); st != "queued" {
+		writeError(w, http.StatusConflict, fmt.Sprintf("image %s has invalid %q status", res.str("id"), st))
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.imageData[res.str("id")] = data
+	res.fields["status"] = "saving"
+	res.fields["size"] = len(data)
+	res.transition(s.Polls, map[string]interface{}{"status": "active"})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// downloadImageData returns the data of the active image, images uploaded by
+// Cinder have a placeholder data
+func (s *Server) downloadImageData(w http.ResponseWriter, res *resource) {
+	if st := res.str("status"); st != "active" {
+		writeError(w, http.StatusConflict, fmt.Sprintf("image %s has invalid %q status", res.str("id"), st))
+		return
+	}
+	data, ok := s.imageData[res.str("id")]
+	if !ok {
+		data = []byte("image data of " + res.str("id"))
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// jsonPointerUnescaper unescapes JSON patch path tokens
+var jsonPointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// patchImage applies the JSON patch to the image
+func (s *Server) patchImage(w http.ResponseWriter, r *http.Request, res *resource) {
+	var ops []struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}
+	if err := readJSON(r, &ops); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, op := range ops {
+		key := jsonPointerUnescaper.Replace(strings.TrimPrefix(op.Path, "/"))
+		switch op.Op {
+		case "add", "replace":
+			res.fields[key] = op.Value
+		case "remove":
+			delete(res.fields, key)
+		default:
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported %q patch operation", op.Op))
+			return
+		}
+	}
+	res.fields["updated_at"] = time.Now().UTC().Format(rfc3339)
+	writeJSON(w, http.StatusOK, res.fields)
+}
+
+// copyImage copies the image to other stores using the "copy-image" import
+// method, the stores are updated after the amount of polls
+func (s *Server) copyImage(w http.ResponseWriter, r *http.Request, res *resource) {
+	var req struct {
+		Method struct {
+			Name string `json:"name"`
+		} `json:"method"`
+		Stores []string `json:"stores"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Method.Name != "copy-image" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported %q import method", req.Method.Name))
+		return
+	}
+	if res.str("status") != "active" {
+		writeError(w, http.StatusConflict, fmt.Sprintf("image %s is not active", res.str("id")))
+		return
+	}
+	stores := strings.Split(res.str("stores"), ",")
+	for _, store := range req.Stores {
+		if !sliceContains(s.ImageStores, store) {
+			writeError(w, http.StatusConflict, fmt.Sprintf("store %s is not available", store))
+			return
+		}
+		if !sliceContains(stores, store) {
+			stores = append(stores, store)
+		}
+	}
+	res.fields["os_glance_importing_to_stores"] = strings.Join(req.Stores, ",")
+	res.transition(s.Polls, map[string]interface{}{
+		"stores":                        strings.Join(stores, ","),
+		"os_glance_importing_to_stores": "",
+		"os_glance_failed_import":       "",
+	})
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// deleteImageFromStore deletes the image data from the store
+func (s *Server) deleteImageFromStore(w http.ResponseWriter, kind, store, id string) {
+	res := s.lookup(w, kind, id)
+	if res == nil {
+		return
+	}
+	if res.fields["protected"] == true {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("image %s is protected and cannot be deleted", id))
+		return
+	}
+	stores := strings.Split(res.str("stores"), ",")
+	if !sliceContains(stores, store) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("image %s is not available in the %s store", id, store))
+		return
+	}
+	if len(stores) == 1 {
+		writeError(w, http.StatusConflict, fmt.Sprintf("image %s must be available in at least one store", id))
+		return
+	}
+	var rest []string
+	for _, v := range stores {
+		if v != store {
+			rest = append(rest, v)
+		}
+	}
+	res.fields["stores"] = strings.Join(rest, ",")
+	w.WriteHeader(http.StatusNoContent)
+}
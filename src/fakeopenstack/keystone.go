@@ -0,0 +1,94 @@
+package fakeopenstack
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// serveKeystone serves the Keystone version discovery and token requests
+func (s *Server) serveKeystone(w http.ResponseWriter, r *http.Request, path []string) {
+	switch {
+	case len(path) == 0 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"versions": map[string]interface{}{
+				"values": []map[string]interface{}{
+					{
+						"id":     "v3.14",
+						"status": "stable",
+						"links": []map[string]string{
+							{"href": s.AuthURL() + "/", "rel": "self"},
+						},
+					},
+				},
+			},
+		})
+	case len(path) == 3 && path[0] == "v3" && path[1] == "auth" && path[2] == "tokens" && r.Method == http.MethodPost:
+		s.createToken(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "the resource could not be found")
+	}
+}
+
+func (s *Server) createToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Auth struct {
+			Identity struct {
+				Methods  []string `json:"methods"`
+				Password struct {
+					User struct {
+						Name     string `json:"name"`
+						Password string `json:"password"`
+					} `json:"user"`
+				} `json:"password"`
+			} `json:"identity"`
+			Scope struct {
+				Project struct {
+					ID   string `json:"id"`
+					Name string `json:"name"`
+				} `json:"project"`
+			} `json:"scope"`
+		} `json:"auth"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	user := req.Auth.Identity.Password.User
+	if user.Name != Username || user.Password != Password {
+		writeError(w, http.StatusUnauthorized, "the request you have made requires authentication")
+		return
+	}
+
+	// the token is scoped to the default project, unless the transfer
+	// project is requested
+	projectID, projectName, token := ProjectID, ProjectName, TokenID
+	switch scope := req.Auth.Scope.Project; {
+	case scope.ID == TransferProjectID || scope.Name == TransferProjectName:
+		projectID, projectName, token = TransferProjectID, TransferProjectName, TransferTokenID
+	case scope.ID != "" && scope.ID != ProjectID, scope.Name != "" && scope.Name != ProjectName:
+		writeError(w, http.StatusUnauthorized, fmt.Sprintf("user %s has no access to the requested project", user.Name))
+		return
+	}
+
+	now := time.Now().UTC()
+	w.Header().Set("X-Subject-Token", token)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"token": map[string]interface{}{
+			"methods":    req.Auth.Identity.Methods,
+			"issued_at":  now.Format(time.RFC3339),
+			"expires_at": now.Add(time.Hour).Format(time.RFC3339),
+			"user": map[string]interface{}{
+				"id":     "fake-user-id",
+				"name":   Username,
+				"domain": map[string]string{"id": "default", "name": "Default"},
+			},
+			"project": map[string]interface{}{
+				"id":     projectID,
+				"name":   projectName,
+				"domain": map[string]string{"id": "default", "name": "Default"},
+			},
+			"catalog": s.catalog(projectID),
+		},
+	})
+}
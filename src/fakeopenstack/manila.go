@@ -0,0 +1,352 @@
+package fakeopenstack
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	minShareMicroversion = "2.0"
+	// the minimum microversion, which supports share replicas
+	replicasMicroversion = "2.11"
+	// the minimum microversion, which supports share access rules API
+	accessRulesMicroversion = "2.45"
+	// the minimum microversion, which supports share snapshot metadata
+	snapshotMetadataMicroversion = "2.73"
+)
+
+var (
+	// share statuses, which allow a share to be deleted
+	shareDeletable = []string{"available", "error", "inactive"}
+)
+
+// AddShare adds a Manila share with its active replica and returns the share
+// ID
+func (s *Server) AddShare(fields map[string]interface{}) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	share := s.store.add(Shares, defaults(Shares, fields))
+	s.store.add(ShareReplicas, defaults(ShareReplicas, map[string]interface{}{
+		"share_id":          share.str("id"),
+		"availability_zone": share.fields["availability_zone"],
+	}))
+	return share.str("id")
+}
+
+// serveManila serves the Manila v2 API
+func (s *Server) serveManila(w http.ResponseWriter, r *http.Request, path []string) {
+	if len(path) == 1 && path[0] == "v2" {
+		// version discovery
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"versions": []map[string]interface{}{
+				{
+					"id":          "v2.0",
+					"status":      "CURRENT",
+					"version":     s.ShareMicroversion,
+					"min_version": minShareMicroversion,
+					"updated":     "2015-08-27T11:33:21Z",
+				},
+			},
+		})
+		return
+	}
+	if len(path) < 3 || path[0] != "v2" || path[1] != ProjectID {
+		writeError(w, http.StatusNotFound, "the resource could not be found")
+		return
+	}
+
+	mv := microversion(r, "share", minShareMicroversion)
+	if !checkMicroversion(w, mv, minShareMicroversion, s.ShareMicroversion) {
+		return
+	}
+	w.Header().Set("X-OpenStack-Manila-API-Version", mv)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	coll, rest := path[2], path[3:]
+	switch coll {
+	case "quota-sets":
+		s.getShareQuotaUsage(w, r, rest, mv)
+	case "shares":
+		s.serveCollection(w, r, rest, collection{
+			kind:   Shares,
+			single: "share",
+			plural: "shares",
+			filter: []string{"name", "status"},
+			create: s.createShare,
+			delete: s.deleteShare,
+			action: s.shareAction,
+		})
+	case "snapshots":
+		s.serveCollection(w, r, rest, collection{
+			kind:   ShareSnapshots,
+			single: "snapshot",
+			plural: "snapshots",
+			filter: []string{"name", "status", "share_id"},
+			create: s.createShareSnapshot,
+			delete: func(w http.ResponseWriter, _ *http.Request, res *resource) bool {
+				return s.startDelete(w, res, deletable, 0)
+			},
+			action: s.statusAction(ShareSnapshots),
+		})
+	case "share-replicas":
+		if compareMicroversions(mv, replicasMicroversion) < 0 {
+			writeError(w, http.StatusNotFound, "the resource could not be found")
+			return
+		}
+		s.serveCollection(w, r, rest, collection{
+			kind:   ShareReplicas,
+			single: "share_replica",
+			plural: "share_replicas",
+			filter: []string{"share_id", "status", "replica_state"},
+			create: s.createShareReplica,
+			delete: s.deleteShareReplica,
+			action: s.shareReplicaAction,
+		})
+	case "share-access-rules":
+		if compareMicroversions(mv, accessRulesMicroversion) < 0 {
+			writeError(w, http.StatusNotFound, "the resource could not be found")
+			return
+		}
+		s.serveAccessRules(w, r, rest)
+	default:
+		writeError(w, http.StatusNotFound, "the resource could not be found")
+	}
+}
+
+func (s *Server) createShare(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Share map[string]interface{} `json:"share"`
+	}
+	if err := readJSON(r, &req); err != nil || req.Share == nil {
+		writeError(w, http.StatusBadRequest, "invalid share request body")
+		return
+	}
+	fields := req.Share
+	if az, _ := fields["availability_zone"].(string); az == "" {
+		delete(fields, "availability_zone")
+	}
+	if id, _ := fields["snapshot_id"].(string); id != "" {
+		snap := s.lookup(w, ShareSnapshots, id)
+		if snap == nil {
+			return
+		}
+		if st := snap.str("status"); st != "available" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("snapshot %s has invalid %q status", id, st))
+			return
+		}
+		if origin := s.store.get(Shares, snap.str("share_id")); origin != nil {
+			// a share created from a snapshot is placed into the source
+			// share availability zone
+			if az, ok := fields["availability_zone"]; ok && az != origin.fields["availability_zone"] {
+				writeError(w, http.StatusBadRequest, "the availability zone of a share created from a snapshot must match the source share availability zone")
+				return
+			}
+			fields["availability_zone"] = origin.fields["availability_zone"]
+			setDefault(fields, "share_type", origin.fields["share_type"])
+			setDefault(fields, "volume_type", origin.fields["volume_type"])
+		}
+	}
+	if toInt(fields["size"]) < 1 {
+		writeError(w, http.StatusBadRequest, "share size must be positive")
+		return
+	}
+	fields["updated_at"] = time.Now().UTC().Format(milliNoZ)
+
+	res := s.create(Shares, fields, "creating", map[string]interface{}{"status": "available"})
+	s.store.add(ShareReplicas, defaults(ShareReplicas, map[string]interface{}{
+		"share_id":          res.str("id"),
+		"availability_zone": res.fields["availability_zone"],
+	}))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"share": res.fields})
+}
+
+func (s *Server) deleteShare(w http.ResponseWriter, r *http.Request, res *resource) bool {
+	id := res.str("id")
+	dependents := len(s.store.list(ShareSnapshots, map[string]string{"share_id": id}))
+	// the active replica is deleted together with the share
+	for _, v := range s.store.list(ShareReplicas, map[string]string{"share_id": id}) {
+		if v.str("replica_state") != "active" {
+			dependents++
+		}
+	}
+	if !s.startDelete(w, res, shareDeletable, dependents) {
+		return false
+	}
+	for _, v := range s.store.list(ShareReplicas, map[string]string{"share_id": id}) {
+		v.scheduleRemoval(s.Polls)
+	}
+	for _, v := range s.store.list(ShareAccessRules, map[string]string{"share_id": id}) {
+		s.store.delete(ShareAccessRules, v.str("id"))
+	}
+	return true
+}
+
+func (s *Server) shareAction(w http.ResponseWriter, r *http.Request, res *resource, action string, body map[string]interface{}) {
+	switch action {
+	case "allow_access":
+		if st := res.str("status"); st != "available" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("share %s has invalid %q status", res.str("id"), st))
+			return
+		}
+		rule := s.store.add(ShareAccessRules, defaults(ShareAccessRules, map[string]interface{}{
+			"share_id":     res.str("id"),
+			"access_type":  body["access_type"],
+			"access_to":    body["access_to"],
+			"access_level": body["access_level"],
+			"state":        "queued_to_apply",
+		}))
+		rule.transition(s.Polls, map[string]interface{}{"state": "active"})
+		writeJSON(w, http.StatusOK, map[string]interface{}{"access": rule.fields})
+	case "access_list":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_list": s.observeAll(ShareAccessRules, map[string]string{"share_id": res.str("id")}),
+		})
+	case "deny_access":
+		id := fmt.Sprint(body["access_id"])
+		if rule := s.store.get(ShareAccessRules, id); rule == nil || rule.str("share_id") != res.str("id") {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("access rule %s could not be found", id))
+			return
+		}
+		s.store.delete(ShareAccessRules, id)
+		w.WriteHeader(http.StatusAccepted)
+	case "extend":
+		newSize := toInt(body["new_size"])
+		if res.str("status") != "available" || newSize <= toInt(res.fields["size"]) {
+			writeError(w, http.StatusBadRequest, "invalid share status or size")
+			return
+		}
+		res.fields["status"] = "extending"
+		res.transition(s.Polls, map[string]interface{}{"status": "available", "size": newSize})
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		s.statusAction(Shares)(w, r, res, action, body)
+	}
+}
+
+func (s *Server) createShareSnapshot(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Snapshot map[string]interface{} `json:"snapshot"`
+	}
+	if err := readJSON(r, &req); err != nil || req.Snapshot == nil {
+		writeError(w, http.StatusBadRequest, "invalid snapshot request body")
+		return
+	}
+	fields := req.Snapshot
+	if fields["metadata"] != nil && compareMicroversions(microversion(r, "share", minShareMicroversion), snapshotMetadataMicroversion) < 0 {
+		writeError(w, http.StatusBadRequest, "additional properties are not allowed ('metadata' was unexpected)")
+		return
+	}
+	share := s.lookup(w, Shares, fmt.Sprint(fields["share_id"]))
+	if share == nil {
+		return
+	}
+	if st := share.str("status"); st != "available" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("share %s has invalid %q status", share.str("id"), st))
+		return
+	}
+	fields["share_proto"] = share.fields["share_proto"]
+	fields["share_size"] = share.fields["size"]
+	fields["size"] = share.fields["size"]
+	delete(fields, "force")
+
+	res := s.create(ShareSnapshots, fields, "creating", map[string]interface{}{"status": "available"})
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"snapshot": res.fields})
+}
+
+func (s *Server) createShareReplica(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Replica map[string]interface{} `json:"share_replica"`
+	}
+	if err := readJSON(r, &req); err != nil || req.Replica == nil {
+		writeError(w, http.StatusBadRequest, "invalid share replica request body")
+		return
+	}
+	fields := req.Replica
+	share := s.lookup(w, Shares, fmt.Sprint(fields["share_id"]))
+	if share == nil {
+		return
+	}
+	if az, _ := fields["availability_zone"].(string); az == "" {
+		fields["availability_zone"] = DefaultAvailabilityZone
+	}
+	fields["replica_state"] = "out_of_sync"
+
+	res := s.create(ShareReplicas, fields, "creating", map[string]interface{}{"status": "available"})
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"share_replica": res.fields})
+}
+
+func (s *Server) deleteShareReplica(w http.ResponseWriter, r *http.Request, res *resource) bool {
+	if res.str("replica_state") == "active" {
+		writeError(w, http.StatusConflict, "cannot delete the active replica of a share")
+		return false
+	}
+	return s.startDelete(w, res, deletable, 0)
+}
+
+func (s *Server) shareReplicaAction(w http.ResponseWriter, r *http.Request, res *resource, action string, body map[string]interface{}) {
+	switch action {
+	case "resync":
+		if res.str("replica_state") == "active" {
+			writeError(w, http.StatusBadRequest, "the active replica cannot be resynced")
+			return
+		}
+		res.transition(s.Polls, map[string]interface{}{"replica_state": "in_sync"})
+		w.WriteHeader(http.StatusAccepted)
+	case "promote":
+		if st := res.str("replica_state"); st != "in_sync" && st != "active" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("replica %s has invalid %q state", res.str("id"), st))
+			return
+		}
+		shareID := res.str("share_id")
+		for _, v := range s.store.list(ShareReplicas, map[string]string{"share_id": shareID, "replica_state": "active"}) {
+			if v != res {
+				v.fields["replica_state"] = "out_of_sync"
+			}
+		}
+		if share := s.store.get(Shares, shareID); share != nil {
+			share.fields["availability_zone"] = res.fields["availability_zone"]
+			share.fields["status"] = "replication_change"
+			share.transition(s.Polls, map[string]interface{}{"status": "available"})
+		}
+		res.fields["status"] = "replication_change"
+		res.transition(s.Polls, map[string]interface{}{"status": "available", "replica_state": "active"})
+		w.WriteHeader(http.StatusAccepted)
+	case "reset_replica_state":
+		state, _ := body["replica_state"].(string)
+		if state == "" {
+			writeError(w, http.StatusBadRequest, "replica_state is required")
+			return
+		}
+		res.fields["replica_state"] = state
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		s.statusAction(ShareReplicas)(w, r, res, action, body)
+	}
+}
+
+// serveAccessRules serves the share access rules API
+func (s *Server) serveAccessRules(w http.ResponseWriter, r *http.Request, path []string) {
+	switch {
+	case len(path) == 0 && r.Method == http.MethodGet:
+		shareID := r.URL.Query().Get("share_id")
+		if shareID == "" {
+			writeError(w, http.StatusBadRequest, "share_id query parameter is required")
+			return
+		}
+		if s.lookup(w, Shares, shareID) == nil {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_list": s.observeAll(ShareAccessRules, map[string]string{"share_id": shareID}),
+		})
+	case len(path) == 1 && r.Method == http.MethodGet:
+		if res := s.observeOne(w, ShareAccessRules, path[0]); res != nil {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"access": res.fields})
+		}
+	default:
+		writeError(w, http.StatusNotFound, "the resource could not be found")
+	}
+}
@@ -0,0 +1,76 @@
+package fakeopenstack
+
+import (
+	"net/http"
+)
+
+// the minimum microversion, which shows Manila quota usage
+const shareQuotaDetailMicroversion = "2.25"
+
+// getVolumeQuotaUsage writes the Cinder quota usage of the project
+func (s *Server) getVolumeQuotaUsage(w http.ResponseWriter, r *http.Request, path []string, project string) {
+	if len(path) != 1 || path[0] != project || r.Method != http.MethodGet || r.URL.Query().Get("usage") != "true" {
+		writeError(w, http.StatusNotFound, "the resource could not be found")
+		return
+	}
+
+	usage := map[string]int{}
+	for _, v := range s.store.list(Volumes, map[string]string{volumeProjectKey: project}) {
+		usage["volumes"]++
+		usage["gigabytes"] += toInt(v.fields["size"])
+	}
+	if project == ProjectID {
+		for _, v := range s.store.list(VolumeSnapshots, nil) {
+			usage["snapshots"]++
+			usage["gigabytes"] += toInt(v.fields["size"])
+		}
+		for _, v := range s.store.list(Backups, nil) {
+			usage["backups"]++
+			usage["backup_gigabytes"] += toInt(v.fields["size"])
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"quota_set": quotaSet(project, s.VolumeQuotas, usage, "volumes", "snapshots", "gigabytes", "backups", "backup_gigabytes"),
+	})
+}
+
+// getShareQuotaUsage writes the Manila quota usage of the project
+func (s *Server) getShareQuotaUsage(w http.ResponseWriter, r *http.Request, path []string, mv string) {
+	if len(path) != 2 || path[0] != ProjectID || path[1] != "detail" || r.Method != http.MethodGet ||
+		compareMicroversions(mv, shareQuotaDetailMicroversion) < 0 {
+		writeError(w, http.StatusNotFound, "the resource could not be found")
+		return
+	}
+
+	usage := map[string]int{}
+	for _, v := range s.store.list(Shares, nil) {
+		usage["shares"]++
+		usage["gigabytes"] += toInt(v.fields["size"])
+	}
+	for _, v := range s.store.list(ShareSnapshots, nil) {
+		usage["snapshots"]++
+		usage["snapshot_gigabytes"] += toInt(v.fields["size"])
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"quota_set": quotaSet(ProjectID, s.ShareQuotas, usage, "shares", "gigabytes", "snapshots", "snapshot_gigabytes"),
+	})
+}
+
+// quotaSet returns the quota limits and usage of the resources, resources
+// without a limit are unlimited
+func quotaSet(project string, limits, usage map[string]int, resources ...string) map[string]interface{} {
+	set := map[string]interface{}{"id": project}
+	for _, resource := range resources {
+		limit, ok := limits[resource]
+		if !ok {
+			limit = -1
+		}
+		set[resource] = map[string]interface{}{
+			"limit":     limit,
+			"in_use":    usage[resource],
+			"reserved":  0,
+			"allocated": 0,
+		}
+	}
+	return set
+}
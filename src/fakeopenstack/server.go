@@ -0,0 +1,402 @@
+// Package fakeopenstack provides an in-process fake OpenStack cloud
+// (Keystone, Cinder, Glance, Barbican, Manila and Swift) built on top of
+// httptest, which allows to drive the plugins end-to-end in unit tests.
+//
+// The fake cloud simulates resource lifecycles: new resources stay in a
+// transitional status (e.g. "creating") for a configurable number of status
+// polls before they become "available", deleted resources stay in a
+// "deleting" status before they disappear. Resources in a transitional status
+// or with dependent resources cannot be deleted (409 Conflict), deletions can
+// be forced to end up in an "error_deleting" status and requests with an
+// unsupported microversion are rejected (406 Not Acceptable).
+package fakeopenstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	// ProjectID is an ID of the project, which is used to scope the token
+	ProjectID = "fake-project-id"
+	// ProjectName is a name of the project, which is used to scope the token
+	ProjectName = "velero"
+	// TransferProjectID is an ID of the second project, which accepts
+	// Cinder volume transfers
+	TransferProjectID = "fake-transfer-project-id"
+	// TransferProjectName is a name of the second project
+	TransferProjectName = "velero-transfer"
+	// Region is a region name of the service catalog endpoints
+	Region = "RegionOne"
+	// TokenID is an ID of the token issued by the fake Keystone
+	TokenID = "fake-token-id"
+	// TransferTokenID is an ID of the token scoped to the transfer project
+	TransferTokenID = "fake-transfer-token-id"
+	// Username is a name of the user, which is allowed to authenticate
+	Username = "velero"
+	// Password is a password of the user, which is allowed to authenticate
+	Password = "fake-password"
+
+	// DefaultAvailabilityZone is set, when a resource is created without an
+	// availability zone
+	DefaultAvailabilityZone = "nova"
+	// DefaultVolumeType is set, when a volume is created without a volume type
+	DefaultVolumeType = "__DEFAULT__"
+	// PollInterval is a "pollInterval" config of the plugins, which speeds up
+	// the status polls of the fake resources
+	PollInterval = "10ms"
+)
+
+// Server is a fake OpenStack cloud
+type Server struct {
+	*httptest.Server
+
+	// Polls is a number of GET requests, which observe a resource in a
+	// transitional status before the status changes. Defaults to 1.
+	Polls int
+	// VolumeMicroversion is a maximum Cinder API microversion
+	VolumeMicroversion string
+	// ShareMicroversion is a maximum Manila API microversion
+	ShareMicroversion string
+	// VolumeAvailabilityZones is a list of Cinder availability zones.
+	// Defaults to the DefaultAvailabilityZone.
+	VolumeAvailabilityZones []string
+	// VolumeTypes is a list of Cinder volume type names, which are also
+	// used as volume type IDs. Defaults to the DefaultVolumeType.
+	VolumeTypes []string
+	// VolumeTypeEncryption is an encryption type of the volume type names.
+	// Volumes of these volume types are encrypted with a key, which must
+	// exist as the Secrets kind, when the volume is cloned.
+	VolumeTypeEncryption map[string]map[string]interface{}
+	// MultiattachVolumeTypes is a list of volume type names with the
+	// multiattach extra spec, volumes of these types are multi-attach capable
+	MultiattachVolumeTypes []string
+	// VolumeTypeBackends maps volume type names to their backends, a retype
+	// between backends requires the "on-demand" migration policy and the
+	// volume keeps its volume type otherwise. Volume types without a backend
+	// share the default backend.
+	VolumeTypeBackends map[string]string
+	// VolumeQuotas and ShareQuotas are Cinder and Manila quota limits of
+	// the resources, e.g. "snapshots" or "gigabytes". Resources without a
+	// limit are unlimited, the limits are not enforced.
+	VolumeQuotas map[string]int
+	ShareQuotas  map[string]int
+	// ImageStores is a list of Glance stores, the first store is the default
+	// one. Glance multiple stores are disabled, when the list is empty.
+	ImageStores []string
+	// ImageCompression allows Cinder to upload compressed images
+	ImageCompression bool
+	// ImageRegions is a list of additional regions with a Glance endpoint.
+	// Images of an additional region are stored as the ImagesIn kind.
+	ImageRegions []string
+	// NoBackupService makes the backup creation fail with the "503 Service
+	// Unavailable" response code like a cloud without the cinder-backup
+	// service
+	NoBackupService bool
+
+	mu         sync.Mutex
+	store      *store
+	containers map[string]map[string]*object
+	imageData  map[string][]byte
+	calls      []string
+	fails      []*failure
+}
+
+// failure is an injected API call error
+type failure struct {
+	method string
+	path   string
+	code   int
+	count  int
+}
+
+// NewServer starts and returns a new fake OpenStack cloud. The caller should
+// call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		Polls:                   1,
+		VolumeMicroversion:      "3.60",
+		ShareMicroversion:       "2.65",
+		VolumeAvailabilityZones: []string{DefaultAvailabilityZone},
+		VolumeTypes:             []string{DefaultVolumeType},
+		store:                   newStore(),
+		containers:              map[string]map[string]*object{},
+		imageData:               map[string][]byte{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// NewTestServer starts a new fake OpenStack cloud, which is closed when the
+// test finishes, and points the OpenStack environment variables to it
+func NewTestServer(t testing.TB) *Server {
+	s := NewServer()
+	t.Cleanup(s.Close)
+	for k, v := range s.Env() {
+		t.Setenv(k, v)
+	}
+	return s
+}
+
+// AuthURL returns the Keystone endpoint
+func (s *Server) AuthURL() string {
+	return s.URL + "/identity/v3"
+}
+
+// Env returns environment variables, which are required to authenticate
+// against the fake cloud
+func (s *Server) Env() map[string]string {
+	return map[string]string{
+		"OS_AUTH_URL":            s.AuthURL(),
+		"OS_USERNAME":            Username,
+		"OS_PASSWORD":            Password,
+		"OS_PROJECT_ID":          ProjectID,
+		"OS_USER_DOMAIN_NAME":    "Default",
+		"OS_PROJECT_DOMAIN_NAME": "Default",
+		"OS_REGION_NAME":         Region,
+		"OS_AUTH_TYPE":           "password",
+	}
+}
+
+// CloudsYAML returns a clouds.yaml file content with a "velero" cloud of the
+// default project and a "velero-transfer" cloud of the transfer project
+func (s *Server) CloudsYAML() string {
+	var b strings.Builder
+	b.WriteString("clouds:\n")
+	for name, id := range map[string]string{ProjectName: ProjectID, TransferProjectName: TransferProjectID} {
+		fmt.Fprintf(&b, `  %s:
+    auth:
+      auth_url: %s
+      username: %s
+      password: %s
+      project_id: %s
+      user_domain_name: Default
+      project_domain_name: Default
+    region_name: %s
+`, name, s.AuthURL(), Username, Password, id, Region)
+	}
+	return b.String()
+}
+
+// Calls returns a list of performed API calls in a "METHOD /path" format
+func (s *Server) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+// CountCalls returns a number of performed API calls with the method and the
+// path containing the substring
+func (s *Server) CountCalls(method, substr string) int {
+	var n int
+	for _, c := range s.Calls() {
+		if strings.HasPrefix(c, method+" ") && strings.Contains(c, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+// Fail makes the next count API calls with the method and the path containing
+// the substring fail with the HTTP status code
+func (s *Server) Fail(method, substr string, code, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fails = append(s.fails, &failure{
+		method: method,
+		path:   substr,
+		code:   code,
+		count:  count,
+	})
+}
+
+func (s *Server) injectedFailure(r *http.Request) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.fails {
+		if f.count > 0 && f.method == r.Method && strings.Contains(r.URL.Path, f.path) {
+			f.count--
+			return f.code
+		}
+	}
+	return 0
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.calls = append(s.calls, r.Method+" "+r.URL.Path)
+	s.mu.Unlock()
+
+	w.Header().Set("X-Openstack-Request-Id", "req-"+newID())
+
+	if code := s.injectedFailure(r); code != 0 {
+		writeError(w, code, "injected failure")
+		return
+	}
+
+	service, path := splitPath(r.URL.Path)
+	project := tokenProject(r.Header.Get("X-Auth-Token"))
+	if service != "identity" && project == "" {
+		writeError(w, http.StatusUnauthorized, "the request you have made requires authentication")
+		return
+	}
+
+	switch service {
+	case "identity":
+		s.serveKeystone(w, r, path)
+	case "volume":
+		s.serveCinder(w, r, path, project)
+	case "image":
+		s.serveGlance(w, r, path, Region)
+	case "image-region":
+		if len(path) == 0 || !sliceContains(s.ImageRegions, path[0]) {
+			writeError(w, http.StatusNotFound, "unknown region")
+			return
+		}
+		s.serveGlance(w, r, path[1:], path[0])
+	case "key-manager":
+		s.serveBarbican(w, r, path)
+	case "share":
+		s.serveManila(w, r, path)
+	case "object-store":
+		s.serveSwift(w, r, path)
+	default:
+		writeError(w, http.StatusNotFound, "unknown service")
+	}
+}
+
+// tokenProject returns an ID of the project, which the token is scoped to, or
+// an empty string, when the token is not valid
+func tokenProject(token string) string {
+	switch token {
+	case TokenID:
+		return ProjectID
+	case TransferTokenID:
+		return TransferProjectID
+	}
+	return ""
+}
+
+// catalog returns the Keystone service catalog of the project
+func (s *Server) catalog(project string) []map[string]interface{} {
+	services := []struct {
+		name, typ, path string
+	}{
+		{"cinderv3", "volumev3", "/volume/v3/" + project},
+		{"glance", "image", "/image"},
+		{"barbican", "key-manager", "/key-manager/"},
+		{"manilav2", "sharev2", "/share/v2/" + project},
+		{"swift", "object-store", "/object-store/v1/AUTH_" + project},
+	}
+
+	endpoint := func(region, path string) map[string]interface{} {
+		return map[string]interface{}{
+			"id":        newID(),
+			"interface": "public",
+			"region":    region,
+			"region_id": region,
+			"url":       s.URL + path,
+		}
+	}
+
+	var catalog []map[string]interface{}
+	for _, v := range services {
+		endpoints := []map[string]interface{}{endpoint(Region, v.path)}
+		if v.typ == "image" {
+			for _, region := range s.ImageRegions {
+				endpoints = append(endpoints, endpoint(region, "/image-region/"+region))
+			}
+		}
+		catalog = append(catalog, map[string]interface{}{
+			"name":      v.name,
+			"type":      v.typ,
+			"id":        newID(),
+			"endpoints": endpoints,
+		})
+	}
+	return catalog
+}
+
+// splitPath splits the request path into a service name and a list of the
+// remaining path segments
+func splitPath(path string) (string, []string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) == 0 {
+		return "", nil
+	}
+	return parts[0], parts[1:]
+}
+
+// microversion returns the requested API microversion
+func microversion(r *http.Request, service, fallback string) string {
+	if v := r.Header.Get("OpenStack-API-Version"); v != "" {
+		if parts := strings.Fields(v); len(parts) == 2 && strings.HasPrefix(parts[0], service) {
+			return parts[1]
+		}
+	}
+	if service == "share" {
+		if v := r.Header.Get("X-OpenStack-Manila-API-Version"); v != "" {
+			return v
+		}
+	}
+	return fallback
+}
+
+// compareMicroversions returns -1, 0 or 1, when a is less than, equal to or
+// greater than b
+func compareMicroversions(a, b string) int {
+	var aMajor, aMinor, bMajor, bMinor int
+	fmt.Sscanf(a, "%d.%d", &aMajor, &aMinor)
+	fmt.Sscanf(b, "%d.%d", &bMajor, &bMinor)
+	switch {
+	case aMajor != bMajor:
+		return sign(aMajor - bMajor)
+	default:
+		return sign(aMinor - bMinor)
+	}
+}
+
+func sign(v int) int {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	}
+	return 0
+}
+
+// checkMicroversion rejects requests with an unsupported microversion
+func checkMicroversion(w http.ResponseWriter, requested, min, max string) bool {
+	if compareMicroversions(requested, max) > 0 || compareMicroversions(requested, min) < 0 {
+		writeError(w, http.StatusNotAcceptable, fmt.Sprintf("version %s is not supported by the API, minimum is %s and maximum is %s", requested, min, max))
+		return false
+	}
+	return true
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if v != nil {
+		json.NewEncoder(w).Encode(v)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]interface{}{
+		http.StatusText(code): map[string]interface{}{
+			"code":    code,
+			"message": message,
+		},
+	})
+}
@@ -0,0 +1,103 @@
+package fakeopenstack
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/sharedfilesystems/v2/replicas"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newClient(t *testing.T, srv *Server, newFunc func(*gophercloud.ProviderClient, gophercloud.EndpointOpts) (*gophercloud.ServiceClient, error)) *gophercloud.ServiceClient {
+	provider, err := openstack.AuthenticatedClient(gophercloud.AuthOptions{
+		IdentityEndpoint: srv.URL + "/identity/",
+		Username:         Username,
+		Password:         Password,
+		DomainName:       "Default",
+		TenantID:         ProjectID,
+	})
+	require.Nil(t, err)
+	client, err := newFunc(provider, gophercloud.EndpointOpts{Region: Region})
+	require.Nil(t, err)
+	return client
+}
+
+func TestVolumeLifecycle(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	client := newClient(t, srv, openstack.NewBlockStorageV3)
+
+	vol, err := volumes.Create(client, volumes.CreateOpts{Size: 1}).Extract()
+	assert.Nil(t, err)
+	assert.Equal(t, "creating", vol.Status)
+
+	// the volume is "creating" for a single poll
+	vol, err = volumes.Get(client, vol.ID).Extract()
+	assert.Nil(t, err)
+	assert.Equal(t, "creating", vol.Status)
+	err = volumes.Delete(client, vol.ID, nil).ExtractErr()
+	assert.IsType(t, gophercloud.ErrDefault409{}, err)
+
+	vol, err = volumes.Get(client, vol.ID).Extract()
+	assert.Nil(t, err)
+	assert.Equal(t, "available", vol.Status)
+
+	// the volume deletion fails once
+	assert.Nil(t, srv.FailDelete(Volumes, vol.ID, 1))
+	assert.Nil(t, volumes.Delete(client, vol.ID, nil).ExtractErr())
+	vol, err = volumes.Get(client, vol.ID).Extract()
+	assert.Nil(t, err)
+	assert.Equal(t, "deleting", vol.Status)
+	vol, err = volumes.Get(client, vol.ID).Extract()
+	assert.Nil(t, err)
+	assert.Equal(t, "error_deleting", vol.Status)
+
+	// the volume in error_deleting status must be reset first
+	err = volumes.Delete(client, vol.ID, nil).ExtractErr()
+	assert.IsType(t, gophercloud.ErrDefault409{}, err)
+	assert.Nil(t, srv.Update(Volumes, vol.ID, map[string]interface{}{"status": "error"}))
+	assert.Nil(t, volumes.Delete(client, vol.ID, nil).ExtractErr())
+	_, err = volumes.Get(client, vol.ID).Extract()
+	assert.Nil(t, err)
+	_, err = volumes.Get(client, vol.ID).Extract()
+	assert.IsType(t, gophercloud.ErrDefault404{}, err)
+	assert.Nil(t, srv.Get(Volumes, vol.ID))
+}
+
+func TestMicroversions(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.ShareMicroversion = "2.10"
+	client := newClient(t, srv, openstack.NewSharedFileSystemV2)
+	shareID := srv.AddShare(nil)
+
+	client.Microversion = "2.11"
+	_, err := replicas.ListDetail(client, replicas.ListOpts{ShareID: shareID}).AllPages()
+	assert.IsType(t, gophercloud.ErrUnexpectedResponseCode{}, err)
+	assert.Contains(t, err.Error(), "406")
+
+	srv.ShareMicroversion = "2.56"
+	pages, err := replicas.ListDetail(client, replicas.ListOpts{ShareID: shareID}).AllPages()
+	assert.Nil(t, err)
+	all, err := replicas.ExtractReplicas(pages)
+	assert.Nil(t, err)
+	assert.Len(t, all, 1)
+	assert.Equal(t, "active", all[0].State)
+}
+
+func TestFail(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	client := newClient(t, srv, openstack.NewBlockStorageV3)
+	id := srv.Add(Volumes, nil)
+
+	srv.Fail("GET", "/volumes/"+id, 500, 1)
+	_, err := volumes.Get(client, id).Extract()
+	assert.IsType(t, gophercloud.ErrDefault500{}, err)
+	_, err = volumes.Get(client, id).Extract()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, srv.CountCalls("GET", "/volumes/"+id))
+}
@@ -0,0 +1,354 @@
+package fakeopenstack
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// resource kinds
+const (
+	Volumes          = "volumes"
+	VolumeSnapshots  = "volume-snapshots"
+	Backups          = "backups"
+	Images           = "images"
+	Shares           = "shares"
+	ShareSnapshots   = "share-snapshots"
+	ShareReplicas    = "share-replicas"
+	ShareAccessRules = "share-access-rules"
+	Groups           = "groups"
+	GroupSnapshots   = "group-snapshots"
+	VolumeTransfers  = "volume-transfers"
+	Secrets          = "secrets"
+)
+
+// timestamp formats
+const (
+	// used by Cinder and Manila
+	milliNoZ = "2006-01-02T15:04:05.000000"
+	// used by Glance
+	rfc3339 = time.RFC3339
+)
+
+// resource is a fake OpenStack resource
+type resource struct {
+	seq    int
+	fields map[string]interface{}
+	// pending field values applied after the amount of polls
+	pending map[string]interface{}
+	polls   int
+	// the resource is removed, when the pending values are applied
+	remove bool
+	// the amount of deletions, which end up in an error_deleting status
+	failDelete int
+}
+
+// store keeps the fake resources of all kinds
+type store struct {
+	seq       int
+	resources map[string]map[string]*resource
+}
+
+func newStore() *store {
+	return &store{
+		resources: map[string]map[string]*resource{},
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func (st *store) add(kind string, fields map[string]interface{}) *resource {
+	if st.resources[kind] == nil {
+		st.resources[kind] = map[string]*resource{}
+	}
+	if _, ok := fields["id"]; !ok {
+		fields["id"] = newID()
+	}
+	st.seq++
+	r := &resource{
+		seq:    st.seq,
+		fields: fields,
+	}
+	st.resources[kind][fields["id"].(string)] = r
+	return r
+}
+
+func (st *store) get(kind, id string) *resource {
+	return st.resources[kind][id]
+}
+
+// list returns resources of the kind sorted by the creation order, which
+// match all the filter values
+func (st *store) list(kind string, filter map[string]string) []*resource {
+	var res []*resource
+	for _, r := range st.resources[kind] {
+		if r.matches(filter) {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].seq < res[j].seq
+	})
+	return res
+}
+
+func (st *store) delete(kind, id string) {
+	delete(st.resources[kind], id)
+}
+
+// observe applies the pending resource changes, when the resource was polled
+// enough times, and returns false, when the resource was removed
+func (st *store) observe(kind string, r *resource) bool {
+	if r.pending == nil {
+		return true
+	}
+	if r.polls > 0 {
+		r.polls--
+		return true
+	}
+	if r.remove {
+		st.delete(kind, r.fields["id"].(string))
+		if parent := st.get(Backups, r.str("parent_id")); kind == Backups && parent != nil {
+			parent.fields["has_dependent_backups"] = len(st.list(Backups, map[string]string{"parent_id": parent.str("id")})) > 0
+		}
+		return false
+	}
+	for k, v := range r.pending {
+		r.fields[k] = v
+	}
+	r.pending = nil
+	return true
+}
+
+// transition schedules the resource fields change after the amount of polls
+func (r *resource) transition(polls int, fields map[string]interface{}) {
+	r.pending = fields
+	r.polls = polls
+	r.remove = false
+}
+
+// scheduleRemoval schedules the resource removal after the amount of polls
+func (r *resource) scheduleRemoval(polls int) {
+	r.pending = map[string]interface{}{}
+	r.polls = polls
+	r.remove = true
+}
+
+func (r *resource) str(key string) string {
+	v, _ := r.fields[key].(string)
+	return v
+}
+
+func (r *resource) matches(filter map[string]string) bool {
+	for k, v := range filter {
+		if v != "" && fmt.Sprint(r.fields[k]) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// copyFields returns a shallow copy of the resource fields
+func (r *resource) copyFields() map[string]interface{} {
+	m := make(map[string]interface{}, len(r.fields))
+	for k, v := range r.fields {
+		m[k] = v
+	}
+	return m
+}
+
+// Add adds a resource of the kind and returns its ID. Use AddShare to add
+// Manila shares with their active replica.
+func (s *Server) Add(kind string, fields map[string]interface{}) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.add(kind, defaults(kind, fields)).str("id")
+}
+
+// Get returns a copy of the resource fields or nil, when the resource doesn't
+// exist
+func (s *Server) Get(kind, id string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.store.get(kind, id)
+	if r == nil {
+		return nil
+	}
+	return r.copyFields()
+}
+
+// List returns copies of the resources of the kind, which match the filter
+func (s *Server) List(kind string, filter map[string]string) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []map[string]interface{}
+	for _, r := range s.store.list(kind, filter) {
+		res = append(res, r.copyFields())
+	}
+	return res
+}
+
+// Update sets the resource fields
+func (s *Server) Update(kind, id string, fields map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.store.get(kind, id)
+	if r == nil {
+		return fmt.Errorf("%s %s not found", kind, id)
+	}
+	for k, v := range fields {
+		r.fields[k] = v
+	}
+	return nil
+}
+
+// Delete removes the resource immediately, e.g. to simulate a lost cloud
+func (s *Server) Delete(kind, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store.delete(kind, id)
+}
+
+// FailDelete makes the next count deletions of the resource end up in an
+// "error_deleting" status
+func (s *Server) FailDelete(kind, id string, count int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.store.get(kind, id)
+	if r == nil {
+		return fmt.Errorf("%s %s not found", kind, id)
+	}
+	r.failDelete = count
+	return nil
+}
+
+// defaults sets default resource fields
+func defaults(kind string, fields map[string]interface{}) map[string]interface{} {
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	set := func(k string, v interface{}) {
+		if _, ok := fields[k]; !ok {
+			fields[k] = v
+		}
+	}
+
+	now := time.Now().UTC()
+	switch kind {
+	case Images:
+		set("status", "active")
+		set("visibility", "private")
+		set("created_at", now.Format(rfc3339))
+		set("updated_at", now.Format(rfc3339))
+	case ShareReplicas:
+		set("status", "available")
+		set("replica_state", "active")
+		set("availability_zone", DefaultAvailabilityZone)
+		set("created_at", now.Format(milliNoZ))
+	case ShareAccessRules:
+		set("state", "active")
+		set("access_level", "rw")
+		set("access_key", "")
+		set("created_at", now.Format(milliNoZ))
+	default:
+		set("status", "available")
+		set("size", 1)
+		set("metadata", map[string]string{})
+		set("created_at", now.Format(milliNoZ))
+	}
+	switch kind {
+	case Volumes, Shares:
+		set("availability_zone", DefaultAvailabilityZone)
+	}
+	switch kind {
+	case Volumes:
+		set("volume_type", DefaultVolumeType)
+		set(volumeProjectKey, ProjectID)
+		set("encrypted", false)
+	case Shares:
+		set("share_proto", "NFS")
+		set("share_type", "default")
+		set("volume_type", "default")
+	}
+
+	return fields
+}
+
+// lookup returns the resource or writes a 404 response
+func (s *Server) lookup(w http.ResponseWriter, kind, id string) *resource {
+	r := s.store.get(kind, id)
+	if r == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s could not be found", kind, id))
+		return nil
+	}
+	return r
+}
+
+// observeOne returns the observed resource or writes a 404 response. Only GET
+// requests observe resources and make their pending changes happen.
+func (s *Server) observeOne(w http.ResponseWriter, kind, id string) *resource {
+	r := s.store.get(kind, id)
+	if r == nil || !s.store.observe(kind, r) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s could not be found", kind, id))
+		return nil
+	}
+	return r
+}
+
+// observeAll returns the observed resources of the kind, which match the
+// filter
+func (s *Server) observeAll(kind string, filter map[string]string) []map[string]interface{} {
+	res := []map[string]interface{}{}
+	for _, r := range s.store.list(kind, nil) {
+		if s.store.observe(kind, r) && r.matches(filter) {
+			res = append(res, r.copyFields())
+		}
+	}
+	return res
+}
+
+// create adds a new resource in a transitional status, which turns into the
+// final status after the amount of polls
+func (s *Server) create(kind string, fields map[string]interface{}, status string, final map[string]interface{}) *resource {
+	fields["status"] = status
+	r := s.store.add(kind, defaults(kind, fields))
+	r.transition(s.Polls, final)
+	return r
+}
+
+// startDelete puts the resource into a "deleting" status or writes a 409
+// response, when the resource is busy or has dependent resources
+func (s *Server) startDelete(w http.ResponseWriter, r *resource, deletable []string, dependents int) bool {
+	if status := r.str("status"); !sliceContains(deletable, status) {
+		writeError(w, http.StatusConflict, fmt.Sprintf("invalid status %q, must be one of %q", status, deletable))
+		return false
+	}
+	if dependents > 0 {
+		writeError(w, http.StatusConflict, fmt.Sprintf("resource still has %d dependent resources", dependents))
+		return false
+	}
+
+	r.fields["status"] = "deleting"
+	if r.failDelete > 0 {
+		r.failDelete--
+		r.transition(s.Polls, map[string]interface{}{"status": "error_deleting"})
+		return true
+	}
+	r.scheduleRemoval(s.Polls)
+	return true
+}
+
+func sliceContains(elems []string, e string) bool {
+	for _, v := range elems {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
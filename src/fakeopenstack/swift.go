@@ -0,0 +1,232 @@
+package fakeopenstack
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// object is a fake Swift object
+type object struct {
+	data         []byte
+	contentType  string
+	lastModified time.Time
+	metadata     http.Header
+}
+
+func (o *object) etag() string {
+	return fmt.Sprintf("%x", md5.Sum(o.data))
+}
+
+// PutObject stores the Swift object and creates the container if it doesn't
+// exist
+func (s *Server) PutObject(container, name string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.containers[container] == nil {
+		s.containers[container] = map[string]*object{}
+	}
+	s.containers[container][name] = &object{
+		data:         data,
+		contentType:  "application/octet-stream",
+		lastModified: time.Now().UTC(),
+	}
+}
+
+// AddContainer creates the Swift container
+func (s *Server) AddContainer(container string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.containers[container] == nil {
+		s.containers[container] = map[string]*object{}
+	}
+}
+
+// GetObject returns the Swift object data and false, when the object doesn't
+// exist
+func (s *Server) GetObject(container, name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.containers[container][name]
+	if !ok {
+		return nil, false
+	}
+	return o.data, true
+}
+
+// serveSwift serves the Swift v1 API
+func (s *Server) serveSwift(w http.ResponseWriter, r *http.Request, path []string) {
+	if len(path) < 2 || path[0] != "v1" || path[1] != "AUTH_"+ProjectID {
+		writeError(w, http.StatusNotFound, "the resource could not be found")
+		return
+	}
+	w.Header().Set("X-Trans-Id", "tx"+strings.ReplaceAll(newID(), "-", ""))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path = path[2:]
+	switch len(path) {
+	case 0:
+		var names []string
+		for name := range s.containers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		s.listSwift(w, r, names, func(name string) map[string]interface{} {
+			return map[string]interface{}{"name": name, "count": len(s.containers[name])}
+		})
+	case 1:
+		s.serveContainer(w, r, path[0])
+	default:
+		s.serveObject(w, r, path[0], strings.Join(path[1:], "/"))
+	}
+}
+
+func (s *Server) serveContainer(w http.ResponseWriter, r *http.Request, container string) {
+	objects, ok := s.containers[container]
+	switch r.Method {
+	case http.MethodPut:
+		if ok {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		s.containers[container] = map[string]*object{}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodHead:
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("X-Container-Object-Count", fmt.Sprint(len(objects)))
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if len(objects) > 0 {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		delete(s.containers, container)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		prefix := r.URL.Query().Get("prefix")
+		delimiter := r.URL.Query().Get("delimiter")
+		var names []string
+		subdirs := map[string]bool{}
+		for name := range objects {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			if delimiter != "" {
+				if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+					subdir := name[:len(prefix)+i+len(delimiter)]
+					if !subdirs[subdir] {
+						subdirs[subdir] = true
+						names = append(names, subdir)
+					}
+					continue
+				}
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		s.listSwift(w, r, names, func(name string) map[string]interface{} {
+			if subdirs[name] {
+				return map[string]interface{}{"subdir": name}
+			}
+			o := objects[name]
+			return map[string]interface{}{
+				"name":          name,
+				"bytes":         len(o.data),
+				"hash":          o.etag(),
+				"content_type":  o.contentType,
+				"last_modified": o.lastModified.Format(milliNoZ),
+			}
+		})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// listSwift writes a JSON list of sorted names starting after the marker
+func (s *Server) listSwift(w http.ResponseWriter, r *http.Request, names []string, item func(string) map[string]interface{}) {
+	marker := r.URL.Query().Get("marker")
+	list := []map[string]interface{}{}
+	for _, name := range names {
+		if marker == "" || name > marker {
+			list = append(list, item(name))
+		}
+	}
+	if len(list) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) serveObject(w http.ResponseWriter, r *http.Request, container, name string) {
+	objects, ok := s.containers[container]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	o, exists := objects[name]
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		o = &object{
+			data:         data,
+			contentType:  r.Header.Get("Content-Type"),
+			lastModified: time.Now().UTC(),
+			metadata:     http.Header{},
+		}
+		for k, v := range r.Header {
+			if strings.HasPrefix(k, "X-Object-Meta-") {
+				o.metadata[k] = v
+			}
+		}
+		objects[name] = o
+		w.Header().Set("ETag", o.etag())
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet, http.MethodHead:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for k, v := range o.metadata {
+			w.Header()[k] = v
+		}
+		w.Header().Set("ETag", o.etag())
+		w.Header().Set("Content-Type", o.contentType)
+		w.Header().Set("Content-Length", fmt.Sprint(len(o.data)))
+		w.Header().Set("Last-Modified", o.lastModified.Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(o.data)
+		}
+	case http.MethodDelete:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
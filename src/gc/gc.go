@@ -0,0 +1,152 @@
+// Package gc implements the "gc" subcommand of the plugin binary, which finds
+// Cinder, Glance and Manila resources left behind by aborted Velero backups
+// and restores, and reports or deletes them.
+package gc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/cinder"
+	"github.com/Lirt/velero-plugin-for-openstack/src/manila"
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	veleroclient "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Options are the garbage collector options
+type Options struct {
+	// Velero namespace
+	Namespace string
+	// OpenStack services to scan, "cinder" includes the Glance images
+	Services []string
+	// volume snapshot location config, e.g. the cloud or region
+	Config map[string]string
+	// resources younger than MinAge are never collected
+	MinAge time.Duration
+	// deletes the orphans, otherwise they are only reported
+	Delete bool
+}
+
+// Run runs the "gc" subcommand with the command line arguments and writes a
+// report of the orphaned resources into out
+func Run(args []string, out io.Writer, log logrus.FieldLogger) error {
+	var opts Options
+	flags := pflag.NewFlagSet("gc", pflag.ContinueOnError)
+	flags.StringVar(&opts.Namespace, "namespace", utils.GetEnv("VELERO_NAMESPACE", "velero"), "Velero namespace")
+	flags.StringSliceVar(&opts.Services, "services", []string{"cinder", "manila"}, `OpenStack services to scan, "cinder" includes Glance images`)
+	flags.StringToStringVar(&opts.Config, "config", nil, "volume snapshot location config, e.g. cloud=cloud1,region=RegionOne")
+	flags.DurationVar(&opts.MinAge, "min-age", 24*time.Hour, "minimum age of the collected resources")
+	flags.BoolVar(&opts.Delete, "delete", false, "delete the orphaned resources instead of reporting them only")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get in-cluster Kubernetes config: %w", err)
+	}
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	veleroClient, err := veleroclient.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create Velero client: %w", err)
+	}
+
+	orphans, err := Collect(context.Background(), opts, kubeClient, veleroClient, log)
+	if e := WriteReport(out, orphans); e != nil {
+		return e
+	}
+	return err
+}
+
+// Collect finds the orphaned resources of the OpenStack services created by
+// the Velero installation in the namespace, which don't belong to any Velero
+// backup in the namespace, and deletes them, when the Delete option is set
+func Collect(ctx context.Context, opts Options, kubeClient kubernetes.Interface, veleroClient veleroclient.Interface, log logrus.FieldLogger) ([]utils.Orphan, error) {
+	logWithFields := log.WithFields(logrus.Fields{
+		"namespace": opts.Namespace,
+		"services":  opts.Services,
+		"minAge":    opts.MinAge,
+		"delete":    opts.Delete,
+	})
+
+	backups, err := veleroClient.VeleroV1().Backups(opts.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Velero backups in the %q namespace: %w", opts.Namespace, err)
+	}
+	if len(backups.Items) == 0 && opts.Delete {
+		// a wrong namespace would make all the plugin resources orphans
+		return nil, fmt.Errorf("refusing to delete orphaned resources, there are no Velero backups in the %q namespace", opts.Namespace)
+	}
+	// resources of other clusters or Velero installations sharing the
+	// project are never collected
+	installation, err := utils.InstallationID(ctx, kubeClient, opts.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Velero installation ID: %w", err)
+	}
+
+	c := &utils.OrphanCollector{
+		Backups:      make(map[string]bool, len(backups.Items)),
+		Installation: installation,
+		MinAge:       opts.MinAge,
+		Delete:       opts.Delete,
+		Log:          logWithFields,
+	}
+	for _, backup := range backups.Items {
+		c.Backups[backup.Name] = true
+	}
+	logWithFields.WithFields(logrus.Fields{
+		"backups":      len(c.Backups),
+		"installation": installation,
+	}).Info("Collecting orphaned resources")
+
+	for _, service := range opts.Services {
+		var store interface {
+			Init(map[string]string) error
+			CollectOrphans(*utils.OrphanCollector) error
+		}
+		switch service {
+		case "cinder":
+			store = cinder.NewBlockStore(log)
+		case "manila":
+			store = manila.NewFSStore(log)
+		default:
+			return c.Orphans, fmt.Errorf("unsupported %q service, supported services: %q", service, []string{"cinder", "manila"})
+		}
+		if err := store.Init(utils.Merge(opts.Config)); err != nil {
+			return c.Orphans, fmt.Errorf("failed to initialize %s: %w", service, err)
+		}
+		if err := store.CollectOrphans(c); err != nil {
+			return c.Orphans, fmt.Errorf("failed to collect %s orphaned resources: %w", service, err)
+		}
+	}
+
+	return c.Orphans, c.Err()
+}
+
+// WriteReport writes a table of the orphaned resources
+func WriteReport(out io.Writer, orphans []utils.Orphan) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tKIND\tID\tNAME\tBACKUP\tREASON\tSTATUS")
+	for _, o := range orphans {
+		status := "orphaned"
+		switch {
+		case o.Deleted:
+			status = "deleted"
+		case o.Error != nil:
+			status = "delete failed"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", o.Service, o.Kind, o.ID, o.Name, o.Backup, o.Reason, status)
+	}
+	return w.Flush()
+}
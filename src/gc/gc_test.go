@@ -0,0 +1,165 @@
+package gc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/fakeopenstack"
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	velerofake "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned/fake"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+// a creation time of resources older than the minimum age
+const created = "2020-01-01T00:00:00.000000"
+
+func TestCollect(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	// share snapshots keep the metadata since the 2.73 microversion
+	srv.ShareMicroversion = "2.73"
+	installation := "cluster-uid/velero"
+	owned := func(backup string) map[string]string {
+		return map[string]string{
+			utils.BackupTag:       backup,
+			utils.VersionKey:      "v1",
+			utils.InstallationKey: installation,
+		}
+	}
+	existing := owned("existing")
+	deleted := owned("deleted")
+	// resources of another cluster sharing the project
+	foreign := utils.Merge(deleted, map[string]string{utils.InstallationKey: "other-cluster-uid/velero"})
+
+	volumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{"created_at": created})
+	// snapshots of the deleted backup and intermediate snapshots are orphans
+	orphanedSnapshotID := srv.Add(fakeopenstack.VolumeSnapshots, map[string]interface{}{
+		"name": volumeID + ".snap.1", "metadata": deleted, "volume_id": volumeID, "created_at": created,
+	})
+	tempSnapshotID := srv.Add(fakeopenstack.VolumeSnapshots, map[string]interface{}{
+		"name": volumeID + ".backup.2", "description": "Velero temp snapshot", "metadata": existing, "volume_id": volumeID, "created_at": created,
+	})
+	srv.Add(fakeopenstack.VolumeSnapshots, map[string]interface{}{
+		"name": volumeID + ".snap.3", "metadata": existing, "volume_id": volumeID, "created_at": created,
+	})
+	// snapshots younger than the minimum age may belong to a running backup
+	srv.Add(fakeopenstack.VolumeSnapshots, map[string]interface{}{
+		"name": volumeID + ".snap.4", "metadata": deleted, "volume_id": volumeID,
+	})
+	// snapshots of other clusters and snapshots without the ownership
+	// metadata are never collected
+	foreignSnapshotID := srv.Add(fakeopenstack.VolumeSnapshots, map[string]interface{}{
+		"name": volumeID + ".snap.5", "metadata": foreign, "volume_id": volumeID, "created_at": created,
+	})
+	srv.Add(fakeopenstack.VolumeSnapshots, map[string]interface{}{
+		"name": volumeID + ".snap.6", "description": "Velero temp snapshot", "metadata": map[string]string{utils.BackupTag: "deleted"}, "volume_id": volumeID, "created_at": created,
+	})
+	// detached restored volumes belong to the restored workloads
+	restoredVolumeID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{
+		"name": "restored", "description": "Velero backup from snapshot", "metadata": deleted, "created_at": created,
+	})
+	cloneID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{
+		"name": volumeID + ".clone.7", "metadata": deleted, "created_at": created,
+	})
+	foreignCloneID := srv.Add(fakeopenstack.Volumes, map[string]interface{}{
+		"name": volumeID + ".clone.8", "metadata": foreign, "created_at": created,
+	})
+	backupID := srv.Add(fakeopenstack.Backups, map[string]interface{}{
+		"name": "custom-name", "metadata": deleted, "volume_id": volumeID, "created_at": created,
+	})
+	foreignBackupID := srv.Add(fakeopenstack.Backups, map[string]interface{}{
+		"name": "custom-name", "metadata": foreign, "volume_id": volumeID, "created_at": created,
+	})
+	imageID := srv.Add(fakeopenstack.Images, map[string]interface{}{
+		"name": volumeID + ".image.9", "created_at": "2020-01-01T00:00:00Z",
+		"velero_tag:" + utils.BackupTag:       "deleted",
+		"velero_tag:" + utils.VersionKey:      "v1",
+		"velero_tag:" + utils.InstallationKey: installation,
+	})
+	srv.Add(fakeopenstack.Images, map[string]interface{}{
+		"name": volumeID + ".image.10", "velero_tag:" + utils.BackupTag: "deleted", "created_at": "2020-01-01T00:00:00Z",
+	})
+	shareID := srv.AddShare(map[string]interface{}{"created_at": created})
+	srv.Add(fakeopenstack.ShareSnapshots, map[string]interface{}{
+		"name": shareID + ".snap.11", "description": "Velero snapshot", "metadata": deleted, "share_id": shareID, "created_at": created,
+	})
+	tempShareSnapshotID := srv.Add(fakeopenstack.ShareSnapshots, map[string]interface{}{
+		"name": shareID + ".clone.12", "description": "Velero temp snapshot", "metadata": deleted, "share_id": shareID, "created_at": created,
+	})
+	shareCloneID := srv.AddShare(map[string]interface{}{
+		"name": shareID + ".clone.12", "metadata": deleted, "created_at": created,
+	})
+	srv.AddShare(map[string]interface{}{
+		"name": shareID + ".clone.13", "metadata": existing, "created_at": created,
+	})
+	restoredShareID := srv.AddShare(map[string]interface{}{
+		"name": "restored", "description": "Velero backup from snapshot", "metadata": deleted, "created_at": created,
+	})
+
+	kubeClient := k8sfake.NewSimpleClientset(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "cluster-uid"},
+	})
+	veleroClient := velerofake.NewSimpleClientset(&velerov1.Backup{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "velero"},
+	})
+	opts := Options{
+		Namespace: "velero",
+		Services:  []string{"cinder", "manila"},
+		Config:    map[string]string{"ensureDeleted": "true", "ensureDeletedDelay": "0s", "pollInterval": fakeopenstack.PollInterval},
+		MinAge:    time.Hour,
+	}
+
+	// orphans are only reported by default
+	orphans, err := Collect(context.Background(), opts, kubeClient, veleroClient, logrus.New())
+	require.Nil(t, err)
+	ids := map[string]string{}
+	for _, o := range orphans {
+		assert.False(t, o.Deleted)
+		ids[o.ID] = o.Service + "/" + o.Kind
+	}
+	assert.Equal(t, map[string]string{
+		orphanedSnapshotID:  "cinder/snapshot",
+		tempSnapshotID:      "cinder/snapshot",
+		cloneID:             "cinder/volume",
+		backupID:            "cinder/backup",
+		imageID:             "glance/image",
+		tempShareSnapshotID: "manila/snapshot",
+		shareCloneID:        "manila/share",
+	}, ids)
+	assert.NotNil(t, srv.Get(fakeopenstack.VolumeSnapshots, orphanedSnapshotID))
+
+	out := &bytes.Buffer{}
+	require.Nil(t, WriteReport(out, orphans))
+	assert.Contains(t, out.String(), "SERVICE  KIND")
+	assert.Regexp(t, "cinder +backup +"+backupID+" +custom-name +deleted +backup doesn't exist +orphaned", out.String())
+
+	opts.Delete = true
+	orphans, err = Collect(context.Background(), opts, kubeClient, veleroClient, logrus.New())
+	require.Nil(t, err)
+	assert.Len(t, orphans, len(ids))
+	for _, o := range orphans {
+		assert.True(t, o.Deleted, o.ID)
+	}
+	assert.Nil(t, srv.Get(fakeopenstack.VolumeSnapshots, orphanedSnapshotID))
+	assert.Nil(t, srv.Get(fakeopenstack.Volumes, cloneID))
+	assert.Nil(t, srv.Get(fakeopenstack.Images, imageID))
+	assert.Nil(t, srv.Get(fakeopenstack.Shares, shareCloneID))
+	assert.NotNil(t, srv.Get(fakeopenstack.VolumeSnapshots, foreignSnapshotID))
+	assert.NotNil(t, srv.Get(fakeopenstack.Volumes, foreignCloneID))
+	assert.NotNil(t, srv.Get(fakeopenstack.Backups, foreignBackupID))
+	assert.NotNil(t, srv.Get(fakeopenstack.Volumes, restoredVolumeID))
+	assert.NotNil(t, srv.Get(fakeopenstack.Shares, restoredShareID))
+	assert.Len(t, srv.List(fakeopenstack.Shares, nil), 3)
+
+	// a wrong namespace would make all the resources orphans
+	opts.Namespace = "default"
+	_, err = Collect(context.Background(), opts, kubeClient, veleroClient, logrus.New())
+	assert.ErrorContains(t, err, `there are no Velero backups in the "default" namespace`)
+}
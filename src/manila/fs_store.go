@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
 	"github.com/gophercloud/gophercloud"
@@ -16,10 +17,12 @@ import (
 	"github.com/gophercloud/gophercloud/openstack/sharedfilesystems/v2/shares"
 	"github.com/gophercloud/gophercloud/openstack/sharedfilesystems/v2/snapshots"
 	"github.com/sirupsen/logrus"
+	veleroclient "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned"
 	velerovolumesnapshotter "github.com/vmware-tanzu/velero/pkg/plugin/velero/volumesnapshotter/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
 )
 
 const (
@@ -29,6 +32,7 @@ const (
 	replicasMicroversion       = "2.56"
 	defaultTimeout             = "5m"
 	defaultDeleteDelay         = "10s"
+	defaultDeleteConcurrency   = "10"
 )
 
 var (
@@ -75,9 +79,18 @@ type FSStore struct {
 	replicaTimeout     int
 	ensureDeleted      bool
 	ensureDeletedDelay int
+	pollInterval       time.Duration
+	deleteConcurrency  int
 	cascadeDelete      bool
 	enforceAZ          bool
-	log                logrus.FieldLogger
+	quotaCheck         bool
+	quotaMargin        int
+	snapshotMetadata   bool
+	kubeClient         kubernetes.Interface
+	// veleroClient is used to get the backup UID, which the backup
+	// resource names are derived from
+	veleroClient veleroclient.Interface
+	log          logrus.FieldLogger
 }
 
 // NewFSStore instantiates a Manila Shared Filesystem Snapshotter.
@@ -92,7 +105,7 @@ var _ velerovolumesnapshotter.VolumeSnapshotter = (*FSStore)(nil)
 // cannot be initialized from the provided config.
 func (b *FSStore) Init(config map[string]string) error {
 	b.log.WithFields(logrus.Fields{
-		"config": config,
+		"config": utils.RedactConfig(config),
 	}).Info("FSStore.Init called")
 	b.config = config
 
@@ -123,6 +136,10 @@ func (b *FSStore) Init(config map[string]string) error {
 	if err != nil {
 		return fmt.Errorf("cannot parse time from replicaTimeout config variable: %w", err)
 	}
+	b.pollInterval, err = utils.ParsePollInterval(b.config)
+	if err != nil {
+		return err
+	}
 	// parse options
 	b.ensureDeleted, err = strconv.ParseBool(utils.GetConf(b.config, "ensureDeleted", "false"))
 	if err != nil {
@@ -140,6 +157,21 @@ func (b *FSStore) Init(config map[string]string) error {
 	if err != nil {
 		return fmt.Errorf("cannot parse cascadeDelete config variable: %w", err)
 	}
+	b.quotaCheck, err = strconv.ParseBool(utils.GetConf(b.config, "quotaCheck", "false"))
+	if err != nil {
+		return fmt.Errorf("cannot parse quotaCheck config variable: %w", err)
+	}
+	b.quotaMargin, err = utils.ParseQuotaMargin(utils.GetConf(b.config, "quotaMargin", "0"))
+	if err != nil {
+		return fmt.Errorf("cannot parse quotaMargin config variable: %w", err)
+	}
+	b.deleteConcurrency, err = strconv.Atoi(utils.GetConf(b.config, "deleteConcurrency", defaultDeleteConcurrency))
+	if err != nil {
+		return fmt.Errorf("cannot parse deleteConcurrency config variable: %w", err)
+	}
+	if b.deleteConcurrency < 1 {
+		return fmt.Errorf("deleteConcurrency config variable must be positive")
+	}
 
 	// Authenticate to Openstack
 	err = utils.Authenticate(&b.provider, "manila", config, b.log)
@@ -161,7 +193,7 @@ func (b *FSStore) Init(config map[string]string) error {
 			Region: region,
 		})
 		if err != nil {
-			return fmt.Errorf("failed to create manila storage client: %w", err)
+			return utils.WithRequestID(fmt.Errorf("failed to create manila storage client: %w", err))
 		}
 
 		logWithFields := b.log.WithFields(logrus.Fields{
@@ -171,8 +203,9 @@ func (b *FSStore) Init(config map[string]string) error {
 
 		// set minimum supported Manila API microversion by default
 		b.client.Microversion = minSupportedMicroversion
-		if mv, err := b.getManilaMicroversion(); err != nil {
-			logWithFields.Warningf("Failed to obtain supported Manila microversions (using the default one: %v): %v", b.client.Microversion, err)
+		mv, mvErr := b.getManilaMicroversion()
+		if mvErr != nil {
+			logWithFields.Warningf("Failed to obtain supported Manila microversions (using the default one: %v): %v", b.client.Microversion, mvErr)
 		} else if b.enforceAZ {
 			// enforce new Manila path microversion
 			ok, err := utils.CompareMicroversions("lte", replicasMicroversion, mv)
@@ -197,6 +230,12 @@ func (b *FSStore) Init(config map[string]string) error {
 			}
 		}
 
+		// snapshot metadata is supported since the 2.73 microversion
+		b.snapshotMetadata = false
+		if mvErr == nil {
+			b.snapshotMetadata, _ = utils.CompareMicroversions("lte", snapshotMetadataMicroversion, mv)
+		}
+
 		logWithFields.Info("Successfully created shared filesystem service client")
 	}
 
@@ -207,15 +246,36 @@ func (b *FSStore) Init(config map[string]string) error {
 // availability zone, initialized from the provided snapshot and with the specified type.
 // IOPS is ignored as it is not used in Manila.
 func (b *FSStore) CreateVolumeFromSnapshot(snapshotID, volumeType, volumeAZ string, iops *int64) (string, error) {
+	tags, err := b.getSnapshotTags(snapshotID)
+	if err != nil {
+		return "", utils.WithRequestID(err)
+	}
+	// a retried restore reuses the share named after the restore UID
+	tags = utils.RestoreTags(b.log, b.getVeleroClient, tags)
+	restoreUID := tags[utils.RestoreUIDTag]
+	volumeName := utils.ResourceName(snapshotID, "backup", restoreUID)
+	if restoreUID != "" {
+		shareID, err := b.findRestoredShare(volumeName)
+		if err != nil || shareID != "" {
+			return shareID, utils.WithRequestID(err)
+		}
+	}
+
+	// restored shares keep the ownership metadata of the snapshot
+	tags = utils.OwnershipTags(tags, b.config["method"], snapshotID)
+
+	var shareID string
 	switch b.config["method"] {
 	case "clone":
-		return b.createVolumeFromClone(snapshotID, volumeType, volumeAZ)
+		shareID, err = b.createVolumeFromClone(snapshotID, volumeName, volumeType, volumeAZ, tags)
+	default:
+		shareID, err = b.createVolumeFromSnapshot(snapshotID, volumeName, volumeType, volumeAZ, tags)
 	}
 
-	return b.createVolumeFromSnapshot(snapshotID, volumeType, volumeAZ)
+	return shareID, utils.WithRequestID(err)
 }
 
-func (b *FSStore) createVolumeFromSnapshot(snapshotID, volumeType, volumeAZ string) (string, error) {
+func (b *FSStore) createVolumeFromSnapshot(snapshotID, volumeName, volumeType, volumeAZ string, tags map[string]string) (string, error) {
 	logWithFields := b.log.WithFields(logrus.Fields{
 		"snapshotID":      snapshotID,
 		"volumeType":      volumeType,
@@ -226,7 +286,6 @@ func (b *FSStore) createVolumeFromSnapshot(snapshotID, volumeType, volumeAZ stri
 	})
 	logWithFields.Info("FSStore.CreateVolumeFromSnapshot called")
 
-	volumeName := fmt.Sprintf("%s.backup.%s", snapshotID, strconv.FormatUint(utils.Rand.Uint64(), 10))
 	logWithFields.Info("Waiting for snapshot to be in 'available' status")
 
 	snapshot, err := b.waitForSnapshotStatus(snapshotID, snapshotStatuses, b.snapshotTimeout)
@@ -236,6 +295,14 @@ func (b *FSStore) createVolumeFromSnapshot(snapshotID, volumeType, volumeAZ stri
 	}
 	logWithFields.Info("Snapshot is in 'available' status")
 
+	err = b.checkQuota(fmt.Sprintf("a share from snapshot %v", snapshotID), map[string]int{
+		"shares":    1,
+		"gigabytes": snapshot.Size,
+	})
+	if err != nil {
+		return "", err
+	}
+
 	// get original share with its metadata
 	originShare, err := shares.Get(b.client, snapshot.ShareID).Extract()
 	if err != nil {
@@ -258,7 +325,7 @@ func (b *FSStore) createVolumeFromSnapshot(snapshotID, volumeType, volumeAZ stri
 		Name:             volumeName,
 		Description:      "Velero backup from snapshot",
 		SnapshotID:       snapshotID,
-		Metadata:         originShare.Metadata,
+		Metadata:         utils.Merge(originShare.Metadata, tags),
 	}
 	if b.enforceAZ && volumeAZ != "" && originShare.AvailabilityZone != volumeAZ {
 		// omit AZ and move the share to a new AZ later
@@ -312,7 +379,7 @@ func (b *FSStore) createVolumeFromSnapshot(snapshotID, volumeType, volumeAZ stri
 	return share.ID, nil
 }
 
-func (b *FSStore) createVolumeFromClone(cloneID, volumeType, volumeAZ string) (string, error) {
+func (b *FSStore) createVolumeFromClone(cloneID, volumeName, volumeType, volumeAZ string, tags map[string]string) (string, error) {
 	logWithFields := b.log.WithFields(logrus.Fields{
 		"cloneID":         cloneID,
 		"volumeType":      volumeType,
@@ -324,9 +391,8 @@ func (b *FSStore) createVolumeFromClone(cloneID, volumeType, volumeAZ string) (s
 	})
 	logWithFields.Info("FSStore.CreateVolumeFromSnapshot called")
 
-	volumeName := fmt.Sprintf("%s.backup.%s", cloneID, strconv.FormatUint(utils.Rand.Uint64(), 10))
 	volumeDesc := "Velero backup from share clone"
-	shareID, shareAccessID, err := b.cloneShare(logWithFields, cloneID, volumeName, volumeDesc, volumeAZ, nil)
+	shareID, shareAccessID, err := b.cloneShare(logWithFields, cloneID, volumeName, volumeDesc, volumeAZ, tags)
 	if err != nil {
 		return shareID, err
 	}
@@ -349,6 +415,17 @@ func (b *FSStore) cloneShare(logWithFields *logrus.Entry, shareID, shareName, sh
 	}
 	logWithFields.Info("Source share clone is in 'available' status")
 
+	// the clone is created from an intermediate snapshot
+	err = b.checkQuota(fmt.Sprintf("a clone of share %v", shareID), map[string]int{
+		"shares":             1,
+		"gigabytes":          originShare.Size,
+		"snapshots":          1,
+		"snapshot_gigabytes": originShare.Size,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
 	// get original share access rule
 	rule, err := b.getShareAccessRule(logWithFields, originShare.ID)
 	if err != nil {
@@ -356,12 +433,12 @@ func (b *FSStore) cloneShare(logWithFields *logrus.Entry, shareID, shareName, sh
 	}
 
 	// create an intermediate share snapshot
-	snapOpts := &snapshots.CreateOpts{
+	snapOpts := snapshots.CreateOpts{
 		Name:        shareName,
-		Description: "Velero temp snapshot",
+		Description: tempSnapshotDesc,
 		ShareID:     shareID,
 	}
-	snapshot, err := snapshots.Create(b.client, snapOpts).Extract()
+	snapshot, err := b.createShareSnapshot(logWithFields, snapOpts, tags)
 	if err != nil {
 		logWithFields.Error("failed to create an intermediate share snapshot from the source volume share")
 		return "", "", fmt.Errorf("failed to create an intermediate share snapshot from the %v source volume share: %w", shareID, err)
@@ -448,7 +525,7 @@ func (b *FSStore) cloneShare(logWithFields *logrus.Entry, shareID, shareName, sh
 
 	// migrate a share to the desired AZ
 	if b.enforceAZ && shareAZ != "" && share.AvailabilityZone != shareAZ {
-		err = b.changeAZ(logWithFields, shareID, shareAZ)
+		err = b.changeAZ(logWithFields, share.ID, shareAZ)
 		if err != nil {
 			logWithFields.Errorf("failed to move a share to the target %s availability zone", shareAZ)
 			return share.ID, shareAccessID, fmt.Errorf("failed to move a share to the target %s availability zone: %w", shareAZ, err)
@@ -470,7 +547,7 @@ func (b *FSStore) GetVolumeInfo(volumeID, volumeAZ string) (string, *int64, erro
 	share, err := shares.Get(b.client, volumeID).Extract()
 	if err != nil {
 		logWithFields.Error("failed to get share from manila")
-		return "", nil, fmt.Errorf("failed to get share %v from manila: %w", volumeID, err)
+		return "", nil, utils.WithRequestID(fmt.Errorf("failed to get share %v from manila: %w", volumeID, err))
 	}
 
 	return share.VolumeType, nil, nil
@@ -488,7 +565,7 @@ func (b *FSStore) IsVolumeReady(volumeID, volumeAZ string) (ready bool, err erro
 	share, err := shares.Get(b.client, volumeID).Extract()
 	if err != nil {
 		logWithFields.Error("failed to get share from manila")
-		return false, fmt.Errorf("failed to get share %v from manila: %w", volumeID, err)
+		return false, utils.WithRequestID(fmt.Errorf("failed to get share %v from manila: %w", volumeID, err))
 	}
 
 	if utils.SliceContains(shareStatuses, share.Status) {
@@ -499,19 +576,29 @@ func (b *FSStore) IsVolumeReady(volumeID, volumeAZ string) (ready bool, err erro
 	return false, fmt.Errorf("share %v is not in available status, the status is %v", volumeID, share.Status)
 }
 
-// CreateSnapshot creates a snapshot of the specified volume, and does NOT
-// apply any provided set of tags to the snapshot.
+// CreateSnapshot creates a snapshot of the specified volume, and applies the
+// provided set of tags to share clones and, with the 2.73 microversion or
+// newer, to snapshots.
 func (b *FSStore) CreateSnapshot(volumeID, volumeAZ string, tags map[string]string) (string, error) {
+	tags = utils.ClaimTags(b.log.WithField("volumeID", volumeID), b.getKubeClient, tags)
+	tags = utils.BackupUIDTags(b.log.WithField("volumeID", volumeID), b.getVeleroClient, tags)
+	tags = utils.InstallationTags(b.log.WithField("volumeID", volumeID), b.getKubeClient, tags)
+	tags = utils.Merge(tags, utils.OwnershipTags(tags, b.config["method"], volumeID))
+
+	var snapshotID string
+	var err error
 	switch b.config["method"] {
 	case "clone":
-		return b.createClone(volumeID, volumeAZ, tags)
+		snapshotID, err = b.createClone(volumeID, volumeAZ, tags)
+	default:
+		snapshotID, err = b.createSnapshot(volumeID, volumeAZ, tags)
 	}
 
-	return b.createSnapshot(volumeID, volumeAZ, tags)
+	return snapshotID, utils.WithRequestID(err)
 }
 
 func (b *FSStore) createSnapshot(volumeID, volumeAZ string, tags map[string]string) (string, error) {
-	snapshotName := fmt.Sprintf("%s.snap.%s", volumeID, strconv.FormatUint(utils.Rand.Uint64(), 10))
+	snapshotName := utils.ResourceName(volumeID, "snap", tags[utils.BackupUIDTag])
 	logWithFields := b.log.WithFields(logrus.Fields{
 		"snapshotName":    snapshotName,
 		"volumeID":        volumeID,
@@ -519,19 +606,42 @@ func (b *FSStore) createSnapshot(volumeID, volumeAZ string, tags map[string]stri
 		"tags":            tags,
 		"snapshotTimeout": b.snapshotTimeout,
 		"method":          b.config["method"],
-	})
+	}).WithFields(utils.BackupFields(tags))
 	logWithFields.Info("FSStore.CreateSnapshot called")
 
-	opts := snapshots.CreateOpts{
-		Name:        snapshotName,
-		Description: "Velero snapshot",
-		ShareID:     volumeID,
-		// TODO: add Metadata once https://github.com/gophercloud/gophercloud/issues/2660 is merged
+	share, err := shares.Get(b.client, volumeID).Extract()
+	if err != nil {
+		logWithFields.Error("failed to get share from manila")
+		return "", fmt.Errorf("failed to get share %v from manila: %w", volumeID, err)
 	}
-	snapshot, err := snapshots.Create(b.client, opts).Extract()
+
+	// reuse a snapshot created by a previous attempt of the same backup
+	snapshot, err := b.findSnapshotByName(snapshotName, volumeID)
 	if err != nil {
-		logWithFields.Error("failed to create snapshot from share")
-		return "", fmt.Errorf("failed to create snapshot %v from share %v: %w", snapshotName, volumeID, err)
+		logWithFields.Error("failed to find an existing snapshot")
+		return "", err
+	}
+	if snapshot != nil {
+		logWithFields.WithField("snapshotID", snapshot.ID).Info("Reusing the existing snapshot")
+	} else {
+		// the quota is checked only, when a new snapshot is created
+		err = b.checkQuota(fmt.Sprintf("a snapshot of share %v", volumeID), map[string]int{
+			"snapshots":          1,
+			"snapshot_gigabytes": share.Size,
+		})
+		if err != nil {
+			return "", err
+		}
+		opts := snapshots.CreateOpts{
+			Name:        snapshotName,
+			Description: "Velero snapshot",
+			ShareID:     volumeID,
+		}
+		snapshot, err = b.createShareSnapshot(logWithFields, opts, tags)
+		if err != nil {
+			logWithFields.Error("failed to create snapshot from share")
+			return "", fmt.Errorf("failed to create snapshot %v from share %v: %w", snapshotName, volumeID, err)
+		}
 	}
 
 	_, err = b.waitForSnapshotStatus(snapshot.ID, snapshotStatuses, b.snapshotTimeout)
@@ -548,7 +658,7 @@ func (b *FSStore) createSnapshot(volumeID, volumeAZ string, tags map[string]stri
 }
 
 func (b *FSStore) createClone(volumeID, volumeAZ string, tags map[string]string) (string, error) {
-	cloneName := fmt.Sprintf("%s.clone.%s", volumeID, strconv.FormatUint(utils.Rand.Uint64(), 10))
+	cloneName := utils.ResourceName(volumeID, "clone", tags[utils.BackupUIDTag])
 	logWithFields := b.log.WithFields(logrus.Fields{
 		"cloneName":       cloneName,
 		"volumeID":        volumeID,
@@ -556,13 +666,30 @@ func (b *FSStore) createClone(volumeID, volumeAZ string, tags map[string]string)
 		"tags":            tags,
 		"snapshotTimeout": b.snapshotTimeout,
 		"method":          b.config["method"],
-	})
+	}).WithFields(utils.BackupFields(tags))
 	logWithFields.Info("FSStore.CreateSnapshot called")
 
-	cloneDesc := "Velero share clone"
-	cloneID, _, err := b.cloneShare(logWithFields, volumeID, cloneName, cloneDesc, volumeAZ, tags)
+	// reuse a clone created by a previous attempt of the same backup
+	clone, err := b.findShareByName(cloneName)
 	if err != nil {
-		return cloneID, err
+		logWithFields.Error("failed to find an existing share clone")
+		return "", err
+	}
+	var cloneID string
+	if clone != nil {
+		cloneID = clone.ID
+		logWithFields.WithField("cloneID", cloneID).Info("Reusing the existing share clone")
+		_, err = b.waitForShareStatus(cloneID, shareStatuses, b.shareTimeout)
+		if err != nil {
+			logWithFields.Error("share didn't get into 'available' status within the time limit")
+			return cloneID, fmt.Errorf("share %v didn't get into 'available' status within the time limit: %w", cloneID, err)
+		}
+	} else {
+		cloneDesc := "Velero share clone"
+		cloneID, _, err = b.cloneShare(logWithFields, volumeID, cloneName, cloneDesc, volumeAZ, tags)
+		if err != nil {
+			return cloneID, err
+		}
 	}
 
 	logWithFields.WithFields(logrus.Fields{
@@ -573,12 +700,15 @@ func (b *FSStore) createClone(volumeID, volumeAZ string, tags map[string]string)
 
 // DeleteSnapshot deletes the specified volume snapshot.
 func (b *FSStore) DeleteSnapshot(snapshotID string) error {
+	var err error
 	switch b.config["method"] {
 	case "clone":
-		return b.deleteClone(snapshotID)
+		err = b.deleteClone(snapshotID)
+	default:
+		err = b.deleteSnapshot(snapshotID)
 	}
 
-	return b.deleteSnapshot(snapshotID)
+	return utils.WithRequestID(err)
 }
 
 func (b *FSStore) deleteSnapshot(snapshotID string) error {
@@ -616,6 +746,8 @@ func (b *FSStore) deleteReplicas(logWithFields *logrus.Entry, shareID string) er
 
 	wg := sync.WaitGroup{}
 	errs := make(chan error, len(allReplicas))
+	// limit the amount of parallel deletions
+	sem := make(chan struct{}, b.deleteConcurrency)
 	deleteReplica := func(replicaID string) {
 		logWithFields.Infof("deleting the %s replica", replicaID)
 		err := b.ensureReplicaDeleted(logWithFields, replicaID, b.replicaTimeout)
@@ -623,6 +755,7 @@ func (b *FSStore) deleteReplicas(logWithFields *logrus.Entry, shareID string) er
 			logWithFields.Errorf("failed to delete %s replica: %v", replicaID, err)
 			errs <- fmt.Errorf("failed to delete %s replica: %w", replicaID, err)
 		}
+		<-sem
 		wg.Done()
 	}
 
@@ -632,6 +765,7 @@ func (b *FSStore) deleteReplicas(logWithFields *logrus.Entry, shareID string) er
 			continue
 		}
 		wg.Add(1)
+		sem <- struct{}{}
 		go deleteReplica(replica.ID)
 	}
 
@@ -661,6 +795,8 @@ func (b *FSStore) deleteSnapshots(logWithFields *logrus.Entry, shareID string) e
 
 	wg := sync.WaitGroup{}
 	errs := make(chan error, len(allSnapshots))
+	// limit the amount of parallel deletions
+	sem := make(chan struct{}, b.deleteConcurrency)
 	deleteSnapshot := func(snapshotID string) {
 		logWithFields.Infof("deleting the %s snapshot", snapshotID)
 		err := b.ensureSnapshotDeleted(logWithFields, snapshotID, b.snapshotTimeout)
@@ -668,11 +804,13 @@ func (b *FSStore) deleteSnapshots(logWithFields *logrus.Entry, shareID string) e
 			logWithFields.Errorf("failed to delete %s snapshot: %v", snapshotID, err)
 			errs <- fmt.Errorf("failed to delete %s snapshot: %w", snapshotID, err)
 		}
+		<-sem
 		wg.Done()
 	}
 
 	for _, snapshot := range allSnapshots {
 		wg.Add(1)
+		sem <- struct{}{}
 		go deleteSnapshot(snapshot.ID)
 	}
 
@@ -771,7 +909,7 @@ func (b *FSStore) SetVolumeID(unstructuredPV runtime.Unstructured, volumeID stri
 	// get share access rule
 	rule, err := b.getShareAccessRule(logWithFields, volumeID)
 	if err != nil {
-		return nil, err
+		return nil, utils.WithRequestID(err)
 	}
 
 	pv.Spec.CSI.VolumeHandle = volumeID
@@ -958,7 +1096,7 @@ func (b *FSStore) getManilaMicroversion() (string, error) {
 }
 
 func (b *FSStore) waitForShareStatus(id string, statuses []string, secs int) (current *shares.Share, err error) {
-	return current, utils.WaitForStatus(statuses, secs, func() (string, error) {
+	return current, utils.WaitForStatus(statuses, secs, b.pollInterval, func() (string, error) {
 		current, err = shares.Get(b.client, id).Extract()
 		if err != nil {
 			return "", err
@@ -968,7 +1106,7 @@ func (b *FSStore) waitForShareStatus(id string, statuses []string, secs int) (cu
 }
 
 func (b *FSStore) waitForSnapshotStatus(id string, statuses []string, secs int) (current *snapshots.Snapshot, err error) {
-	return current, utils.WaitForStatus(statuses, secs, func() (string, error) {
+	return current, utils.WaitForStatus(statuses, secs, b.pollInterval, func() (string, error) {
 		current, err = snapshots.Get(b.client, id).Extract()
 		if err != nil {
 			return "", err
@@ -978,7 +1116,7 @@ func (b *FSStore) waitForSnapshotStatus(id string, statuses []string, secs int)
 }
 
 func (b *FSStore) waitForReplicaStatus(id string, statuses []string, secs int) (current *replicas.Replica, err error) {
-	return current, utils.WaitForStatus(statuses, secs, func() (string, error) {
+	return current, utils.WaitForStatus(statuses, secs, b.pollInterval, func() (string, error) {
 		current, err = replicas.Get(b.client, id).Extract()
 		if err != nil {
 			return "", err
@@ -988,7 +1126,7 @@ func (b *FSStore) waitForReplicaStatus(id string, statuses []string, secs int) (
 }
 
 func (b *FSStore) waitForReplicaState(id string, states []string, secs int) (current *replicas.Replica, err error) {
-	return current, utils.WaitForStatus(states, secs, func() (string, error) {
+	return current, utils.WaitForStatus(states, secs, b.pollInterval, func() (string, error) {
 		current, err := replicas.Get(b.client, id).Extract()
 		if err != nil {
 			return "", err
@@ -0,0 +1,293 @@
+package manila
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/fakeopenstack"
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	velerofake "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var testTags = map[string]string{
+	utils.BackupTag: "test-backup",
+	utils.PVTag:     "test-pv",
+}
+
+// newTestFSStore initializes a FSStore against the fake cloud
+func newTestFSStore(t *testing.T, config map[string]string) *FSStore {
+	b := NewFSStore(logrus.New())
+	err := b.Init(utils.Merge(map[string]string{
+		"ensureDeletedDelay": "0s",
+		"shareTimeout":       "30s",
+		"pollInterval":       fakeopenstack.PollInterval,
+	}, config))
+	require.Nil(t, err)
+	return b
+}
+
+// addShare adds a share with an access rule to the fake cloud
+func addShare(srv *fakeopenstack.Server, fields map[string]interface{}) string {
+	shareID := srv.AddShare(fields)
+	srv.Add(fakeopenstack.ShareAccessRules, map[string]interface{}{
+		"share_id":    shareID,
+		"access_type": "cephx",
+		"access_to":   "velero",
+	})
+	return shareID
+}
+
+func TestSnapshotMethod(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	b := newTestFSStore(t, nil)
+	assert.Equal(t, getAccessRulesMicroversion, b.client.Microversion)
+	shareID := addShare(srv, map[string]interface{}{
+		"size":     10,
+		"metadata": map[string]string{"app": "db"},
+	})
+
+	snapshotID, err := b.CreateSnapshot(shareID, "nova", testTags)
+	require.Nil(t, err)
+	snapshot := srv.Get(fakeopenstack.ShareSnapshots, snapshotID)
+	assert.Equal(t, "available", snapshot["status"])
+	assert.Equal(t, shareID, snapshot["share_id"])
+
+	newShareID, err := b.CreateVolumeFromSnapshot(snapshotID, "default", "nova", nil)
+	require.Nil(t, err)
+	share := srv.Get(fakeopenstack.Shares, newShareID)
+	assert.Equal(t, "available", share["status"])
+	assert.Equal(t, snapshotID, share["snapshot_id"])
+	assert.Equal(t, 10, toInt(share["size"]))
+	assert.Equal(t, "db", share["metadata"].(map[string]interface{})["app"])
+
+	// the access rule is copied from the original share
+	rules := srv.List(fakeopenstack.ShareAccessRules, map[string]string{"share_id": newShareID})
+	require.Len(t, rules, 1)
+	assert.Equal(t, "velero", rules[0]["access_to"])
+	assert.Equal(t, "cephx", rules[0]["access_type"])
+
+	ready, err := b.IsVolumeReady(newShareID, "nova")
+	assert.Nil(t, err)
+	assert.True(t, ready)
+
+	assert.Nil(t, b.DeleteSnapshot(snapshotID))
+	assert.Nil(t, b.DeleteSnapshot("missing"))
+}
+
+func TestCloneMethod(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	b := newTestFSStore(t, map[string]string{
+		"method":        "clone",
+		"ensureDeleted": "true",
+		"cascadeDelete": "true",
+	})
+	shareID := addShare(srv, map[string]interface{}{"size": 2})
+
+	cloneID, err := b.CreateSnapshot(shareID, "nova", testTags)
+	require.Nil(t, err)
+	clone := srv.Get(fakeopenstack.Shares, cloneID)
+	assert.Equal(t, "available", clone["status"])
+	assert.Equal(t, "test-backup", clone["metadata"].(map[string]interface{})[utils.BackupTag])
+	assert.Len(t, srv.List(fakeopenstack.ShareAccessRules, map[string]string{"share_id": cloneID}), 1)
+	// the intermediate snapshot is removed
+	assert.Empty(t, srv.List(fakeopenstack.ShareSnapshots, map[string]string{"share_id": shareID}))
+
+	// a clone snapshot created by a third party must be removed first
+	srv.Add(fakeopenstack.ShareSnapshots, map[string]interface{}{
+		"share_id": cloneID,
+	})
+	assert.Nil(t, srv.FailDelete(fakeopenstack.Shares, cloneID, 1))
+	assert.Nil(t, b.DeleteSnapshot(cloneID))
+	assert.Nil(t, srv.Get(fakeopenstack.Shares, cloneID))
+	assert.Empty(t, srv.List(fakeopenstack.ShareSnapshots, map[string]string{"share_id": cloneID}))
+	// allow_access during the clone and reset_status during the deletion
+	assert.Equal(t, 2, srv.CountCalls("POST", "/shares/"+cloneID+"/action"))
+	assert.NotNil(t, srv.Get(fakeopenstack.Shares, shareID))
+}
+
+func TestCloneMethodEnforceAZ(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	b := newTestFSStore(t, map[string]string{
+		"method":         "clone",
+		"enforceAZ":      "true",
+		"replicaTimeout": "30s",
+	})
+	assert.Equal(t, replicasMicroversion, b.client.Microversion)
+	shareID := addShare(srv, map[string]interface{}{"size": 2})
+
+	cloneID, err := b.CreateSnapshot(shareID, "zone-b", testTags)
+	require.Nil(t, err)
+
+	// the clone is moved to the target AZ, while the source share stays
+	assert.Equal(t, "zone-b", srv.Get(fakeopenstack.Shares, cloneID)["availability_zone"])
+	assert.Equal(t, fakeopenstack.DefaultAvailabilityZone, srv.Get(fakeopenstack.Shares, shareID)["availability_zone"])
+
+	replicas := srv.List(fakeopenstack.ShareReplicas, map[string]string{"share_id": cloneID})
+	require.Len(t, replicas, 2)
+	assert.Equal(t, "deleting", replicas[0]["status"])
+	assert.Equal(t, "zone-b", replicas[1]["availability_zone"])
+	assert.Equal(t, "active", replicas[1]["replica_state"])
+}
+
+func TestEnforceAZMicroversionNotSupported(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.ShareMicroversion = "2.50"
+
+	b := NewFSStore(logrus.New())
+	err := b.Init(map[string]string{"enforceAZ": "true"})
+	assert.ErrorContains(t, err, "enforceAZ config option is not supported")
+}
+
+func TestDeprecatedAccessRulesAPI(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.ShareMicroversion = "2.40"
+	b := newTestFSStore(t, nil)
+	assert.Equal(t, minSupportedMicroversion, b.client.Microversion)
+	shareID := addShare(srv, nil)
+
+	rule, err := b.getShareAccessRule(b.log.WithField("test", t.Name()), shareID)
+	require.Nil(t, err)
+	assert.Equal(t, "velero", rule.AccessTo)
+	assert.Equal(t, 1, srv.CountCalls("POST", "/shares/"+shareID+"/action"))
+}
+
+func toInt(v interface{}) int {
+	switch v := v.(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+func TestQuotaCheck(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.ShareQuotas = map[string]int{"snapshot_gigabytes": 15, "shares": 2}
+	b := newTestFSStore(t, map[string]string{"quotaCheck": "true"})
+	shareID := addShare(srv, map[string]interface{}{"size": 10})
+
+	snapshotID, err := b.CreateSnapshot(shareID, "nova", testTags)
+	require.Nil(t, err)
+	_, err = b.CreateSnapshot(shareID, "nova", testTags)
+	assert.ErrorContains(t, err, "refusing to create a snapshot of share "+shareID)
+	assert.ErrorContains(t, err, "snapshot_gigabytes (requested 10, in use 10, reserved 0, limit 15 with a 0% margin)")
+
+	_, err = b.CreateVolumeFromSnapshot(snapshotID, "default", "nova", nil)
+	require.Nil(t, err)
+	_, err = b.CreateVolumeFromSnapshot(snapshotID, "default", "nova", nil)
+	assert.ErrorContains(t, err, "shares (requested 1, in use 2, reserved 0, limit 2 with a 0% margin)")
+
+	// the clone requires an intermediate snapshot
+	b = newTestFSStore(t, map[string]string{"quotaCheck": "true", "method": "clone"})
+	srv.ShareQuotas["shares"] = -1
+	_, err = b.CreateSnapshot(shareID, "nova", testTags)
+	assert.ErrorContains(t, err, "refusing to create a clone of share "+shareID)
+
+	// a retried backup reuses its snapshot in a project at the quota
+	srv.ShareQuotas["snapshot_gigabytes"] = -1
+	b = newTestFSStore(t, map[string]string{"quotaCheck": "true"})
+	b.veleroClient = velerofake.NewSimpleClientset(&velerov1.Backup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "test-backup", UID: "test-uid"},
+	})
+	snapshotID, err = b.CreateSnapshot(shareID, "nova", testTags)
+	require.Nil(t, err)
+	srv.ShareQuotas["snapshot_gigabytes"] = 0
+	retriedID, err := b.CreateSnapshot(shareID, "nova", testTags)
+	require.Nil(t, err)
+	assert.Equal(t, snapshotID, retriedID)
+
+	// the quota usage is shown since the 2.25 microversion
+	srv.ShareMicroversion = "2.24"
+	b = newTestFSStore(t, map[string]string{"quotaCheck": "true"})
+	_, err = b.CreateSnapshot(shareID, "nova", testTags)
+	assert.Nil(t, err)
+}
+
+func TestSnapshotMetadata(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.ShareMicroversion = "2.73"
+	b := newTestFSStore(t, nil)
+	shareID := addShare(srv, nil)
+
+	snapshotID, err := b.CreateSnapshot(shareID, "nova", testTags)
+	require.Nil(t, err)
+	metadata := srv.Get(fakeopenstack.ShareSnapshots, snapshotID)["metadata"].(map[string]interface{})
+	assert.Equal(t, "snapshot", metadata[utils.MethodKey])
+	assert.Equal(t, shareID, metadata[utils.SourceKey])
+	assert.Equal(t, "test-backup", metadata[utils.BackupTag])
+	assert.NotEmpty(t, metadata[utils.CreatedAtKey])
+
+	// restored shares keep the ownership metadata of the snapshot
+	newShareID, err := b.CreateVolumeFromSnapshot(snapshotID, "default", "nova", nil)
+	require.Nil(t, err)
+	metadata = srv.Get(fakeopenstack.Shares, newShareID)["metadata"].(map[string]interface{})
+	assert.Equal(t, snapshotID, metadata[utils.SourceKey])
+	assert.Equal(t, "test-pv", metadata[utils.PVTag])
+}
+
+func TestIdempotentNaming(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+	srv.ShareMicroversion = "2.73"
+	b := newTestFSStore(t, nil)
+	b.veleroClient = velerofake.NewSimpleClientset(&velerov1.Backup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "test-backup", UID: "test-uid"},
+	})
+	shareID := addShare(srv, nil)
+
+	// a retried backup reuses the snapshot named after the backup UID
+	snapshotID, err := b.CreateSnapshot(shareID, "nova", testTags)
+	require.Nil(t, err)
+	assert.Equal(t, shareID+".snap.test-uid", srv.Get(fakeopenstack.ShareSnapshots, snapshotID)["name"])
+	retriedID, err := b.CreateSnapshot(shareID, "nova", testTags)
+	require.Nil(t, err)
+	assert.Equal(t, snapshotID, retriedID)
+	assert.Equal(t, 1, srv.CountCalls("POST", "/snapshots"))
+
+	// a retried backup reuses the share clone
+	b2 := newTestFSStore(t, map[string]string{"method": "clone"})
+	b2.veleroClient = b.veleroClient
+	cloneID, err := b2.CreateSnapshot(shareID, "nova", testTags)
+	require.Nil(t, err)
+	assert.Equal(t, shareID+".clone.test-uid", srv.Get(fakeopenstack.Shares, cloneID)["name"])
+	retriedID, err = b2.CreateSnapshot(shareID, "nova", testTags)
+	require.Nil(t, err)
+	assert.Equal(t, cloneID, retriedID)
+
+	// a failed clone isn't reused
+	require.Nil(t, srv.Update(fakeopenstack.Shares, cloneID, map[string]interface{}{"status": "error"}))
+	retriedID, err = b2.CreateSnapshot(shareID, "nova", testTags)
+	require.Nil(t, err)
+	assert.NotEqual(t, cloneID, retriedID)
+
+	// a retried restore reuses the share named after the restore UID
+	_, err = b.veleroClient.VeleroV1().Restores("velero").Create(context.Background(), &velerov1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "test-restore", UID: "restore-uid"},
+		Spec:       velerov1.RestoreSpec{BackupName: "test-backup"},
+		Status:     velerov1.RestoreStatus{Phase: velerov1.RestorePhaseInProgress},
+	}, metav1.CreateOptions{})
+	require.Nil(t, err)
+	restoredID, err := b.CreateVolumeFromSnapshot(snapshotID, "", "nova", nil)
+	require.Nil(t, err)
+	assert.Equal(t, snapshotID+".backup.restore-uid", srv.Get(fakeopenstack.Shares, restoredID)["name"])
+	metadata := srv.Get(fakeopenstack.Shares, restoredID)["metadata"].(map[string]interface{})
+	assert.Equal(t, "test-restore", metadata[utils.RestoreTag])
+	retriedID, err = b.CreateVolumeFromSnapshot(snapshotID, "", "nova", nil)
+	require.Nil(t, err)
+	assert.Equal(t, restoredID, retriedID)
+
+	// the same applies to shares restored from a clone
+	cloneID, err = b2.CreateSnapshot(shareID, "nova", testTags)
+	require.Nil(t, err)
+	restoredID, err = b2.CreateVolumeFromSnapshot(cloneID, "", "nova", nil)
+	require.Nil(t, err)
+	assert.Equal(t, cloneID+".backup.restore-uid", srv.Get(fakeopenstack.Shares, restoredID)["name"])
+	retriedID, err = b2.CreateVolumeFromSnapshot(cloneID, "", "nova", nil)
+	require.Nil(t, err)
+	assert.Equal(t, restoredID, retriedID)
+}
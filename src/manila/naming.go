@@ -0,0 +1,87 @@
+package manila
+
+import (
+	"fmt"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud/openstack/sharedfilesystems/v2/shares"
+	"github.com/gophercloud/gophercloud/openstack/sharedfilesystems/v2/snapshots"
+	"github.com/sirupsen/logrus"
+	veleroclient "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned"
+)
+
+// pending statuses of shares and snapshots, which are still being created and
+// can be reused by a retried backup
+var pendingStatuses = []string{"creating"}
+
+// findSnapshotByName returns a pending or available snapshot of the share
+// with the given name, or nil when there is none
+func (b *FSStore) findSnapshotByName(name, shareID string) (*snapshots.Snapshot, error) {
+	pages, err := snapshots.ListDetail(b.client, snapshots.ListOpts{Name: name, ShareID: shareID}).AllPages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %v snapshots: %w", name, err)
+	}
+	allSnapshots, err := snapshots.ExtractSnapshots(pages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract %v snapshots: %w", name, err)
+	}
+	for i, s := range allSnapshots {
+		if s.Name == name && (utils.SliceContains(snapshotStatuses, s.Status) || utils.SliceContains(pendingStatuses, s.Status)) {
+			return &allSnapshots[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// findShareByName returns a pending or available share with the given name,
+// or nil when there is none
+func (b *FSStore) findShareByName(name string) (*shares.Share, error) {
+	pages, err := shares.ListDetail(b.client, shares.ListOpts{Name: name}).AllPages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %v shares: %w", name, err)
+	}
+	allShares, err := shares.ExtractShares(pages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract %v shares: %w", name, err)
+	}
+	for i, s := range allShares {
+		if s.Name == name && (utils.SliceContains(shareStatuses, s.Status) || utils.SliceContains(pendingStatuses, s.Status)) {
+			return &allShares[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// findRestoredShare returns the ID of the share with the given name created
+// by a retried restore, once it is available, or an empty ID when there is none
+func (b *FSStore) findRestoredShare(name string) (string, error) {
+	share, err := b.findShareByName(name)
+	if err != nil || share == nil {
+		return "", err
+	}
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"shareName": name,
+		"shareID":   share.ID,
+	})
+	logWithFields.Info("Reusing the share of the retried restore")
+
+	_, err = b.waitForShareStatus(share.ID, shareStatuses, b.shareTimeout)
+	if err != nil {
+		logWithFields.Error("share didn't get into 'available' status within the time limit")
+		return "", fmt.Errorf("share %v didn't get into 'available' status within the time limit: %w", share.ID, err)
+	}
+	return share.ID, nil
+}
+
+// getVeleroClient returns the Velero client of the cluster, where the shares
+// are backed up
+func (b *FSStore) getVeleroClient() (veleroclient.Interface, error) {
+	if b.veleroClient == nil {
+		client, err := utils.NewVeleroClient()
+		if err != nil {
+			return nil, err
+		}
+		b.veleroClient = client
+	}
+	return b.veleroClient, nil
+}
@@ -0,0 +1,99 @@
+package manila
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud/openstack/sharedfilesystems/v2/shares"
+	"github.com/gophercloud/gophercloud/openstack/sharedfilesystems/v2/snapshots"
+)
+
+// a description of the intermediate snapshots
+const tempSnapshotDesc = "Velero temp snapshot"
+
+// CollectOrphans finds Manila intermediate snapshots and clones created by
+// the plugin of the Velero installation, which don't belong to any existing
+// Velero backup. Share snapshots keep the metadata only with the 2.73 Manila
+// microversion or newer, older snapshots are never collected. Restored
+// shares belong to the restored workloads and are never collected.
+func (b *FSStore) CollectOrphans(c *utils.OrphanCollector) error {
+	err := b.collectOrphanedSnapshots(c)
+	if err == nil {
+		err = b.collectOrphanedShares(c)
+	}
+	return utils.WithRequestID(err)
+}
+
+func (b *FSStore) collectOrphanedSnapshots(c *utils.OrphanCollector) error {
+	if !b.snapshotMetadata {
+		return nil
+	}
+	client := *b.client
+	client.Microversion = snapshotMetadataMicroversion
+	pages, err := snapshots.ListDetail(&client, snapshots.ListOpts{}).AllPages()
+	if err != nil {
+		return fmt.Errorf("failed to list share snapshots: %w", err)
+	}
+	allSnapshots, err := snapshots.ExtractSnapshots(pages)
+	if err != nil {
+		return fmt.Errorf("failed to extract share snapshots: %w", err)
+	}
+	// gophercloud doesn't extract the snapshot metadata
+	var metadata []struct {
+		Metadata map[string]string `json:"metadata"`
+	}
+	if err = pages.(snapshots.SnapshotPage).ExtractIntoSlicePtr(&metadata, "snapshots"); err != nil {
+		return fmt.Errorf("failed to extract share snapshots metadata: %w", err)
+	}
+
+	for i, snapshot := range allSnapshots {
+		if !c.Expired(snapshot.CreatedAt) || snapshot.Description != tempSnapshotDesc || !c.Owned(metadata[i].Metadata) {
+			continue
+		}
+		id := snapshot.ID
+		c.Add(utils.Orphan{
+			Service: "manila",
+			Kind:    "snapshot",
+			ID:      snapshot.ID,
+			Name:    snapshot.Name,
+			Reason:  "intermediate snapshot wasn't deleted",
+		}, func() error { return b.deleteSnapshot(id) })
+	}
+
+	return nil
+}
+
+func (b *FSStore) collectOrphanedShares(c *utils.OrphanCollector) error {
+	pages, err := shares.ListDetail(b.client, shares.ListOpts{}).AllPages()
+	if err != nil {
+		return fmt.Errorf("failed to list shares: %w", err)
+	}
+	allShares, err := shares.ExtractShares(pages)
+	if err != nil {
+		return fmt.Errorf("failed to extract shares: %w", err)
+	}
+
+	for _, share := range allShares {
+		// restored shares keep the metadata of the backed up share, but not
+		// the clone name
+		if !c.Expired(share.CreatedAt) || !c.Owned(share.Metadata) || !strings.Contains(share.Name, ".clone.") {
+			continue
+		}
+		name := share.Metadata[utils.BackupTag]
+		if c.BackupExists(name) {
+			continue
+		}
+		id := share.ID
+		c.Add(utils.Orphan{
+			Service: "manila",
+			Kind:    "share",
+			ID:      share.ID,
+			Name:    share.Name,
+			Backup:  name,
+			Reason:  "backup doesn't exist",
+		}, func() error { return b.deleteClone(id) })
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package manila
+
+import (
+	"fmt"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud/openstack/sharedfilesystems/v2/shares"
+	"github.com/gophercloud/gophercloud/openstack/sharedfilesystems/v2/snapshots"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+)
+
+// the minimum microversion, which supports snapshot metadata
+const snapshotMetadataMicroversion = "2.73"
+
+// snapshotCreateOpts extends the snapshot create request with the metadata,
+// which is not supported by gophercloud
+type snapshotCreateOpts struct {
+	snapshots.CreateOpts
+	Metadata map[string]string
+}
+
+// ToSnapshotCreateMap assembles a request body based on the contents of the
+// snapshotCreateOpts
+func (opts snapshotCreateOpts) ToSnapshotCreateMap() (map[string]interface{}, error) {
+	b, err := opts.CreateOpts.ToSnapshotCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Metadata) > 0 {
+		b["snapshot"].(map[string]interface{})["metadata"] = opts.Metadata
+	}
+	return b, nil
+}
+
+// createShareSnapshot creates the share snapshot with the metadata, when the
+// snapshot metadata is supported
+func (b *FSStore) createShareSnapshot(logWithFields *logrus.Entry, opts snapshots.CreateOpts, tags map[string]string) (*snapshots.Snapshot, error) {
+	if !b.snapshotMetadata {
+		logWithFields.Warnf("Manila doesn't support the %v microversion, the snapshot metadata is not kept", snapshotMetadataMicroversion)
+		return snapshots.Create(b.client, opts).Extract()
+	}
+	client := *b.client
+	client.Microversion = snapshotMetadataMicroversion
+	return snapshots.Create(&client, snapshotCreateOpts{CreateOpts: opts, Metadata: tags}).Extract()
+}
+
+// getSnapshotTags returns the tags kept in the snapshot or the share clone
+// metadata
+func (b *FSStore) getSnapshotTags(snapshotID string) (map[string]string, error) {
+	if b.config["method"] == "clone" {
+		share, err := shares.Get(b.client, snapshotID).Extract()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get share clone %v: %w", snapshotID, err)
+		}
+		return share.Metadata, nil
+	}
+	if !b.snapshotMetadata {
+		return nil, nil
+	}
+
+	client := *b.client
+	client.Microversion = snapshotMetadataMicroversion
+	var res struct {
+		Snapshot struct {
+			Metadata map[string]string `json:"metadata"`
+		} `json:"snapshot"`
+	}
+	err := snapshots.Get(&client, snapshotID).ExtractInto(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot %v: %w", snapshotID, err)
+	}
+	return res.Snapshot.Metadata, nil
+}
+
+// getKubeClient returns the Kubernetes client of the cluster, where the
+// shares are backed up
+func (b *FSStore) getKubeClient() (kubernetes.Interface, error) {
+	if b.kubeClient == nil {
+		client, err := utils.NewKubeClient()
+		if err != nil {
+			return nil, err
+		}
+		b.kubeClient = client
+	}
+	return b.kubeClient, nil
+}
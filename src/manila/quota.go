@@ -0,0 +1,86 @@
+package manila
+
+import (
+	"fmt"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud"
+	"github.com/sirupsen/logrus"
+)
+
+// the minimum microversion, which shows the quota usage
+const quotaDetailMicroversion = "2.25"
+
+// checkQuota refuses to create the resource, when the requested amount of
+// Manila resources would exceed the project quota reduced by the
+// quotaMargin. Quota usage is checked only, when quotaCheck is enabled.
+func (b *FSStore) checkQuota(resource string, request map[string]int) error {
+	if !b.quotaCheck || len(request) == 0 {
+		return nil
+	}
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"resource":    resource,
+		"request":     request,
+		"quotaMargin": b.quotaMargin,
+	})
+
+	mv, err := b.getManilaMicroversion()
+	if err != nil {
+		return fmt.Errorf("failed to obtain supported Manila microversions: %w", err)
+	}
+	ok, err := utils.CompareMicroversions("lte", quotaDetailMicroversion, mv)
+	if err != nil {
+		return fmt.Errorf("failed to compare supported Manila microversions: %w", err)
+	}
+	if !ok {
+		logWithFields.Warnf("The %v Manila microversion doesn't show quota usage, skipping the quota check", mv)
+		return nil
+	}
+
+	projectID, err := utils.GetProjectID(b.client.ProviderClient)
+	if err != nil {
+		return fmt.Errorf("failed to check quota: %w", err)
+	}
+	client := *b.client
+	client.Microversion = quotaDetailMicroversion
+	var res struct {
+		QuotaSet map[string]interface{} `json:"quota_set"`
+	}
+	_, err = client.Get(client.ServiceURL("quota-sets", projectID, "detail"), &res, &gophercloud.RequestOpts{
+		OkCodes: []int{200},
+	})
+	if err != nil {
+		logWithFields.Error("failed to get quota usage")
+		return fmt.Errorf("failed to get project %v quota usage: %w", projectID, err)
+	}
+
+	usage := make(map[string]utils.QuotaUsage)
+	for resource, v := range res.QuotaSet {
+		u, ok := v.(map[string]interface{})
+		if !ok {
+			// e.g. the "id" field
+			continue
+		}
+		usage[resource] = utils.QuotaUsage{
+			Limit:    quotaValue(u["limit"]),
+			InUse:    quotaValue(u["in_use"]),
+			Reserved: quotaValue(u["reserved"]),
+		}
+	}
+	err = utils.CheckQuota(usage, request, b.quotaMargin)
+	if err != nil {
+		logWithFields.Error("project quota would be exceeded")
+		return fmt.Errorf("refusing to create %s: %w", resource, err)
+	}
+	logWithFields.Info("Project quota is sufficient")
+
+	return nil
+}
+
+// quotaValue converts the JSON quota value to int
+func quotaValue(v interface{}) int {
+	if f, ok := v.(float64); ok {
+		return int(f)
+	}
+	return 0
+}
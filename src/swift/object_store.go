@@ -34,7 +34,7 @@ func NewObjectStore(log logrus.FieldLogger) *ObjectStore {
 func (o *ObjectStore) Init(config map[string]string) error {
 	var region string
 	o.log.WithFields(logrus.Fields{
-		"config": config,
+		"config": utils.RedactConfig(config),
 	}).Info("ObjectStore.Init called")
 
 	err := utils.Authenticate(&o.provider, "swift", config, o.log)
@@ -59,7 +59,7 @@ func (o *ObjectStore) Init(config map[string]string) error {
 			Region: region,
 		})
 		if err != nil {
-			return fmt.Errorf("failed to create swift storage object: %w", err)
+			return utils.WithRequestID(fmt.Errorf("failed to create swift storage object: %w", err))
 		}
 		o.log.WithFields(logrus.Fields{
 			"region": region,
@@ -132,7 +132,7 @@ func (o *ObjectStore) GetObject(container, object string) (io.ReadCloser, error)
 
 	res := objects.Download(o.client, container, object, nil)
 	if res.Err != nil {
-		return nil, fmt.Errorf("failed to download contents of %q object from %q container: %w", object, container, res.Err)
+		return nil, utils.WithRequestID(fmt.Errorf("failed to download contents of %q object from %q container: %w", object, container, res.Err))
 	}
 
 	return res.Body, nil
@@ -150,7 +150,7 @@ func (o *ObjectStore) PutObject(container string, object string, body io.Reader)
 	}
 
 	if _, err := objects.Create(o.client, container, object, createOpts).Extract(); err != nil {
-		return fmt.Errorf("failed to create new %q object in %q container: %w", object, container, err)
+		return utils.WithRequestID(fmt.Errorf("failed to create new %q object in %q container: %w", object, container, err))
 	}
 
 	return nil
@@ -170,7 +170,7 @@ func (o *ObjectStore) ObjectExists(container, object string) (bool, error) {
 			logWithFields.Info("Object doesn't yet exist in container")
 			return false, nil
 		}
-		return false, fmt.Errorf("cannot Get %q object from %q container: %w", object, container, res.Err)
+		return false, utils.WithRequestID(fmt.Errorf("cannot Get %q object from %q container: %w", object, container, res.Err))
 	}
 
 	return true, nil
@@ -192,7 +192,7 @@ func (o *ObjectStore) ListCommonPrefixes(container, prefix, delimiter string) ([
 
 	allPages, err := objects.List(o.client, container, opts).AllPages()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list objects in %q container: %w", container, err)
+		return nil, utils.WithRequestID(fmt.Errorf("failed to list objects in %q container: %w", container, err))
 	}
 
 	allObjects, err := objects.ExtractInfo(allPages)
@@ -237,7 +237,7 @@ func (o *ObjectStore) DeleteObject(container, object string) error {
 			logWithFields.Info("object is already deleted")
 			return nil
 		}
-		return fmt.Errorf("failed to delete %q object from %q container: %w", object, container, err)
+		return utils.WithRequestID(fmt.Errorf("failed to delete %q object from %q container: %w", object, container, err))
 	}
 
 	return nil
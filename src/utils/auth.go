@@ -20,7 +20,7 @@ type osDebugger struct {
 }
 
 func (d osDebugger) Printf(format string, args ...interface{}) {
-	d.log.Debugf(format, args...)
+	d.log.Debug(Redact(fmt.Sprintf(format, args...)))
 }
 
 // Authenticate to OpenStack and write client result to **pc
@@ -84,6 +84,8 @@ func Authenticate(pc **gophercloud.ProviderClient, service string, config map[st
 	if err != nil {
 		return fmt.Errorf("failed to build auth options: %w", err)
 	}
+	// never log the credentials read from the clouds.yaml file
+	AddSecrets(ao.Password, ao.ApplicationCredentialSecret, ao.TokenID)
 
 	*pc, err = openstack.NewClient(ao.IdentityEndpoint)
 	if err != nil {
@@ -91,10 +93,63 @@ func Authenticate(pc **gophercloud.ProviderClient, service string, config map[st
 	}
 	(*pc).HTTPClient.Transport = transport
 
+	// limit the rate of API calls per service type
+	limiter, err := newRateLimiter((*pc).HTTPClient.Transport, config)
+	if err != nil {
+		return err
+	}
+	if limiter != nil {
+		log.Infof("Limiting API calls to %v requests per second per service with a burst of %d", limiter.limit, limiter.burst)
+		(*pc).HTTPClient.Transport = limiter
+	}
+
+	// fail API calls fast, when the service is unhealthy
+	breaker, err := getCircuitBreaker(service, config, log)
+	if err != nil {
+		return err
+	}
+	ServeMetrics(config, log)
+	if breaker != nil {
+		log.Infof("Enabling %s API circuit breaker", service)
+		(*pc).HTTPClient.Transport = &circuitBreakerTransport{
+			rt:      (*pc).HTTPClient.Transport,
+			breaker: breaker,
+		}
+	}
+
+	// retry API calls, which were rejected with a "429 Too Many Requests"
+	// response code containing a "Retry-After" header
+	maxRetries, err := strconv.ParseUint(GetConf(config, "maxRetries", "5"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("cannot parse maxRetries config variable: %w", err)
+	}
+	if maxRetries > 0 {
+		(*pc).MaxBackoffRetries = uint(maxRetries)
+		(*pc).RetryBackoffFunc = client.RetryBackoffFunc(osDebugger{log.WithFields(logrus.Fields{
+			"source":    "openstack",
+			"component": service,
+		})})
+	}
+
+	// enable a compact API call log
+	logAPICalls, err := strconv.ParseBool(GetConf(config, "logAPICalls", "false"))
+	if err != nil {
+		return fmt.Errorf("cannot parse logAPICalls config variable: %w", err)
+	}
+	if logAPICalls {
+		(*pc).HTTPClient.Transport = &apiLogger{
+			rt: (*pc).HTTPClient.Transport,
+			log: log.WithFields(logrus.Fields{
+				"source":    "openstack",
+				"component": service,
+			}),
+		}
+	}
+
 	// enable API debug logs
 	if log, ok := log.(*logrus.Logger); ok && log.IsLevelEnabled(logrus.DebugLevel) {
 		(*pc).HTTPClient.Transport = &client.RoundTripper{
-			Rt: transport,
+			Rt: (*pc).HTTPClient.Transport,
 			Logger: osDebugger{log.WithFields(logrus.Fields{
 				"source":    "openstack",
 				"component": service,
@@ -107,7 +162,11 @@ func Authenticate(pc **gophercloud.ProviderClient, service string, config map[st
 
 	err = openstack.Authenticate(*pc, *ao)
 	if err != nil {
-		return fmt.Errorf("failed to authenticate: %w", err)
+		return WithRequestID(fmt.Errorf("failed to authenticate: %w", err))
+	}
+
+	if limiter != nil {
+		limiter.setEndpoints(*pc)
 	}
 
 	log.Infof("Authentication against identity endpoint %v was successful", (*pc).IdentityEndpoint)
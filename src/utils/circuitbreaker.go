@@ -0,0 +1,283 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// CircuitClosed is a circuit breaker state, when API calls are allowed
+	CircuitClosed = "closed"
+	// CircuitOpen is a circuit breaker state, when API calls fail fast
+	CircuitOpen = "open"
+	// CircuitHalfOpen is a circuit breaker state, when a single API call is
+	// allowed to probe the service recovery
+	CircuitHalfOpen = "half-open"
+
+	defaultCircuitBreakerMinRequests = "10"
+	defaultCircuitBreakerWindow      = "1m"
+	defaultCircuitBreakerOpenTimeout = "30s"
+)
+
+var (
+	// circuit breakers shared across all plugin instances, keyed by an
+	// OpenStack service name
+	circuitBreakers   = map[string]*CircuitBreaker{}
+	circuitBreakersMu sync.Mutex
+)
+
+// ErrCircuitOpen is used to indicate that an API call was not performed,
+// because the service circuit breaker is open
+type ErrCircuitOpen struct {
+	Service   string
+	ErrorRate float64
+	Until     time.Time
+}
+
+// Error satisfies golang error interface
+func (e ErrCircuitOpen) Error() string {
+	return fmt.Sprintf("%s API is unhealthy (%.0f%% of API calls failed), the circuit breaker is open until %s", e.Service, e.ErrorRate*100, e.Until.Format(time.RFC3339))
+}
+
+// CircuitBreaker fails API calls fast, when the error rate of the OpenStack
+// service exceeds the threshold
+type CircuitBreaker struct {
+	service     string
+	errorRate   float64
+	minRequests int
+	window      time.Duration
+	openTimeout time.Duration
+	log         logrus.FieldLogger
+	now         func() time.Time
+
+	mu          sync.Mutex
+	state       string
+	requests    int
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	lastRate    float64
+	probing     bool
+
+	// total counters logged with the state transitions and served as metrics
+	totalFailures int
+	totalRejected int
+	totalOpened   int
+}
+
+// State returns the current circuit breaker state
+func (c *CircuitBreaker) State() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// metrics returns the current state and the total counters
+func (c *CircuitBreaker) metrics() circuitBreakerMetrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return circuitBreakerMetrics{
+		Service:  c.service,
+		State:    c.state,
+		Failures: c.totalFailures,
+		Rejected: c.totalRejected,
+		Opened:   c.totalOpened,
+	}
+}
+
+// allow returns an error, when the API call must not be performed
+func (c *CircuitBreaker) allow() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case CircuitOpen:
+		until := c.openedAt.Add(c.openTimeout)
+		if c.now().Before(until) {
+			c.totalRejected++
+			return ErrCircuitOpen{Service: c.service, ErrorRate: c.lastRate, Until: until}
+		}
+		c.setState(CircuitHalfOpen)
+		c.probing = true
+	case CircuitHalfOpen:
+		if c.probing {
+			c.totalRejected++
+			return ErrCircuitOpen{Service: c.service, ErrorRate: c.lastRate, Until: c.now().Add(c.openTimeout)}
+		}
+		c.probing = true
+	}
+
+	return nil
+}
+
+// record updates the circuit breaker state with the API call result
+func (c *CircuitBreaker) record(success bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !success {
+		c.totalFailures++
+	}
+
+	switch c.state {
+	case CircuitHalfOpen:
+		c.probing = false
+		if success {
+			c.reset()
+			c.setState(CircuitClosed)
+			return
+		}
+		c.open()
+	case CircuitClosed:
+		if c.now().Sub(c.windowStart) > c.window {
+			c.reset()
+		}
+		c.requests++
+		if !success {
+			c.failures++
+		}
+		if c.requests < c.minRequests {
+			return
+		}
+		if rate := float64(c.failures) / float64(c.requests); rate >= c.errorRate {
+			c.lastRate = rate
+			c.open()
+		}
+	}
+}
+
+func (c *CircuitBreaker) open() {
+	c.openedAt = c.now()
+	c.totalOpened++
+	c.setState(CircuitOpen)
+}
+
+func (c *CircuitBreaker) reset() {
+	c.requests = 0
+	c.failures = 0
+	c.windowStart = c.now()
+}
+
+func (c *CircuitBreaker) setState(state string) {
+	if c.state == state {
+		return
+	}
+
+	logWithFields := c.log.WithFields(logrus.Fields{
+		"service":       c.service,
+		"oldState":      c.state,
+		"state":         state,
+		"errorRate":     c.lastRate,
+		"totalFailures": c.totalFailures,
+		"totalRejected": c.totalRejected,
+		"totalOpened":   c.totalOpened,
+	})
+	c.state = state
+
+	switch state {
+	case CircuitOpen:
+		logWithFields.Warningf("%s API circuit breaker is open, API calls will fail fast for %s", c.service, c.openTimeout)
+	case CircuitHalfOpen:
+		logWithFields.Infof("%s API circuit breaker is half-open, probing the service recovery", c.service)
+	default:
+		logWithFields.Infof("%s API circuit breaker is closed", c.service)
+	}
+}
+
+// circuitBreakerTransport is an http.RoundTripper, which fails API calls
+// fast, when the circuit breaker is open
+type circuitBreakerTransport struct {
+	rt      http.RoundTripper
+	breaker *CircuitBreaker
+}
+
+// RoundTrip performs a round-trip HTTP request unless the circuit breaker is
+// open. Connection errors and 5xx response codes are counted as failures
+// except the "503 Service Unavailable" responses of a missing service, e.g.
+// the cinder-backup service, which don't mean that the API is unhealthy.
+func (t *circuitBreakerTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if err := t.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	response, err := t.rt.RoundTrip(request)
+	t.breaker.record(err == nil && (response.StatusCode < http.StatusInternalServerError || isServiceNotFoundResponse(response)))
+
+	return response, err
+}
+
+// isServiceNotFoundResponse returns true, when the response is a "503 Service
+// Unavailable" response of a missing service. The response body is restored,
+// so it can be read again.
+func isServiceNotFoundResponse(response *http.Response) bool {
+	if response.StatusCode != http.StatusServiceUnavailable || response.Body == nil {
+		return false
+	}
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	return err == nil && isServiceNotFoundBody(body)
+}
+
+// getCircuitBreaker returns a circuit breaker shared across all plugin
+// instances of the service. A nil circuit breaker is returned, when the error
+// rate threshold is not set.
+func getCircuitBreaker(service string, config map[string]string, log logrus.FieldLogger) (*CircuitBreaker, error) {
+	errorRate, err := strconv.ParseFloat(GetConf(config, "circuitBreakerErrorRate", "0"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse circuitBreakerErrorRate config variable: %w", err)
+	}
+	if errorRate < 0 || errorRate > 1 {
+		return nil, fmt.Errorf("circuitBreakerErrorRate config variable must be between 0 and 1")
+	}
+	if errorRate == 0 {
+		return nil, nil
+	}
+	minRequests, err := strconv.Atoi(GetConf(config, "circuitBreakerMinRequests", defaultCircuitBreakerMinRequests))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse circuitBreakerMinRequests config variable: %w", err)
+	}
+	if minRequests < 1 {
+		return nil, fmt.Errorf("circuitBreakerMinRequests config variable must be positive")
+	}
+	window, err := time.ParseDuration(GetConf(config, "circuitBreakerWindow", defaultCircuitBreakerWindow))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse time from circuitBreakerWindow config variable: %w", err)
+	}
+	openTimeout, err := time.ParseDuration(GetConf(config, "circuitBreakerOpenTimeout", defaultCircuitBreakerOpenTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse time from circuitBreakerOpenTimeout config variable: %w", err)
+	}
+
+	circuitBreakersMu.Lock()
+	defer circuitBreakersMu.Unlock()
+
+	c, ok := circuitBreakers[service]
+	if !ok {
+		c = &CircuitBreaker{
+			service: service,
+			log:     log,
+			now:     time.Now,
+		}
+		c.reset()
+		c.state = CircuitClosed
+		circuitBreakers[service] = c
+	}
+
+	// the latest plugin instance config takes precedence
+	c.mu.Lock()
+	c.errorRate = errorRate
+	c.minRequests = minRequests
+	c.window = window
+	c.openTimeout = openTimeout
+	c.mu.Unlock()
+
+	return c, nil
+}
@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"errors"
+	"expvar"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCircuitBreaker(t *testing.T) {
+	c, err := getCircuitBreaker("test-disabled", map[string]string{}, logrus.New())
+	assert.Nil(t, err)
+	assert.Nil(t, c)
+
+	for _, config := range []map[string]string{
+		{"circuitBreakerErrorRate": "1.5"},
+		{"circuitBreakerErrorRate": "abc"},
+		{"circuitBreakerErrorRate": "0.5", "circuitBreakerMinRequests": "0"},
+		{"circuitBreakerErrorRate": "0.5", "circuitBreakerWindow": "abc"},
+		{"circuitBreakerErrorRate": "0.5", "circuitBreakerOpenTimeout": "abc"},
+	} {
+		_, err := getCircuitBreaker("test-invalid", config, logrus.New())
+		assert.NotNil(t, err, "config: %v", config)
+	}
+
+	a, err := getCircuitBreaker("test-shared", map[string]string{"circuitBreakerErrorRate": "0.5"}, logrus.New())
+	assert.Nil(t, err)
+	b, err := getCircuitBreaker("test-shared", map[string]string{"circuitBreakerErrorRate": "0.7"}, logrus.New())
+	assert.Nil(t, err)
+	assert.Same(t, a, b)
+	assert.Equal(t, 0.7, a.errorRate)
+	assert.Equal(t, CircuitClosed, a.State())
+}
+
+func TestCircuitBreakerTransport(t *testing.T) {
+	var healthy, missing atomic.Bool
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if missing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"serviceUnavailable": {"code": 503, "message": "Service cinder-backup could not be found."}}`))
+			return
+		}
+		if healthy.Load() {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	config := map[string]string{
+		"circuitBreakerErrorRate":   "0.5",
+		"circuitBreakerMinRequests": "4",
+		"circuitBreakerOpenTimeout": "1m",
+	}
+	log, hook := test.NewNullLogger()
+	breaker, err := getCircuitBreaker("test-transport", config, log)
+	assert.Nil(t, err)
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	client := http.Client{
+		Transport: &circuitBreakerTransport{
+			rt:      http.DefaultTransport,
+			breaker: breaker,
+		},
+	}
+	get := func() error {
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// open the circuit breaker after 3 of 4 API calls fail
+	healthy.Store(true)
+	assert.Nil(t, get())
+	healthy.Store(false)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, get())
+	}
+	assert.Equal(t, CircuitOpen, breaker.State())
+	assert.Equal(t, 3, hook.LastEntry().Data["totalFailures"])
+	assert.Equal(t, 1, hook.LastEntry().Data["totalOpened"])
+
+	// fail fast without calling the API
+	err = get()
+	var errOpen ErrCircuitOpen
+	assert.True(t, errors.As(err, &errOpen))
+	assert.Equal(t, "test-transport", errOpen.Service)
+	assert.Equal(t, 0.75, errOpen.ErrorRate)
+	assert.Equal(t, int32(4), calls.Load())
+
+	// probe the failed service recovery
+	now = now.Add(2 * time.Minute)
+	assert.Nil(t, get())
+	assert.Equal(t, CircuitOpen, breaker.State())
+	assert.Equal(t, int32(5), calls.Load())
+
+	// probe the recovered service
+	now = now.Add(2 * time.Minute)
+	healthy.Store(true)
+	assert.Nil(t, get())
+	assert.Equal(t, CircuitClosed, breaker.State())
+	// the state transitions are logged with the total counters
+	assert.Equal(t, "closed", hook.LastEntry().Data["state"])
+	assert.Equal(t, 4, hook.LastEntry().Data["totalFailures"])
+	assert.Equal(t, 1, hook.LastEntry().Data["totalRejected"])
+	assert.Equal(t, 2, hook.LastEntry().Data["totalOpened"])
+	assert.Nil(t, get())
+	assert.Equal(t, int32(7), calls.Load())
+
+	// the state and the total counters are served as metrics
+	recorder := httptest.NewRecorder()
+	writeMetrics(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, recorder.Body.String(), `openstack_circuit_breaker_state{service="test-transport",state="closed"} 1`)
+	assert.Contains(t, recorder.Body.String(), `openstack_circuit_breaker_state{service="test-transport",state="open"} 0`)
+	assert.Contains(t, recorder.Body.String(), `openstack_circuit_breaker_failures_total{service="test-transport"} 4`)
+	assert.Contains(t, recorder.Body.String(), `openstack_circuit_breaker_rejected_total{service="test-transport"} 1`)
+	assert.Contains(t, recorder.Body.String(), `openstack_circuit_breaker_opened_total{service="test-transport"} 2`)
+	assert.Contains(t, expvar.Get("openstack_circuit_breakers").String(), `"test-transport":{"state":"closed","failures":4,"rejected":1,"opened":2}`)
+
+	// a missing service isn't counted as a failure and the response body is
+	// kept
+	missing.Store(true)
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get(server.URL)
+		assert.Nil(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Nil(t, err)
+		assert.Contains(t, string(body), "could not be found")
+	}
+	assert.Equal(t, CircuitClosed, breaker.State())
+}
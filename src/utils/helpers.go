@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -29,6 +31,20 @@ func (e ErrStatus) Error() string {
 	return fmt.Sprintf("unexpected %s status", e.Status)
 }
 
+// IsServiceNotFound returns true, when the API call failed with the "503
+// Service Unavailable" response code, because the OpenStack service, e.g. the
+// cinder-backup service, isn't deployed in the cloud
+func IsServiceNotFound(err error) bool {
+	var e gophercloud.ErrDefault503
+	return errors.As(err, &e) && isServiceNotFoundBody(e.Body)
+}
+
+// isServiceNotFoundBody returns true, when the response body contains the
+// ServiceNotFound error message
+func isServiceNotFoundBody(body []byte) bool {
+	return bytes.Contains(body, []byte("could not be found"))
+}
+
 // GetEnv gets value from environment variable or fallbacks to default value
 // This snippet is from https://stackoverflow.com/a/40326580/3323419
 func GetEnv(key, fallback string) string {
@@ -131,6 +147,35 @@ func Merge(args ...map[string]string) map[string]string {
 	return m
 }
 
+// SplitList splits a comma separated list and skips empty elements
+func SplitList(str string) []string {
+	var list []string
+	for _, v := range strings.Split(str, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// ParseMapping parses comma separated "key:value" pairs into a map
+func ParseMapping(str string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, pair := range strings.Split(str, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, ":")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("invalid %q mapping, must be in the \"key:value\" format", pair)
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
 // DurationToSeconds parses the string into a time.Duration format and returns
 // seconds in int format
 func DurationToSeconds(str string) (int, error) {
@@ -142,27 +187,46 @@ func DurationToSeconds(str string) (int, error) {
 	return int(t.Round(time.Second).Seconds()), nil
 }
 
-// WaitForStatus wait until the resource status satisfies the expected statuses
-func WaitForStatus(statuses []string, timeout int, checkFunc func() (string, error)) error {
-	return gophercloud.WaitFor(timeout, func() (bool, error) {
+// WaitForStatus polls the resource status once per the interval until the
+// status satisfies the expected statuses or the timeout in seconds is exceeded
+func WaitForStatus(statuses []string, timeout int, interval time.Duration, checkFunc func() (string, error)) error {
+	duration := time.Duration(timeout) * time.Second
+	deadline := time.Now().Add(duration)
+	for {
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("wait time exceeded: %s", duration)
+		}
+
+		time.Sleep(interval)
+
 		status, err := checkFunc()
 		if err != nil {
 			if _, ok := err.(gophercloud.ErrDefault404); ok && SliceContains(statuses, "deleted") {
-				return true, nil
+				return nil
 			}
-			return false, err
+			return err
 		}
 
 		if SliceContains(statuses, status) {
-			return true, nil
+			return nil
 		}
 
 		if strings.Contains(status, "error") {
-			return false, ErrStatus{Status: status}
+			return ErrStatus{Status: status}
 		}
+	}
+}
 
-		return false, nil
-	})
+// ParsePollInterval parses the interval between the resource status checks
+func ParsePollInterval(config map[string]string) (time.Duration, error) {
+	interval, err := time.ParseDuration(GetConf(config, "pollInterval", "1s"))
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse time from pollInterval config variable: %w", err)
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("pollInterval config variable must be positive")
+	}
+	return interval, nil
 }
 
 // EnsureDeleted ensures that the resource is deleted, resets the resource
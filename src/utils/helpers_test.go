@@ -131,6 +131,42 @@ func TestMerge(t *testing.T) {
 	}
 }
 
+func TestSplitList(t *testing.T) {
+	tests := map[string][]string{
+		"":            nil,
+		"a":           {"a"},
+		" a, ,b ,c, ": {"a", "b", "c"},
+	}
+
+	for str, expected := range tests {
+		if l := SplitList(str); !reflect.DeepEqual(expected, l) {
+			t.Errorf("[%s] test failed: expected %q, got %q", str, expected, l)
+		}
+	}
+}
+
+func TestParseMapping(t *testing.T) {
+	tests := map[string]map[string]string{
+		"":                       {},
+		"ssd:fast":               {"ssd": "fast"},
+		" ssd : fast, hdd:slow,": {"ssd": "fast", "hdd": "slow"},
+	}
+
+	for str, expected := range tests {
+		if m, err := ParseMapping(str); err != nil {
+			t.Errorf("[%s] test failed: %v", str, err)
+		} else if !reflect.DeepEqual(expected, m) {
+			t.Errorf("[%s] test failed: expected %q, got %q", str, expected, m)
+		}
+	}
+
+	for _, str := range []string{"ssd", "ssd:", ":fast", "ssd:fast,hdd"} {
+		if _, err := ParseMapping(str); err == nil {
+			t.Errorf("[%s] test failed: expected an error", str)
+		}
+	}
+}
+
 func TestDurationToSeconds(t *testing.T) {
 	tests := map[string]int{
 		"5m":  300,
@@ -147,3 +183,42 @@ func TestDurationToSeconds(t *testing.T) {
 		}
 	}
 }
+
+func TestWaitForStatus(t *testing.T) {
+	statuses := []string{"creating", "creating", "available"}
+	polls := 0
+	err := WaitForStatus([]string{"available"}, 1, time.Millisecond, func() (string, error) {
+		polls++
+		return statuses[polls-1], nil
+	})
+	if err != nil || polls != 3 {
+		t.Errorf("test failed: expected 3 polls, got %d and %v", polls, err)
+	}
+
+	err = WaitForStatus([]string{"available"}, 1, time.Millisecond, func() (string, error) {
+		return "error", nil
+	})
+	if _, ok := err.(ErrStatus); !ok {
+		t.Errorf("test failed: expected ErrStatus, got %v", err)
+	}
+
+	err = WaitForStatus([]string{"available"}, 0, time.Millisecond, func() (string, error) {
+		return "creating", nil
+	})
+	if err == nil {
+		t.Errorf("test failed: expected a timeout")
+	}
+}
+
+func TestParsePollInterval(t *testing.T) {
+	interval, err := ParsePollInterval(map[string]string{})
+	if err != nil || interval != time.Second {
+		t.Errorf("test failed: expected the 1s default, got %v and %v", interval, err)
+	}
+
+	for _, value := range []string{"abc", "0s", "-1s"} {
+		if _, err = ParsePollInterval(map[string]string{"pollInterval": value}); err == nil {
+			t.Errorf("[%s] test failed: expected an error", value)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// NewKubeClient returns a Kubernetes client using the in-cluster
+// configuration of the Velero pod
+func NewKubeClient() (kubernetes.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get in-cluster Kubernetes config: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	return client, nil
+}
+
+// GetConfigMapData returns data of the "[namespace/]name" ConfigMap, the
+// namespace defaults to the Velero namespace
+func GetConfigMapData(ctx context.Context, client kubernetes.Interface, ref string) (map[string]string, error) {
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok {
+		namespace, name = GetEnv("VELERO_NAMESPACE", "velero"), ref
+	}
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s/%s ConfigMap: %w", namespace, name, err)
+	}
+	return cm.Data, nil
+}
+
+// GetClaimName returns the "namespace/name" of the claim bound to the
+// persistent volume or an empty string, when the volume is not bound
+func GetClaimName(ctx context.Context, client kubernetes.Interface, pvName string) (string, error) {
+	pv, err := client.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s persistent volume: %w", pvName, err)
+	}
+	if pv.Spec.ClaimRef == nil {
+		return "", nil
+	}
+	return pv.Spec.ClaimRef.Namespace + "/" + pv.Spec.ClaimRef.Name, nil
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// BackupTag is a tag key, which is used by Velero to pass the backup name
+	BackupTag = "velero.io/backup"
+	// PVTag is a tag key, which is used by Velero to pass the persistent volume name
+	PVTag = "velero.io/pv"
+)
+
+var (
+	// a list of response headers containing the OpenStack request ID
+	requestIDHeaders = []string{
+		"X-Openstack-Request-Id",
+		"X-Compute-Request-Id",
+		// Swift
+		"X-Trans-Id",
+	}
+)
+
+// ErrRequestID is used to attach an OpenStack request ID to the failed API call error
+type ErrRequestID struct {
+	Err       error
+	RequestID string
+}
+
+// Error satisfies golang error interface
+func (e ErrRequestID) Error() string {
+	return fmt.Sprintf("%s (request ID: %s)", e.Err, e.RequestID)
+}
+
+// Unwrap returns the original error
+func (e ErrRequestID) Unwrap() error {
+	return e.Err
+}
+
+// GetRequestID returns the OpenStack request ID from the response headers
+func GetRequestID(header http.Header) string {
+	for _, h := range requestIDHeaders {
+		if v := header.Get(h); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// RequestID returns the OpenStack request ID of the failed API call, which
+// caused the error
+func RequestID(err error) string {
+	var e ErrRequestID
+	if errors.As(err, &e) {
+		return e.RequestID
+	}
+	var r gophercloud.ErrUnexpectedResponseCode
+	if errors.As(err, &r) {
+		return GetRequestID(r.ResponseHeader)
+	}
+	return ""
+}
+
+// WithRequestID attaches the OpenStack request ID of the failed API call to
+// the error message
+func WithRequestID(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e ErrRequestID
+	if errors.As(err, &e) {
+		// the request ID is already attached
+		return err
+	}
+	if id := RequestID(err); id != "" {
+		return ErrRequestID{Err: err, RequestID: id}
+	}
+	return err
+}
+
+// BackupFields returns log fields, which correlate the log entries with the
+// Velero backup
+func BackupFields(tags map[string]string) logrus.Fields {
+	fields := logrus.Fields{}
+	if v, ok := tags[BackupTag]; ok {
+		fields["backup"] = v
+	}
+	if v, ok := tags[PVTag]; ok {
+		fields["pv"] = v
+	}
+	return fields
+}
+
+// apiLogger is an http.RoundTripper, which logs a single line per
+// OpenStack API call
+type apiLogger struct {
+	rt  http.RoundTripper
+	log logrus.FieldLogger
+}
+
+// RoundTrip performs a round-trip HTTP request and logs the result
+func (l *apiLogger) RoundTrip(request *http.Request) (*http.Response, error) {
+	start := time.Now()
+	response, err := l.rt.RoundTrip(request)
+	logWithFields := l.log.WithFields(logrus.Fields{
+		"method":   request.Method,
+		"url":      request.URL.Scheme + "://" + request.URL.Host + request.URL.Path,
+		"duration": time.Since(start).Round(time.Millisecond).String(),
+	})
+	if err != nil {
+		logWithFields.Warningf("OpenStack API call failed: %v", err)
+		return response, err
+	}
+
+	logWithFields.WithFields(logrus.Fields{
+		"status":    response.StatusCode,
+		"requestID": GetRequestID(response.Header),
+	}).Info("OpenStack API call")
+
+	return response, nil
+}
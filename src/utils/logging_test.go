@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRequestID(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Openstack-Request-Id", "req-1234")
+	apiErr := gophercloud.ErrDefault404{
+		ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{
+			Actual:         http.StatusNotFound,
+			ResponseHeader: header,
+		},
+	}
+
+	err := WithRequestID(fmt.Errorf("failed to get volume: %w", apiErr))
+	assert.Equal(t, "req-1234", RequestID(err))
+	assert.Contains(t, err.Error(), "(request ID: req-1234)")
+	assert.True(t, errors.As(err, &gophercloud.ErrDefault404{}))
+
+	// the request ID must be attached only once
+	err = WithRequestID(fmt.Errorf("failed to create snapshot: %w", err))
+	assert.Equal(t, 1, strings.Count(err.Error(), "request ID"))
+
+	// errors without a request ID are not changed
+	plainErr := fmt.Errorf("plain error")
+	assert.Equal(t, plainErr, WithRequestID(plainErr))
+	assert.Nil(t, WithRequestID(nil))
+}
+
+func TestAPILogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Openstack-Request-Id", "req-5678")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	log, hook := test.NewNullLogger()
+	client := http.Client{
+		Transport: &apiLogger{
+			rt:  http.DefaultTransport,
+			log: log,
+		},
+	}
+	resp, err := client.Get(server.URL + "/v3/volumes?name=secret")
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	entry := hook.LastEntry()
+	if assert.NotNil(t, entry) {
+		assert.Equal(t, logrus.InfoLevel, entry.Level)
+		assert.Equal(t, "req-5678", entry.Data["requestID"])
+		assert.Equal(t, http.StatusAccepted, entry.Data["status"])
+		assert.Equal(t, server.URL+"/v3/volumes", entry.Data["url"])
+	}
+}
+
+func TestBackupFields(t *testing.T) {
+	tags := map[string]string{
+		BackupTag: "my-backup",
+		PVTag:     "pvc-1234",
+		"foo":     "bar",
+	}
+	assert.Equal(t, logrus.Fields{"backup": "my-backup", "pv": "pvc-1234"}, BackupFields(tags))
+	assert.Equal(t, logrus.Fields{}, BackupFields(nil))
+}
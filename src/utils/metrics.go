@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// metricsOnce starts the metrics server once per plugin process
+var metricsOnce sync.Once
+
+func init() {
+	// circuit breaker states and counters published as expvar variables
+	expvar.Publish("openstack_circuit_breakers", expvar.Func(circuitBreakerVars))
+}
+
+// circuitBreakerMetrics contains the circuit breaker state and counters since
+// the plugin start
+type circuitBreakerMetrics struct {
+	Service  string `json:"-"`
+	State    string `json:"state"`
+	Failures int    `json:"failures"`
+	Rejected int    `json:"rejected"`
+	Opened   int    `json:"opened"`
+}
+
+// ServeMetrics serves the plugin metrics in the Prometheus text format on the
+// "/metrics" path and as expvar variables on the "/debug/vars" path of the
+// metricsAddress, when it is set. The metrics are served once per plugin
+// process, a failure to listen on the address is logged.
+func ServeMetrics(config map[string]string, log logrus.FieldLogger) {
+	address := GetConf(config, "metricsAddress", "")
+	if address == "" {
+		return
+	}
+
+	metricsOnce.Do(func() {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			log.WithError(err).Warnf("Failed to serve metrics on %s, the address may be used by another plugin process", address)
+			return
+		}
+		log.Infof("Serving metrics on %s", listener.Addr())
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", writeMetrics)
+		mux.Handle("/debug/vars", expvar.Handler())
+		go func() {
+			err := http.Serve(listener, mux)
+			log.WithError(err).Error("failed to serve metrics")
+		}()
+	})
+}
+
+// writeMetrics writes the circuit breaker metrics in the Prometheus text
+// format
+func writeMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	all := allCircuitBreakerMetrics()
+
+	fmt.Fprintln(w, "# HELP openstack_circuit_breaker_state State of the OpenStack service circuit breaker, 1 for the current state.")
+	fmt.Fprintln(w, "# TYPE openstack_circuit_breaker_state gauge")
+	for _, m := range all {
+		for _, state := range []string{CircuitClosed, CircuitHalfOpen, CircuitOpen} {
+			value := 0
+			if m.State == state {
+				value = 1
+			}
+			fmt.Fprintf(w, "openstack_circuit_breaker_state{service=%q,state=%q} %d\n", m.Service, state, value)
+		}
+	}
+	for _, counter := range []struct {
+		name, help string
+		value      func(circuitBreakerMetrics) int
+	}{
+		{"failures", "Failed API calls of the OpenStack service.", func(m circuitBreakerMetrics) int { return m.Failures }},
+		{"rejected", "API calls rejected by the open circuit breaker.", func(m circuitBreakerMetrics) int { return m.Rejected }},
+		{"opened", "Openings of the OpenStack service circuit breaker.", func(m circuitBreakerMetrics) int { return m.Opened }},
+	} {
+		fmt.Fprintf(w, "# HELP openstack_circuit_breaker_%s_total %s\n", counter.name, counter.help)
+		fmt.Fprintf(w, "# TYPE openstack_circuit_breaker_%s_total counter\n", counter.name)
+		for _, m := range all {
+			fmt.Fprintf(w, "openstack_circuit_breaker_%s_total{service=%q} %d\n", counter.name, m.Service, counter.value(m))
+		}
+	}
+}
+
+// circuitBreakerVars returns the circuit breaker metrics keyed by the service
+func circuitBreakerVars() interface{} {
+	vars := map[string]circuitBreakerMetrics{}
+	for _, m := range allCircuitBreakerMetrics() {
+		vars[m.Service] = m
+	}
+	return vars
+}
+
+// allCircuitBreakerMetrics returns the metrics of all circuit breakers sorted
+// by the service
+func allCircuitBreakerMetrics() []circuitBreakerMetrics {
+	circuitBreakersMu.Lock()
+	breakers := make([]*CircuitBreaker, 0, len(circuitBreakers))
+	for _, c := range circuitBreakers {
+		breakers = append(breakers, c)
+	}
+	circuitBreakersMu.Unlock()
+
+	all := make([]circuitBreakerMetrics, 0, len(breakers))
+	for _, c := range breakers {
+		all = append(all, c.metrics())
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Service < all[j].Service
+	})
+	return all
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	veleroclient "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// BackupUIDTag is a tag of the Velero backup UID
+	BackupUIDTag = "velero.io/backup-uid"
+	// RestoreTag is a tag of the Velero restore name
+	RestoreTag = "velero.io/restore"
+	// RestoreUIDTag is a tag of the Velero restore UID
+	RestoreUIDTag = "velero.io/restore-uid"
+)
+
+// NewVeleroClient returns a Velero client using the in-cluster configuration
+// of the Velero pod
+func NewVeleroClient() (veleroclient.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get in-cluster Kubernetes config: %w", err)
+	}
+	client, err := veleroclient.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Velero client: %w", err)
+	}
+	return client, nil
+}
+
+// GetBackupUID returns the UID of the Velero backup in the Velero namespace
+func GetBackupUID(ctx context.Context, client veleroclient.Interface, name string) (string, error) {
+	namespace := GetEnv("VELERO_NAMESPACE", "velero")
+	backup, err := client.VeleroV1().Backups(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s/%s backup: %w", namespace, name, err)
+	}
+	return string(backup.UID), nil
+}
+
+// BackupUIDTags returns the tags extended with the UID of the Velero backup
+// tagged by Velero. The tags are returned unchanged, when the backup cannot
+// be found.
+func BackupUIDTags(log logrus.FieldLogger, getClient func() (veleroclient.Interface, error), tags map[string]string) map[string]string {
+	backup := tags[BackupTag]
+	if backup == "" || tags[BackupUIDTag] != "" {
+		return tags
+	}
+	client, err := getClient()
+	if err != nil {
+		log.WithError(err).Warn("Failed to get backup UID, resources get unique names and are not reused by a retried backup")
+		return tags
+	}
+	uid, err := GetBackupUID(context.TODO(), client, backup)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get backup UID, resources get unique names and are not reused by a retried backup")
+		return tags
+	}
+	if uid == "" {
+		return tags
+	}
+	return Merge(tags, map[string]string{BackupUIDTag: uid})
+}
+
+// GetRestore returns the in-progress Velero restore of the backup in the
+// Velero namespace. Nil is returned, when there isn't exactly one such
+// restore.
+func GetRestore(ctx context.Context, client veleroclient.Interface, backup string) (*velerov1.Restore, error) {
+	namespace := GetEnv("VELERO_NAMESPACE", "velero")
+	restores, err := client.VeleroV1().Restores(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s restores: %w", namespace, err)
+	}
+	var found *velerov1.Restore
+	for i, restore := range restores.Items {
+		if restore.Spec.BackupName != backup || restore.Status.Phase != velerov1.RestorePhaseInProgress {
+			continue
+		}
+		if found != nil {
+			return nil, nil
+		}
+		found = &restores.Items[i]
+	}
+	return found, nil
+}
+
+// RestoreTags returns the tags extended with the name and UID of the
+// in-progress Velero restore of the backup tagged by Velero. The tags are
+// returned unchanged, when the restore cannot be found.
+func RestoreTags(log logrus.FieldLogger, getClient func() (veleroclient.Interface, error), tags map[string]string) map[string]string {
+	backup := tags[BackupTag]
+	if backup == "" {
+		return tags
+	}
+	client, err := getClient()
+	if err != nil {
+		log.WithError(err).Warn("Failed to get restore UID, restored resources get unique names and are not reused by a retried restore")
+		return tags
+	}
+	restore, err := GetRestore(context.TODO(), client, backup)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get restore UID, restored resources get unique names and are not reused by a retried restore")
+		return tags
+	}
+	if restore == nil || restore.UID == "" {
+		return tags
+	}
+	return Merge(tags, map[string]string{
+		RestoreTag:    restore.Name,
+		RestoreUIDTag: string(restore.UID),
+	})
+}
+
+// ResourceName returns the "<source>.<kind>.<suffix>" name of a resource
+// created from the source for the Velero backup or restore with the UID, so a
+// retried backup or restore of the same volume derives the same name. A
+// random suffix is used, when the UID is unknown, because the Velero backup
+// and restore names can be reused by new backups and restores.
+func ResourceName(source, kind, uid string) string {
+	if uid == "" {
+		uid = strconv.FormatUint(Rand.Uint64(), 10)
+	}
+	return fmt.Sprintf("%s.%s.%s", source, kind, uid)
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Orphan is a resource created by the plugin, which doesn't belong to any
+// existing Velero backup
+type Orphan struct {
+	// OpenStack service, e.g. "cinder", "glance" or "manila"
+	Service string
+	// resource kind, e.g. "snapshot", "volume", "backup", "image" or "share"
+	Kind string
+	ID   string
+	Name string
+	// Velero backup name, which the resource was created for
+	Backup string
+	// why the resource is an orphan
+	Reason string
+	// whether the orphan was deleted
+	Deleted bool
+	// the deletion error
+	Error error
+}
+
+// OrphanCollector collects orphaned resources and optionally deletes them
+type OrphanCollector struct {
+	// names of the existing Velero backups
+	Backups map[string]bool
+	// ID of the Velero installation, see InstallationID
+	Installation string
+	// resources younger than MinAge may belong to a running backup or
+	// restore and are never collected
+	MinAge time.Duration
+	// deletes the orphans, otherwise they are only reported
+	Delete  bool
+	Orphans []Orphan
+	Log     logrus.FieldLogger
+}
+
+// Expired reports whether the resource created at the time is old enough to
+// be collected
+func (c *OrphanCollector) Expired(created time.Time) bool {
+	return time.Since(created) >= c.MinAge
+}
+
+// Owned reports whether the resource metadata carries the plugin ownership
+// metadata of the Velero installation. Resources of other clusters or Velero
+// installations sharing the project and resources created by older plugin
+// versions are never collected.
+func (c *OrphanCollector) Owned(metadata map[string]string) bool {
+	return metadata[VersionKey] != "" && c.Installation != "" && metadata[InstallationKey] == c.Installation
+}
+
+// BackupExists reports whether the Velero backup exists. Resources without a
+// backup name are not considered as orphans.
+func (c *OrphanCollector) BackupExists(backup string) bool {
+	return backup == "" || c.Backups[backup]
+}
+
+// Add collects the orphan and deletes it using the remove function, when the
+// collector deletes orphans
+func (c *OrphanCollector) Add(orphan Orphan, remove func() error) {
+	logWithFields := c.Log.WithFields(logrus.Fields{
+		"service": orphan.Service,
+		"kind":    orphan.Kind,
+		"id":      orphan.ID,
+		"name":    orphan.Name,
+		"backup":  orphan.Backup,
+		"reason":  orphan.Reason,
+	})
+	logWithFields.Info("Found orphaned resource")
+
+	if c.Delete {
+		orphan.Error = remove()
+		if orphan.Error != nil {
+			logWithFields.WithError(orphan.Error).Error("failed to delete orphaned resource")
+		} else {
+			orphan.Deleted = true
+			logWithFields.Info("Orphaned resource was deleted")
+		}
+	}
+	c.Orphans = append(c.Orphans, orphan)
+}
+
+// Err returns the joined deletion errors
+func (c *OrphanCollector) Err() error {
+	var err error
+	for _, orphan := range c.Orphans {
+		err = errors.Join(err, orphan.Error)
+	}
+	return err
+}
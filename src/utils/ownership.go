@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// VersionKey is a metadata key of the plugin version, which created the
+	// resource
+	VersionKey = "velero-plugin-for-openstack/version"
+	// MethodKey is a metadata key of the snapshot method
+	MethodKey = "velero-plugin-for-openstack/method"
+	// CreatedAtKey is a metadata key of the resource creation time
+	CreatedAtKey = "velero-plugin-for-openstack/created-at"
+	// SourceKey is a metadata key of the resource ID, which the resource was
+	// created from, e.g. a volume ID of a snapshot or a snapshot ID of a
+	// restored volume
+	SourceKey = "velero-plugin-for-openstack/source"
+	// PVCKey is a metadata key of the "namespace/name" persistent volume
+	// claim bound to the backed up persistent volume
+	PVCKey = "velero-plugin-for-openstack/pvc"
+	// InstallationKey is a metadata key of the Velero installation, which
+	// created the resource, see InstallationID
+	InstallationKey = "velero-plugin-for-openstack/installation"
+)
+
+// OwnershipTags returns the ownership metadata of a resource created by the
+// plugin from the source resource. The Velero backup, restore, persistent
+// volume and claim names are taken from the tags.
+func OwnershipTags(tags map[string]string, method, source string) map[string]string {
+	version := Version
+	if version == "" {
+		version = "unknown"
+	}
+	owner := map[string]string{
+		VersionKey:   version,
+		MethodKey:    method,
+		CreatedAtKey: time.Now().UTC().Format(time.RFC3339),
+		SourceKey:    source,
+	}
+	for _, key := range []string{BackupTag, RestoreTag, PVTag, PVCKey} {
+		if v := tags[key]; v != "" {
+			owner[key] = v
+		}
+	}
+	return owner
+}
+
+// ClaimTags returns the tags extended with the claim bound to the persistent
+// volume tagged by Velero. The tags are returned unchanged, when the claim
+// cannot be found.
+func ClaimTags(log logrus.FieldLogger, getClient func() (kubernetes.Interface, error), tags map[string]string) map[string]string {
+	pv := tags[PVTag]
+	if pv == "" || tags[PVCKey] != "" {
+		return tags
+	}
+	client, err := getClient()
+	if err != nil {
+		log.WithError(err).Warn("Failed to get persistent volume claim, the claim is not kept in the metadata")
+		return tags
+	}
+	claim, err := GetClaimName(context.TODO(), client, pv)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get persistent volume claim, the claim is not kept in the metadata")
+		return tags
+	}
+	if claim == "" {
+		return tags
+	}
+	return Merge(tags, map[string]string{PVCKey: claim})
+}
+
+// InstallationID returns the "<cluster ID>/<Velero namespace>" ID of the
+// Velero installation, the UID of the kube-system namespace identifies the
+// cluster. Orphaned resources are collected only by the installation, which
+// created them, when several clusters share the OpenStack project.
+func InstallationID(ctx context.Context, client kubernetes.Interface, namespace string) (string, error) {
+	ns, err := client.CoreV1().Namespaces().Get(ctx, metav1.NamespaceSystem, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s namespace: %w", metav1.NamespaceSystem, err)
+	}
+	if ns.UID == "" {
+		return "", fmt.Errorf("%s namespace has no UID", metav1.NamespaceSystem)
+	}
+	return fmt.Sprintf("%s/%s", ns.UID, namespace), nil
+}
+
+// InstallationTags returns the tags extended with the ID of the Velero
+// installation. The tags are returned unchanged, when the installation ID
+// cannot be determined, such resources are never collected as orphans.
+func InstallationTags(log logrus.FieldLogger, getClient func() (kubernetes.Interface, error), tags map[string]string) map[string]string {
+	if tags[InstallationKey] != "" {
+		return tags
+	}
+	client, err := getClient()
+	if err != nil {
+		log.WithError(err).Warn("Failed to get Velero installation ID, the resource won't be collected as an orphan")
+		return tags
+	}
+	id, err := InstallationID(context.TODO(), client, GetEnv("VELERO_NAMESPACE", "velero"))
+	if err != nil {
+		log.WithError(err).Warn("Failed to get Velero installation ID, the resource won't be collected as an orphan")
+		return tags
+	}
+	return Merge(tags, map[string]string{InstallationKey: id})
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	tokens2 "github.com/gophercloud/gophercloud/openstack/identity/v2/tokens"
+	tokens3 "github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+)
+
+// QuotaUsage is a quota limit and usage of a single project resource
+type QuotaUsage struct {
+	Limit    int `json:"limit"`
+	InUse    int `json:"in_use"`
+	Reserved int `json:"reserved"`
+}
+
+// CheckQuota returns an error, when the requested amount of resources would
+// exceed the quota limit reduced by the margin percentage. Negative limits
+// are unlimited and resources without usage are not checked.
+func CheckQuota(usage map[string]QuotaUsage, request map[string]int, margin int) error {
+	resources := make([]string, 0, len(request))
+	for resource := range request {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	var exceeded []string
+	for _, resource := range resources {
+		u, ok := usage[resource]
+		if !ok || u.Limit < 0 || request[resource] <= 0 {
+			continue
+		}
+		limit := u.Limit * (100 - margin) / 100
+		if u.InUse+u.Reserved+request[resource] > limit {
+			exceeded = append(exceeded, fmt.Sprintf("%s (requested %d, in use %d, reserved %d, limit %d with a %d%% margin)",
+				resource, request[resource], u.InUse, u.Reserved, limit, margin))
+		}
+	}
+	if len(exceeded) > 0 {
+		return fmt.Errorf("project quota would be exceeded: %s", strings.Join(exceeded, ", "))
+	}
+
+	return nil
+}
+
+// ParseQuotaMargin parses the quota margin percentage, e.g. "10" or "10%"
+func ParseQuotaMargin(str string) (int, error) {
+	margin, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(str), "%"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %q quota margin: %w", str, err)
+	}
+	if margin < 0 || margin > 99 {
+		return 0, fmt.Errorf("quota margin must be between 0%% and 99%%, got %d%%", margin)
+	}
+	return margin, nil
+}
+
+// GetProjectID returns an ID of the project, which the provider client is
+// authenticated to
+func GetProjectID(pc *gophercloud.ProviderClient) (string, error) {
+	switch r := pc.GetAuthResult().(type) {
+	case tokens3.CreateResult:
+		project, err := r.ExtractProject()
+		if err != nil {
+			return "", fmt.Errorf("failed to extract project from the token: %w", err)
+		}
+		if project != nil && project.ID != "" {
+			return project.ID, nil
+		}
+	case tokens2.CreateResult:
+		token, err := r.ExtractToken()
+		if err != nil {
+			return "", fmt.Errorf("failed to extract tenant from the token: %w", err)
+		}
+		if token.Tenant.ID != "" {
+			return token.Tenant.ID, nil
+		}
+	}
+	return "", fmt.Errorf("the authentication token is not scoped to a project")
+}
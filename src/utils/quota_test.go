@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckQuota(t *testing.T) {
+	usage := map[string]QuotaUsage{
+		"snapshots": {Limit: 10, InUse: 8, Reserved: 1},
+		"gigabytes": {Limit: 100, InUse: 50},
+		"backups":   {Limit: -1, InUse: 1000},
+	}
+
+	assert.Nil(t, CheckQuota(usage, map[string]int{"snapshots": 1, "gigabytes": 50}, 0))
+	assert.Nil(t, CheckQuota(usage, map[string]int{"backups": 1000, "volumes": 1}, 0))
+
+	err := CheckQuota(usage, map[string]int{"snapshots": 2, "gigabytes": 51}, 0)
+	assert.EqualError(t, err, "project quota would be exceeded: "+
+		"gigabytes (requested 51, in use 50, reserved 0, limit 100 with a 0% margin), "+
+		"snapshots (requested 2, in use 8, reserved 1, limit 10 with a 0% margin)")
+
+	// the margin reserves a headroom
+	err = CheckQuota(usage, map[string]int{"gigabytes": 50}, 10)
+	assert.EqualError(t, err, "project quota would be exceeded: gigabytes (requested 50, in use 50, reserved 0, limit 90 with a 10% margin)")
+}
+
+func TestParseQuotaMargin(t *testing.T) {
+	for str, expected := range map[string]int{"0": 0, "10": 10, " 25% ": 25} {
+		margin, err := ParseQuotaMargin(str)
+		assert.Nil(t, err, str)
+		assert.Equal(t, expected, margin, str)
+	}
+	for _, str := range []string{"", "ten", "10abc", "-1", "100"} {
+		_, err := ParseQuotaMargin(str)
+		assert.Error(t, err, str)
+	}
+}
@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gophercloud/gophercloud"
+	tokens2 "github.com/gophercloud/gophercloud/openstack/identity/v2/tokens"
+	tokens3 "github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"golang.org/x/time/rate"
+)
+
+var (
+	// rate limiters shared across all plugin instances, keyed by an
+	// OpenStack service type, an endpoint host, a rate limit and a burst
+	rateLimiters   = map[string]*rate.Limiter{}
+	rateLimitersMu sync.Mutex
+)
+
+// rateLimiter is an http.RoundTripper, which limits the rate of OpenStack
+// API calls per service type of the called endpoint using token buckets
+type rateLimiter struct {
+	rt    http.RoundTripper
+	limit rate.Limit
+	burst int
+
+	// service types of the catalog endpoint URLs, which are known after the
+	// authentication
+	endpointsMu sync.RWMutex
+	endpoints   map[string]string
+}
+
+// RoundTrip waits for a token and performs a round-trip HTTP request
+func (l *rateLimiter) RoundTrip(request *http.Request) (*http.Response, error) {
+	limiter := getRateLimiter(l.key(request.URL), l.limit, l.burst)
+	if err := limiter.Wait(request.Context()); err != nil {
+		return nil, fmt.Errorf("failed to wait for an API rate limiter: %w", err)
+	}
+	return l.rt.RoundTrip(request)
+}
+
+// setEndpoints sets the service types of the catalog endpoints of the
+// authenticated provider
+func (l *rateLimiter) setEndpoints(pc *gophercloud.ProviderClient) {
+	endpoints := serviceEndpoints(pc)
+
+	l.endpointsMu.Lock()
+	defer l.endpointsMu.Unlock()
+	l.endpoints = endpoints
+}
+
+// key returns the rate limiter key of the URL: the service type of the
+// longest matching catalog endpoint and the URL host, e.g.
+// "volumev3@cinder.example.com". URLs without a catalog endpoint, e.g. the
+// authentication requests, are keyed by the host.
+func (l *rateLimiter) key(u *url.URL) string {
+	l.endpointsMu.RLock()
+	defer l.endpointsMu.RUnlock()
+
+	serviceType, matched := "", ""
+	for endpoint, t := range l.endpoints {
+		if strings.HasPrefix(u.String(), endpoint) && len(endpoint) > len(matched) {
+			serviceType, matched = t, endpoint
+		}
+	}
+	if serviceType == "" {
+		return u.Host
+	}
+	return serviceType + "@" + u.Host
+}
+
+// serviceEndpoints returns the service types of the catalog endpoint URLs of
+// the authenticated provider
+func serviceEndpoints(pc *gophercloud.ProviderClient) map[string]string {
+	endpoints := map[string]string{}
+	switch r := pc.GetAuthResult().(type) {
+	case tokens3.CreateResult:
+		catalog, err := r.ExtractServiceCatalog()
+		if err != nil {
+			return endpoints
+		}
+		for _, entry := range catalog.Entries {
+			for _, endpoint := range entry.Endpoints {
+				endpoints[strings.TrimSuffix(endpoint.URL, "/")] = entry.Type
+			}
+		}
+	case tokens2.CreateResult:
+		catalog, err := r.ExtractServiceCatalog()
+		if err != nil {
+			return endpoints
+		}
+		for _, entry := range catalog.Entries {
+			for _, endpoint := range entry.Endpoints {
+				for _, u := range []string{endpoint.PublicURL, endpoint.InternalURL, endpoint.AdminURL} {
+					if u != "" {
+						endpoints[strings.TrimSuffix(u, "/")] = entry.Type
+					}
+				}
+			}
+		}
+	}
+	return endpoints
+}
+
+// newRateLimiter returns a rate limiting http.RoundTripper. A nil rate
+// limiter is returned, when the rate limit is not set.
+func newRateLimiter(rt http.RoundTripper, config map[string]string) (*rateLimiter, error) {
+	rps, err := strconv.ParseFloat(GetConf(config, "rateLimit", "0"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse rateLimit config variable: %w", err)
+	}
+	if rps < 0 {
+		return nil, fmt.Errorf("rateLimit config variable must not be negative")
+	}
+	if rps == 0 {
+		return nil, nil
+	}
+
+	burst, err := strconv.Atoi(GetConf(config, "rateLimitBurst", strconv.Itoa(int(rps)+1)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse rateLimitBurst config variable: %w", err)
+	}
+	if burst < 1 {
+		return nil, fmt.Errorf("rateLimitBurst config variable must be positive")
+	}
+
+	return &rateLimiter{
+		rt:    rt,
+		limit: rate.Limit(rps),
+		burst: burst,
+	}, nil
+}
+
+// getRateLimiter returns a token bucket rate limiter shared across all plugin
+// instances calling the service with the same rate limit and burst. Plugin
+// instances with different rate limits use separate token buckets, so they
+// don't reset the rate limit of each other.
+func getRateLimiter(key string, limit rate.Limit, burst int) *rate.Limiter {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	key = fmt.Sprintf("%s/%g/%d", key, float64(limit), burst)
+	limiter, ok := rateLimiters[key]
+	if !ok {
+		limiter = rate.NewLimiter(limit, burst)
+		rateLimiters[key] = limiter
+	}
+	return limiter
+}
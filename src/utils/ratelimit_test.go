@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/fakeopenstack"
+	"github.com/gophercloud/gophercloud"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	limiter, err := newRateLimiter(http.DefaultTransport, map[string]string{})
+	assert.Nil(t, err)
+	assert.Nil(t, limiter)
+
+	for _, config := range []map[string]string{
+		{"rateLimit": "-1"},
+		{"rateLimit": "abc"},
+		{"rateLimit": "5", "rateLimitBurst": "0"},
+		{"rateLimit": "5", "rateLimitBurst": "abc"},
+	} {
+		_, err := newRateLimiter(http.DefaultTransport, config)
+		assert.NotNil(t, err, "config: %v", config)
+	}
+
+	limiter, err = newRateLimiter(http.DefaultTransport, map[string]string{"rateLimit": "5"})
+	assert.Nil(t, err)
+	assert.Equal(t, rate.Limit(5), limiter.limit)
+	assert.Equal(t, 6, limiter.burst)
+}
+
+func TestGetRateLimiter(t *testing.T) {
+	a := getRateLimiter("test-shared", 5, 6)
+	assert.Equal(t, rate.Limit(5), a.Limit())
+	assert.Equal(t, 6, a.Burst())
+
+	// the limiter is shared across plugin instances calling the same service
+	// with the same rate limit
+	b := getRateLimiter("test-shared", 5, 6)
+	assert.Same(t, a, b)
+
+	// a different rate limit doesn't reset the shared limiter
+	c := getRateLimiter("test-shared", 2, 3)
+	assert.NotSame(t, a, c)
+	assert.Equal(t, rate.Limit(5), a.Limit())
+	assert.Equal(t, 6, a.Burst())
+	assert.Equal(t, rate.Limit(2), c.Limit())
+	assert.Equal(t, 3, c.Burst())
+	assert.NotSame(t, a, getRateLimiter("test-shared", 5, 7))
+
+	d := getRateLimiter("test-other", 5, 6)
+	assert.NotSame(t, a, d)
+}
+
+func TestRateLimiter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := http.Client{
+		Transport: &rateLimiter{
+			rt:    http.DefaultTransport,
+			limit: rate.Limit(20),
+			burst: 1,
+		},
+	}
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		resp, err := client.Get(server.URL)
+		assert.Nil(t, err)
+		resp.Body.Close()
+	}
+
+	// 1 request is allowed by the burst, 4 requests have to wait 50ms each
+	assert.GreaterOrEqual(t, time.Since(start), 190*time.Millisecond)
+}
+
+func TestAuthenticateRateLimiter(t *testing.T) {
+	srv := fakeopenstack.NewTestServer(t)
+
+	var pc *gophercloud.ProviderClient
+	err := Authenticate(&pc, "cinder", map[string]string{"rateLimit": "5", "maxRetries": "3"}, logrus.New())
+	require.Nil(t, err)
+	assert.Equal(t, uint(3), pc.MaxBackoffRetries)
+	assert.NotNil(t, pc.RetryBackoffFunc)
+
+	// API calls of every service type are limited separately
+	limiter, ok := pc.HTTPClient.Transport.(*rateLimiter)
+	require.True(t, ok)
+	key := func(path string) string {
+		u, err := url.Parse(srv.URL + path)
+		require.Nil(t, err)
+		return limiter.key(u)
+	}
+	host := key("/")
+	assert.Equal(t, "volumev3@"+host, key("/volume/v3/"+fakeopenstack.ProjectID+"/volumes"))
+	assert.Equal(t, "image@"+host, key("/image/v2/images"))
+	assert.Equal(t, "object-store@"+host, key("/object-store/v1/AUTH_"+fakeopenstack.ProjectID+"/container"))
+
+	// the retries are disabled
+	pc = nil
+	err = Authenticate(&pc, "cinder", map[string]string{"maxRetries": "0"}, logrus.New())
+	require.Nil(t, err)
+	assert.Nil(t, pc.RetryBackoffFunc)
+	pc = nil
+	err = Authenticate(&pc, "cinder", map[string]string{"maxRetries": "-1"}, logrus.New())
+	assert.ErrorContains(t, err, "cannot parse maxRetries config variable")
+}
@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const redacted = "***"
+
+var (
+	// a list of environment variables containing secrets, which must never
+	// appear in logs
+	secretEnvs = []string{
+		"OS_PASSWORD",
+		"OS_AUTH_TOKEN",
+		"OS_APPLICATION_CREDENTIAL_SECRET",
+		"OS_SWIFT_PASSWORD",
+		"OS_SWIFT_APPLICATION_CREDENTIAL_SECRET",
+		"OS_SWIFT_TEMP_URL_KEY",
+	}
+	// a list of regexps and their replacements to scrub secrets from logs
+	redactRules = []struct {
+		re   *regexp.Regexp
+		repl string
+	}{
+		// HTTP headers
+		{
+			re:   regexp.MustCompile(`(?im)^((?:x-auth-token|x-subject-token|x-service-token|x-storage-token|x-auth-key|x-(?:account|container)-meta-temp-url-key(?:-2)?|authorization|set-cookie):\s*).*$`),
+			repl: "${1}" + redacted,
+		},
+		// URL query parameters
+		{
+			re:   regexp.MustCompile(`(?i)\b((?:temp_url_sig|temp_url_key|token|password)=)[^&\s"]+`),
+			repl: "${1}" + redacted,
+		},
+		// JSON attributes
+		{
+			re:   regexp.MustCompile(`(?i)("(?:password|secret|application_credential_secret|token|temp_url_key|temp-url-key)"\s*:\s*)"[^"]*"`),
+			repl: `${1}"` + redacted + `"`,
+		},
+	}
+	// a regexp to detect config keys with secret values
+	secretConfigKeyRe = regexp.MustCompile(`(?i)(password|secret|token|key$)`)
+
+	secretsMu sync.RWMutex
+	secrets   []string
+)
+
+func init() {
+	for _, env := range secretEnvs {
+		AddSecrets(os.Getenv(env))
+	}
+}
+
+// AddSecrets registers secret values, which must never appear in logs
+func AddSecrets(values ...string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, v := range values {
+		if v != "" && !SliceContains(secrets, v) {
+			secrets = append(secrets, v)
+		}
+	}
+}
+
+// Redact scrubs tokens, passwords, application credential secrets, Temp URL
+// keys and signatures from the string
+func Redact(s string) string {
+	for _, rule := range redactRules {
+		s = rule.re.ReplaceAllString(s, rule.repl)
+	}
+
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for _, v := range secrets {
+		s = strings.ReplaceAll(s, v, redacted)
+	}
+
+	return s
+}
+
+// RedactConfig returns a copy of the config map with scrubbed secret values
+func RedactConfig(config map[string]string) map[string]string {
+	m := make(map[string]string, len(config))
+	for k, v := range config {
+		if secretConfigKeyRe.MatchString(k) {
+			m[k] = redacted
+			continue
+		}
+		m[k] = Redact(v)
+	}
+	return m
+}
+
+// RedactHook is a logrus hook, which scrubs secrets from every log entry
+type RedactHook struct{}
+
+// Levels returns all log levels
+func (RedactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire scrubs secrets from the log entry message and fields
+func (RedactHook) Fire(entry *logrus.Entry) error {
+	entry.Message = Redact(entry.Message)
+	for k, v := range entry.Data {
+		switch v := v.(type) {
+		case string:
+			entry.Data[k] = Redact(v)
+		case error:
+			entry.Data[k] = Redact(v.Error())
+		case map[string]string:
+			entry.Data[k] = RedactConfig(v)
+		}
+	}
+	return nil
+}
+
+// AddRedactHook adds the RedactHook to the logger unless it is already added
+func AddRedactHook(log logrus.FieldLogger) {
+	var logger *logrus.Logger
+	switch l := log.(type) {
+	case *logrus.Logger:
+		logger = l
+	case *logrus.Entry:
+		logger = l.Logger
+	default:
+		return
+	}
+
+	for _, hook := range logger.Hooks[logrus.InfoLevel] {
+		if _, ok := hook.(RedactHook); ok {
+			return
+		}
+	}
+	logger.AddHook(RedactHook{})
+}
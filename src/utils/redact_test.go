@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/utils/client"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testToken      = "gAAAAABk-secret-token"
+	testPassword   = "sup3r-s3cr3t-passw0rd"
+	testAppSecret  = "app-cred-s3cr3t"
+	testTempURLKey = "temp-url-k3y"
+	testTempURLSig = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+)
+
+func newCapturedLogger() (*logrus.Logger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	log := logrus.New()
+	log.SetOutput(buf)
+	log.SetLevel(logrus.DebugLevel)
+	AddRedactHook(log)
+	return log, buf
+}
+
+func assertNoSecrets(t *testing.T, output string) {
+	for _, secret := range []string{testToken, testPassword, testAppSecret, testTempURLKey, testTempURLSig} {
+		assert.NotContains(t, output, secret)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := map[string]string{
+		"X-Auth-Token: " + testToken:                                                "X-Auth-Token: ***",
+		"x-container-meta-temp-url-key: " + testTempURLKey:                          "x-container-meta-temp-url-key: ***",
+		"GET /v1/AUTH_a/c/o?temp_url_sig=" + testTempURLSig + "&temp_url_expires=1": "GET /v1/AUTH_a/c/o?temp_url_sig=***&temp_url_expires=1",
+		`{"password": "` + testPassword + `"}`:                                      `{"password": "***"}`,
+		`{"id": "abc", "secret": "` + testAppSecret + `"}`:                          `{"id": "abc", "secret": "***"}`,
+		"nothing to redact":                                                         "nothing to redact",
+	}
+
+	for in, expected := range tests {
+		assert.Equal(t, expected, Redact(in))
+	}
+}
+
+func TestRedactConfig(t *testing.T) {
+	config := map[string]string{
+		"cloud":       "cloud1",
+		"password":    testPassword,
+		"tempURLKey":  testTempURLKey,
+		"method":      "snapshot",
+		"appSecret":   testAppSecret,
+		"description": "token=" + testToken,
+	}
+	redactedConfig := RedactConfig(config)
+	assert.Equal(t, "cloud1", redactedConfig["cloud"])
+	assert.Equal(t, "snapshot", redactedConfig["method"])
+	assert.Equal(t, testPassword, config["password"], "original config must not be changed")
+
+	log, buf := newCapturedLogger()
+	log.WithField("config", config).Info("Init called")
+	assertNoSecrets(t, buf.String())
+}
+
+func TestRedactHook(t *testing.T) {
+	AddSecrets(testPassword)
+	log, buf := newCapturedLogger()
+	// the hook must be added only once
+	AddRedactHook(log.WithField("foo", "bar"))
+	assert.Len(t, log.Hooks[logrus.InfoLevel], 1)
+
+	log.Infof("authenticating with %s password", testPassword)
+	log.WithField("header", "X-Subject-Token: "+testToken).Warning("response")
+	log.WithError(&testError{testPassword}).Error("failed")
+	assertNoSecrets(t, buf.String())
+	assert.Contains(t, buf.String(), redacted)
+}
+
+func TestDebugLogRedaction(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Subject-Token", testToken)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token": {"methods": ["password"]}}`))
+	}))
+	defer server.Close()
+
+	log, buf := newCapturedLogger()
+	httpClient := http.Client{
+		Transport: &client.RoundTripper{
+			Rt:     http.DefaultTransport,
+			Logger: osDebugger{log},
+		},
+	}
+
+	body := `{"auth": {"identity": {"password": {"user": {"name": "admin", "password": "` + testPassword + `"}}, ` +
+		`"application_credential": {"id": "abc", "secret": "` + testAppSecret + `"}}}}`
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/AUTH_a/c/o?temp_url_sig="+testTempURLSig, strings.NewReader(body))
+	assert.Nil(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Auth-Token", testToken)
+	req.Header.Set("X-Container-Meta-Temp-Url-Key", testTempURLKey)
+
+	resp, err := httpClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	assert.Contains(t, buf.String(), "OpenStack Request URL")
+	assertNoSecrets(t, buf.String())
+}
+
+type testError struct {
+	msg string
+}
+
+func (e *testError) Error() string {
+	return e.msg
+}